@@ -0,0 +1,5 @@
+module github.com/fxamacker/cbor/v2
+
+go 1.12
+
+require github.com/x448/float16 v0.8.4
@@ -0,0 +1,7 @@
+module github.com/mattn/go-sqlite3
+
+go 1.19
+
+retract (
+ [v2.0.0+incompatible, v2.0.6+incompatible] // Accidental; no major changes or features.
+)
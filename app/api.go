@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	. "github.com/lukeatherton/domain-events"
@@ -30,6 +31,7 @@ func GetIdParam(param string, c *gin.Context) uuid.UUID {
 func Authenticate(c *gin.Context) {
 	auth := c.MustGet("auth").(Authenticator)
 	repo := c.MustGet("repo").(Repo)
+	throttle := c.MustGet("loginThrottle").(*LoginThrottle)
 
 	c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
 
@@ -40,19 +42,59 @@ func Authenticate(c *gin.Context) {
 	password := view.Password
 
 	if email != "" && password != "" {
-		token, auth_err := auth.Authenticate(email, password, "")
+		ip := clientIP(c)
+		if throttle.IsThrottled(ip) {
+			c.JSON(http.StatusUnauthorized, ErrInvalidPassword.Error())
+			return
+		}
+
+		token, auth_err := auth.Authenticate(c.Request.Context(), email, password, "")
+		if auth_err == ErrMFARequired {
+			c.JSON(http.StatusUnauthorized, newMFAChallengeResponse(token))
+			return
+		}
+
+		if auth_err == ErrConflict {
+			c.JSON(http.StatusConflict, NewError(ErrCodeConflict, "credentials were changed by another request"))
+			return
+		}
+
+		if auth_err == ErrAccountLocked {
+			publishAccountLocked(c, email)
+			auth_err = ErrInvalidPassword
+		}
+
 		if auth_err != nil {
+			throttle.AddFailure(ip)
+
 			//TODO: Fix this, reveals user details to client
 			c.JSON(http.StatusUnauthorized, auth_err.Error())
 			return
 		}
 
-		userId, _ := repo.FindEmail(email)
+		userId, _ := repo.FindEmail(c.Request.Context(), email)
+
+		refreshToken, refresh_err := auth.IssueRefreshToken(c.Request.Context(), userId, tokenAmr(auth, token))
+		if refresh_err != nil {
+			c.JSON(http.StatusInternalServerError, refresh_err.Error())
+			return
+		}
 
 		response := AuthResponse{
-			Id:    userId,
-			Email: email,
-			Token: token,
+			Id:           userId,
+			Email:        email,
+			Token:        token,
+			RefreshToken: refreshToken,
+		}
+
+		if view.ClientId != "" {
+			idToken, id_err := auth.IssueIdToken(c.Request.Context(), userId, view.ClientId, view.Nonce, time.Now())
+			if id_err != nil {
+				c.JSON(http.StatusInternalServerError, id_err.Error())
+				return
+			}
+
+			response.IdToken = idToken
 		}
 
 		c.JSON(http.StatusOK, response)
@@ -67,6 +109,75 @@ func Authenticate(c *gin.Context) {
 	return
 }
 
+// Exchanges a refresh token for a new Auth token and a rotated refresh token
+func RefreshAuthToken(c *gin.Context) {
+	auth := c.MustGet("auth").(Authenticator)
+
+	c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
+
+	var view *RefreshTokenView
+	c.Bind(&view)
+
+	if view == nil || view.RefreshToken == "" {
+		c.JSON(http.StatusBadRequest, NewError(ErrCodeValueRequired, "refresh token is a required field"))
+		return
+	}
+
+	token, refreshToken, refresh_err := auth.RefreshToken(c.Request.Context(), view.RefreshToken)
+	if refresh_err != nil {
+		c.JSON(http.StatusUnauthorized, NewError(ErrCodeInvalidToken, "refresh token is invalid"))
+		return
+	}
+
+	id, _ := auth.GetTokenClaim(token, "id")
+	email, _ := auth.GetTokenClaim(token, "email")
+	userId, _ := uuid.FromString(id.(string))
+
+	response := AuthResponse{
+		Id:           userId,
+		Email:        email.(string),
+		Token:        token,
+		RefreshToken: refreshToken,
+	}
+
+	c.JSON(http.StatusOK, response)
+	return
+}
+
+// Revokes an Auth token or refresh token. Unknown tokens are ignored so the
+// response does not reveal whether a token was ever valid.
+func RevokeToken(c *gin.Context) {
+	auth := c.MustGet("auth").(Authenticator)
+
+	c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
+
+	var view *RevokeTokenView
+	c.Bind(&view)
+
+	if view == nil || view.Token == "" {
+		c.JSON(http.StatusBadRequest, NewError(ErrCodeValueRequired, "token is a required field"))
+		return
+	}
+
+	if err := auth.RevokeToken(c.Request.Context(), view.Token); err != nil {
+		fmt.Printf("ERROR: %v\n", err.Error())
+	}
+
+	c.JSON(http.StatusOK, "token revoked")
+	return
+}
+
+// Publishes the public signing keys so other services can validate tokens
+func GetJSONWebKeySet(c *gin.Context) {
+	auth := c.MustGet("auth").(Authenticator)
+
+	c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
+	c.Writer.Header().Set("Cache-Control", "public, max-age=3600")
+
+	c.JSON(http.StatusOK, auth.GetJSONWebKeySet())
+	return
+}
+
 func CheckEmail(c *gin.Context) {
 	repo := c.MustGet("repo").(Repo)
 
@@ -78,9 +189,9 @@ func CheckEmail(c *gin.Context) {
 
 	if email != "" {
 
-		user, err := repo.FindEmail(email)
+		user, err := repo.FindEmail(c.Request.Context(), email)
 
-		if err != nil && err.Error() != "not found" {
+		if err != nil && err != ErrNotFound {
 			c.JSON(http.StatusInternalServerError, err.Error())
 			return
 		}
@@ -111,25 +222,42 @@ func VerifyEmail(c *gin.Context) {
 
 	if code != "" && email != "" {
 
-		userId, err := repo.FindEmail(email)
+		userId, err := repo.FindEmail(c.Request.Context(), email)
 
-		if err != nil && err.Error() != "not found" {
+		if err != nil && err != ErrNotFound {
 			c.JSON(http.StatusBadRequest, NewError(ErrCodeValueRequired, fmt.Sprintf("email verification failed")))
 			return
 		}
 
 		if userId != uuid.Nil {
-			user, err := repo.GetCredentials(userId)
+			user, err := repo.GetCredentials(c.Request.Context(), userId)
 
-			if err != nil && err.Error() != "not found" {
+			if err != nil && err != ErrNotFound {
 				c.JSON(http.StatusBadRequest, NewError(ErrCodeValueRequired, fmt.Sprintf("email verification failed")))
 				return
 			}
 
-			if user.EmailVerificationCode == code {
-				user.IsEmailVerified = true
-				repo.SaveCredentials(userId, user)
+			_, err = UpdateCredentials(c.Request.Context(), repo, user, func(user *Credentials) error {
+				if !user.checkEmailVerificationCode(code, time.Now()) {
+					return ErrInvalidVerificationCode
+				}
+
+				user.confirmEmail(time.Now())
+
+				return nil
+			})
+
+			if err == ErrConflict {
+				c.JSON(http.StatusConflict, NewError(ErrCodeConflict, "credentials were changed by another request"))
+				return
+			}
 
+			if err != nil && err != ErrInvalidVerificationCode {
+				c.JSON(http.StatusInternalServerError, err.Error())
+				return
+			}
+
+			if err == nil {
 				if c.Request.Header.Get("CID") == "" {
 					go publisher.PublishMessage(NewEmailVerifiedEvent(userId, email, uuid.Nil))
 				}
@@ -157,15 +285,15 @@ func RegisterUser(c *gin.Context) {
 	var view *UserRegistrationView
 	c.Bind(&view)
 
-	credentials, validate_err := DecodeRegistrationDetails(view)
-	if validate_err != nil {
-		c.JSON(http.StatusBadRequest, validate_err)
+	credentials, validate_errs := DecodeRegistrationDetails(view)
+	if len(validate_errs) != 0 {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Errors: validate_errs})
 		return
 	}
 
 	credentials.Email = strings.ToLower(credentials.Email)
 
-	duplicateUserId, _ := repo.FindEmail(credentials.Email)
+	duplicateUserId, _ := repo.FindEmail(c.Request.Context(), credentials.Email)
 
 	if duplicateUserId != uuid.Nil {
 		c.JSON(http.StatusBadRequest, NewError(ErrCodeAlreadyExists, "user email exists"))
@@ -174,15 +302,26 @@ func RegisterUser(c *gin.Context) {
 
 	credentials.Id = uuid.NewV4()
 	credentials.IsEmailVerified = false
-	credentials.EmailVerificationCode = uuid.NewV4().String()
 
-	err := repo.SaveCredentials(credentials.Id, credentials)
+	verificationCode, err := credentials.IssueEmailVerificationCode()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	token, auth_err := auth.Authenticate(view.Email, view.Password, "")
+	// Another registration may have taken the email since it was checked.
+	err = repo.SaveCredentials(c.Request.Context(), credentials.Id, credentials)
+	if err == ErrDuplicateEmail {
+		c.JSON(http.StatusBadRequest, NewError(ErrCodeAlreadyExists, "user email exists"))
+		return
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	token, auth_err := auth.Authenticate(c.Request.Context(), view.Email, view.Password, "")
 	if auth_err != nil {
 		//TODO: Fix this, reveals user details to client
 		c.JSON(http.StatusUnauthorized, auth_err.Error())
@@ -190,7 +329,7 @@ func RegisterUser(c *gin.Context) {
 	}
 
 	go publisher.PublishMessage(NewUserRegisteredEvent(credentials.Id, credentials.Email, uuid.Nil))
-	go publisher.PublishMessage(NewEmailVerificationPendingEvent(credentials.Id, credentials.Email, credentials.EmailVerificationCode, uuid.Nil))
+	go publisher.PublishMessage(NewEmailVerificationPendingEvent(credentials.Id, credentials.Email, verificationCode, uuid.Nil))
 
 	response := AuthResponse{
 		Id:    credentials.Id,
@@ -202,20 +341,29 @@ func RegisterUser(c *gin.Context) {
 	return
 }
 
-// Parse the request body, load into an Registration structure.
-func DecodeRegistrationDetails(reg *UserRegistrationView) (*Credentials, *Error) {
+// Parse the request body, load into an Registration structure. The password
+// must meet the DefaultPasswordPolicy.
+func DecodeRegistrationDetails(reg *UserRegistrationView) (*Credentials, []*Error) {
 
-	if reg.Password == "" {
-		return nil, NewError(ErrCodeValueRequired, fmt.Sprintf("password is a required field"))
+	if reg == nil || reg.Password == "" {
+		return nil, []*Error{NewError(ErrCodeValueRequired, fmt.Sprintf("password is a required field"))}
 	}
 
 	if reg.Email == "" {
-		return nil, NewError(ErrCodeValueRequired, fmt.Sprintf("email is a required field"))
+		return nil, []*Error{NewError(ErrCodeValueRequired, fmt.Sprintf("email is a required field"))}
 	}
 
-	passwordKey := DeriveKey(reg.Password)
+	if policy_errs := DefaultPasswordPolicy.Validate(reg.Password, reg.Email); len(policy_errs) != 0 {
+		return nil, policy_errs
+	}
 
-	credentials := &Credentials{Email: reg.Email, Key: passwordKey.Key, Salt: passwordKey.Salt, IsEmailVerified: false}
+	credentials := &Credentials{Email: reg.Email, IsEmailVerified: false}
+
+	if err := credentials.SetPassword(reg.Password); err != nil {
+		return nil, []*Error{NewError(ErrCodeValueRequired, fmt.Sprintf("unable to hash password: %v", err))}
+	}
+
+	credentials.PasswordChangedDate = time.Now()
 
 	return credentials, nil
 }
@@ -235,13 +383,23 @@ func ChangePassword(c *gin.Context) {
 		return
 	}
 
-	_, auth_err := auth.Authenticate(email, view.OldPassword, "")
-	if auth_err != nil {
+	if policy_errs := DefaultPasswordPolicy.Validate(view.NewPassword, email); len(policy_errs) != 0 {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Errors: policy_errs})
+		return
+	}
+
+	// A challenge still proves the old password was correct.
+	_, auth_err := auth.Authenticate(c.Request.Context(), email, view.OldPassword, "")
+	if auth_err == ErrAccountLocked {
+		publishAccountLocked(c, email)
+	}
+
+	if auth_err != nil && auth_err != ErrMFARequired {
 		c.JSON(http.StatusUnauthorized, "")
 		return
 	}
 
-	credentials, err := repo.GetCredentials(id)
+	credentials, err := repo.GetCredentials(c.Request.Context(), id)
 
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, err.Error())
@@ -249,19 +407,51 @@ func ChangePassword(c *gin.Context) {
 	}
 
 	if credentials != nil {
-		passwordKey := DeriveKey(view.NewPassword)
+		// A password changed by another request since the old one was checked
+		// is a conflict rather than something to retry over.
+		changedDate := credentials.PasswordChangedDate
+
+		_, err := UpdateCredentials(c.Request.Context(), repo, credentials, func(credentials *Credentials) error {
+			if !credentials.PasswordChangedDate.Equal(changedDate) {
+				return ErrConflict
+			}
+
+			if !credentials.canChangePassword(time.Now()) {
+				return &PasswordPolicyError{Errors: []*Error{NewError(ErrCodePasswordTooRecent, "password was changed too recently")}}
+			}
 
-		credentials.Salt = passwordKey.Salt
-		credentials.Key = passwordKey.Key
+			return credentials.ReplacePassword(view.NewPassword, time.Now())
+		})
 
-		err := repo.SaveCredentials(id, credentials)
+		if policy_err, ok := err.(*PasswordPolicyError); ok {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Errors: policy_err.Errors})
+			return
+		}
+
+		if err == ErrConflict {
+			c.JSON(http.StatusConflict, NewError(ErrCodeConflict, "credentials were changed by another request"))
+			return
+		}
 
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, err.Error())
 			return
 		}
 
-		token, auth_err := auth.Authenticate(email, view.NewPassword, "")
+		err = auth.RevokeUserTokens(c.Request.Context(), id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		// Every session has just been revoked, so users with a second
+		// factor have to present it again.
+		token, auth_err := auth.Authenticate(c.Request.Context(), email, view.NewPassword, "")
+		if auth_err == ErrMFARequired {
+			c.JSON(http.StatusCreated, newMFAChallengeResponse(token))
+			return
+		}
+
 		if auth_err != nil {
 			c.JSON(http.StatusUnauthorized, "")
 			return
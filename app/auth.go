@@ -4,9 +4,15 @@ package authenticator
 
 import (
 	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
+	"log"
 	"os"
 	"time"
 
@@ -14,31 +20,88 @@ import (
 	"github.com/satori/go.uuid"
 )
 
+var (
+	AccessTokenLifetime  = time.Hour * 72
+	RefreshTokenLifetime = time.Hour * 24 * 30
+	RefreshTokenLength   = 32
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("Refresh Failed: Invalid refresh token.")
+	ErrRefreshTokenReused  = errors.New("Refresh Failed: Refresh token has already been used.")
+)
+
 type Authenticator interface {
-	Authenticate(email string, password string, uri string) (string, error)
-	ValidateToken(tokenString string) bool
+	Authenticate(ctx context.Context, email string, password string, uri string) (string, error)
+	ValidateToken(ctx context.Context, tokenString string) bool
 	GetTokenClaim(tokenString string, claim string) (value interface{}, err error)
+	GetTokenClaims(tokenString string) (claims map[string]interface{}, err error)
+
+	IssueRefreshToken(ctx context.Context, userId uuid.UUID, amr []string) (string, error)
+	RefreshToken(ctx context.Context, refreshToken string) (token string, nextRefreshToken string, err error)
+
+	RevokeToken(ctx context.Context, tokenString string) (err error)
+	RevokeUserTokens(ctx context.Context, userId uuid.UUID) (err error)
+
+	GetJSONWebKeySet() *JSONWebKeySet
+
+	GetIssuer() string
+	IssueIdToken(ctx context.Context, userId uuid.UUID, audience string, nonce string, authTime time.Time) (string, error)
+
+	IssueAuthorizationCode(ctx context.Context, userId uuid.UUID, request *AuthorizationRequest, authTime time.Time, amr []string) (string, error)
+	ExchangeAuthorizationCode(ctx context.Context, code string, clientId string, clientSecret string, redirectUri string, codeVerifier string) (*TokenResponse, error)
+
+	AuthenticateClient(ctx context.Context, clientId string, clientSecret string) (*Client, error)
+	IssueClientToken(client *Client, scope string) (*TokenResponse, error)
+
+	RequestPasswordReset(ctx context.Context, email string) (userId uuid.UUID, token string, err error)
+	ResetPassword(ctx context.Context, token string, newPassword string) (userId uuid.UUID, err error)
+
+	EnrollTOTP(ctx context.Context, userId uuid.UUID) (secret string, uri string, err error)
+	ConfirmTOTP(ctx context.Context, userId uuid.UUID, code string) (recoveryCodes []string, err error)
+	CompleteMFA(ctx context.Context, challengeToken string, code string) (token string, usedRecoveryCode bool, err error)
+	RegenerateRecoveryCodes(ctx context.Context, userId uuid.UUID) (recoveryCodes []string, err error)
+
+	UnlockAccount(ctx context.Context, userId uuid.UUID) (err error)
+
+	ResendEmailVerification(ctx context.Context, email string) (userId uuid.UUID, code string, err error)
+
+	RequestEmailChange(ctx context.Context, userId uuid.UUID, newEmail string) (code string, err error)
+	ConfirmEmailChange(ctx context.Context, userId uuid.UUID, code string, amr []string) (token string, oldEmail string, err error)
+
+	RequestLoginLink(ctx context.Context, email string) (userId uuid.UUID, token string, code string, err error)
+	RedeemLoginLink(ctx context.Context, token string) (accessToken string, verified bool, err error)
+	RedeemLoginCode(ctx context.Context, email string, code string) (accessToken string, verified bool, err error)
+
+	BeginWebAuthnRegistration(ctx context.Context, userId uuid.UUID) (*WebAuthnCreationResponse, error)
+	FinishWebAuthnRegistration(ctx context.Context, userId uuid.UUID, view *WebAuthnRegistrationView) (err error)
+	BeginWebAuthnLogin(ctx context.Context, email string) (*WebAuthnRequestResponse, error)
+	FinishWebAuthnLogin(ctx context.Context, view *WebAuthnLoginView) (string, error)
 }
 
 type TokenAuthenticator struct {
-	repo       Repo
-	privateKey []byte
-	publicKey  []byte
+	repo        Repo
+	revocations RevocationStore
+	keys        *KeyRing
+	issuer      string
 }
 
-func BuildAuthenticator(repo Repo, privateKeyPath string, publicKeyPath string) Authenticator {
-	publicKey, _ := readKeyFromFile(publicKeyPath)
-	privateKey, _ := readKeyFromFile(privateKeyPath)
+func BuildAuthenticator(repo Repo, revocations RevocationStore, issuer string, privateKeyPath string, publicKeyPath string, retiredPublicKeyPaths ...string) Authenticator {
+	keys, err := NewKeyRing(privateKeyPath, publicKeyPath, retiredPublicKeyPaths...)
+	if err != nil {
+		log.Fatalf("ERROR: failed to load signing keys - %s", err.Error())
+	}
 
 	return &TokenAuthenticator{
-		repo:       repo,
-		privateKey: privateKey,
-		publicKey:  publicKey,
+		repo:        repo,
+		revocations: revocations,
+		keys:        keys,
+		issuer:      issuer,
 	}
 }
 
-func (auth *TokenAuthenticator) Authenticate(email string, password string, uri string) (string, error) {
-	userId, dbErr := auth.repo.FindEmail(email)
+func (auth *TokenAuthenticator) Authenticate(ctx context.Context, email string, password string, uri string) (string, error) {
+	userId, dbErr := auth.repo.FindEmail(ctx, email)
 	if dbErr != nil {
 		fmt.Printf("ERROR: %s\n", dbErr.Error())
 	}
@@ -47,24 +110,235 @@ func (auth *TokenAuthenticator) Authenticate(email string, password string, uri
 		return "", errors.New("Authentication Failed: Invalid username.")
 	}
 
-	credentials, _ := auth.repo.GetCredentials(userId)
+	credentials, _ := auth.repo.GetCredentials(ctx, userId)
 
 	if credentials.Id == uuid.Nil {
 		return "", errors.New("Authentication Failed: Unable to find user credentials.")
 	}
 
-	if !MatchPassword(password, &PasswordKey{credentials.Salt, credentials.Key}) {
-		return "", errors.New("Authentication Failed: Invalid password.")
+	// A locked out account is refused in the same way as a wrong password,
+	// including the time taken to hash it, so the lockout cannot be detected.
+	now := time.Now()
+	matched, needsRehash := credentials.CheckPassword(password)
+	if credentials.isLockedOut(now) {
+		return "", ErrInvalidPassword
+	}
+
+	if !matched {
+		locked, err := auth.recordLoginFailure(ctx, credentials, now)
+		if err != nil {
+			fmt.Printf("ERROR: %v\n", err.Error())
+		}
+
+		if locked {
+			return "", ErrAccountLocked
+		}
+
+		return "", ErrInvalidPassword
+	}
+
+	// Users with a second factor have only half logged in, so failures are
+	// cleared once CompleteMFA succeeds. Wrong codes then add to the same
+	// count, however many challenges they are spread across.
+	if !credentials.IsTOTPEnabled {
+		var err error
+		credentials, err = auth.resetLoginFailures(ctx, credentials)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	// The plain text password is only available here, so this is where hashes
+	// made with an old algorithm or weaker parameters get upgraded.
+	if needsRehash {
+		auth.rehashPassword(ctx, credentials, password)
+	}
+
+	// Users with a second factor get a challenge token instead, to be
+	// completed with CompleteMFA.
+	var token string
+	var err error
+
+	if credentials.IsTOTPEnabled {
+		token, err = auth.issueMFAChallenge(credentials, []string{AmrPassword})
+	} else {
+		token, err = auth.issueToken(credentials, []string{AmrPassword})
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	// The credentials were read before the password was hashed. A password or
+	// email change saved since then revoked the tokens issued before it, which
+	// may not include this one, so the login fails instead. Checking after the
+	// token is signed means a change saved later revokes it.
+	current, err := auth.repo.GetCredentials(ctx, credentials.Id)
+	if err != nil {
+		return "", err
+	}
+
+	if !current.PasswordChangedDate.Equal(credentials.PasswordChangedDate) || current.Email != credentials.Email {
+		return "", ErrInvalidPassword
+	}
+
+	if credentials.IsTOTPEnabled {
+		return token, ErrMFARequired
+	}
+
+	return token, nil
+}
+
+// rehashPassword replaces the user's hash with one from the default hasher.
+// Failing to save only delays the upgrade until the next login, so it does
+// not fail authentication. It is not retried on a conflict, which might mean
+// the password has just been changed.
+func (auth *TokenAuthenticator) rehashPassword(ctx context.Context, credentials *Credentials, password string) {
+	err := credentials.SetPassword(password)
+	if err == nil {
+		err = auth.repo.SaveCredentials(ctx, credentials.Id, credentials)
+	}
+
+	if err != nil {
+		fmt.Printf("ERROR: unable to rehash password: %v\n", err)
+	}
+}
+
+// IssueRefreshToken starts a new refresh token family for the user and
+// returns the opaque token to hand to the client. Access tokens issued from
+// the family carry the given authentication methods.
+func (auth *TokenAuthenticator) IssueRefreshToken(ctx context.Context, userId uuid.UUID, amr []string) (string, error) {
+	return auth.issueRefreshToken(ctx, userId, uuid.NewV4(), amr)
+}
+
+// RefreshToken exchanges a refresh token for a new access token and a rotated
+// refresh token in the same family. Presenting a refresh token that has
+// already been exchanged revokes the whole family.
+func (auth *TokenAuthenticator) RefreshToken(ctx context.Context, refreshToken string) (string, string, error) {
+	previous, err := auth.repo.ConsumeRefreshToken(ctx, hashOpaqueToken(refreshToken))
+	if err != nil || previous.Id == uuid.Nil {
+		return "", "", ErrInvalidRefreshToken
+	}
+
+	if previous.IsUsed {
+		if err := auth.repo.RevokeRefreshTokenFamily(ctx, previous.FamilyId); err != nil {
+			fmt.Printf("ERROR: %v\n", err.Error())
+		}
+		return "", "", ErrRefreshTokenReused
+	}
+
+	if previous.IsRevoked || time.Now().After(previous.ExpiryDate) {
+		return "", "", ErrInvalidRefreshToken
+	}
+
+	credentials, err := auth.repo.GetCredentials(ctx, previous.UserId)
+	if err != nil || credentials.Id == uuid.Nil {
+		return "", "", ErrInvalidRefreshToken
+	}
+
+	token, err := auth.issueToken(credentials, previous.Amr)
+	if err != nil {
+		return "", "", err
+	}
+
+	nextRefreshToken, err := auth.issueRefreshToken(ctx, previous.UserId, previous.FamilyId, previous.Amr)
+	if err != nil {
+		return "", "", err
+	}
+
+	return token, nextRefreshToken, nil
+}
+
+// RevokeToken rejects a single access token, identified by its jti claim,
+// for the rest of its lifetime. Refresh tokens are revoked along with every
+// other refresh token issued from the same login.
+func (auth *TokenAuthenticator) RevokeToken(ctx context.Context, tokenString string) (err error) {
+	token, err := auth.parseToken(tokenString)
+	if err != nil {
+		refreshToken, err := auth.repo.GetRefreshToken(ctx, hashOpaqueToken(tokenString))
+		if err != nil || refreshToken.Id == uuid.Nil {
+			return ErrInvalidRefreshToken
+		}
+
+		return auth.repo.RevokeRefreshTokenFamily(ctx, refreshToken.FamilyId)
+	}
+
+	jti, _ := token.Claims["jti"].(string)
+	exp, _ := token.Claims["exp"].(float64)
+
+	if jti == "" {
+		return errors.New("token has no jti claim")
+	}
+
+	return auth.revocations.RevokeToken(ctx, jti, time.Unix(int64(exp), 0))
+}
+
+// RevokeUserTokens rejects every access and refresh token issued to the user
+// up to now, including any issued in the current millisecond. It returns
+// once that millisecond has passed, so tokens issued afterwards are valid.
+func (auth *TokenAuthenticator) RevokeUserTokens(ctx context.Context, userId uuid.UUID) (err error) {
+	revokedDate := time.Now().Truncate(time.Millisecond)
+
+	if err = auth.revocations.RevokeUserTokens(ctx, userId, revokedDate); err != nil {
+		return err
+	}
+
+	if err = auth.repo.RevokeUserRefreshTokens(ctx, userId); err != nil {
+		return err
+	}
+
+	time.Sleep(time.Until(revokedDate.Add(time.Millisecond)))
+
+	return nil
+}
+
+// issueToken signs an access token for the user. amr records how the user
+// authenticated.
+func (auth *TokenAuthenticator) issueToken(credentials *Credentials, amr []string) (string, error) {
+	now := time.Now()
+
+	return auth.signToken(map[string]interface{}{
+		"jti":               uuid.NewV4().String(),
+		"iss":               auth.issuer,
+		"sub":               credentials.Id.String(),
+		"id":                credentials.Id.String(),
+		"email":             credentials.Email,
+		"isAccountVerified": credentials.IsEmailVerified,
+		"amr":               amr,
+		"iat":               now.Unix(),
+		"iat_ms":            unixMilli(now),
+		"exp":               now.Add(AccessTokenLifetime).Unix(),
+	})
+}
+
+// unixMilli returns the time in milliseconds since the Unix epoch. Tokens
+// carry it in iat_ms alongside iat, which clients expect in whole seconds.
+func unixMilli(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
+// tokenIssuedDate returns when a token was issued, to the millisecond if it
+// has an iat_ms claim and to the second otherwise.
+func tokenIssuedDate(claims map[string]interface{}) time.Time {
+	if iatMs, ok := claims["iat_ms"].(float64); ok {
+		return time.Unix(0, int64(iatMs)*int64(time.Millisecond))
 	}
 
+	iat, _ := claims["iat"].(float64)
+
+	return time.Unix(int64(iat), 0)
+}
+
+// signToken signs the claims with the active key and tags the token with the
+// key's kid.
+func (auth *TokenAuthenticator) signToken(claims map[string]interface{}) (string, error) {
+	signingKey := auth.keys.ActiveKey()
 	token := jwt.New(jwt.GetSigningMethod("RS256"))
 
-	token.Claims["id"] = userId.String()
-	token.Claims["email"] = email
-	token.Claims["isAccountVerified"] = credentials.IsEmailVerified
-	token.Claims["exp"] = time.Now().Add(time.Hour * 72).Unix()
+	token.Header["kid"] = signingKey.Id
+	token.Claims = claims
 
-	tokenString, err := token.SignedString(auth.privateKey)
+	tokenString, err := token.SignedString(signingKey.privateKey)
 
 	if err != nil {
 		fmt.Printf("ERROR: %v\n", err.Error())
@@ -74,26 +348,110 @@ func (auth *TokenAuthenticator) Authenticate(email string, password string, uri
 	return tokenString, nil
 }
 
-func (auth *TokenAuthenticator) ValidateToken(tokenString string) bool {
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		return auth.publicKey, nil
+func (auth *TokenAuthenticator) issueRefreshToken(ctx context.Context, userId uuid.UUID, familyId uuid.UUID, amr []string) (string, error) {
+	refreshToken, err := generateOpaqueToken(RefreshTokenLength)
+	if err != nil {
+		fmt.Printf("ERROR: %v\n", err.Error())
+		return "", err
+	}
+
+	now := time.Now()
+
+	err = auth.repo.SaveRefreshToken(ctx, &RefreshToken{
+		Id:          uuid.NewV4(),
+		FamilyId:    familyId,
+		UserId:      userId,
+		TokenHash:   hashOpaqueToken(refreshToken),
+		Amr:         amr,
+		CreatedDate: now,
+		ExpiryDate:  now.Add(RefreshTokenLifetime),
 	})
 
-	if err == nil && token.Valid {
-		return true
+	if err != nil {
+		fmt.Printf("ERROR: %v\n", err.Error())
+		return "", err
 	}
 
-	fmt.Printf("ERROR: %v", err)
+	return refreshToken, nil
+}
+
+// generateOpaqueToken returns a random URL-safe token carrying length bytes
+// of entropy.
+func generateOpaqueToken(length int) (string, error) {
+	secret := make([]byte, length)
+	if _, err := io.ReadFull(rand.Reader, secret); err != nil {
+		return "", err
+	}
 
-	return false
+	return base64.URLEncoding.EncodeToString(secret), nil
 }
 
-func (auth *TokenAuthenticator) GetTokenClaim(tokenString string, claim string) (value interface{}, err error) {
+// Only a SHA-256 digest of an opaque token is persisted, so a leaked
+// database does not yield usable tokens.
+func hashOpaqueToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func (auth *TokenAuthenticator) ValidateToken(ctx context.Context, tokenString string) bool {
+	token, err := auth.parseToken(tokenString)
+
+	if err != nil {
+		fmt.Printf("ERROR: %v", err)
+		return false
+	}
+
+	// ID tokens and MFA challenges are signed with the same key but must
+	// never be accepted as bearer tokens.
+	if _, ok := token.Claims["token_use"]; ok {
+		return false
+	}
+
+	jti, _ := token.Claims["jti"].(string)
+	id, _ := token.Claims["id"].(string)
+	userId, _ := uuid.FromString(id)
+
+	revoked, err := auth.revocations.IsRevoked(ctx, jti, userId, tokenIssuedDate(token.Claims))
+	if err != nil {
+		fmt.Printf("ERROR: %v", err)
+		return false
+	}
+
+	return !revoked
+}
+
+func (auth *TokenAuthenticator) parseToken(tokenString string) (*jwt.Token, error) {
 	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		return auth.publicKey, nil
+		// Only accept RSA signatures, otherwise a token signed with HMAC
+		// using the public key as the secret would validate.
+		if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+
+		kid, _ := token.Header["kid"].(string)
+		signingKey := auth.keys.FindKey(kid)
+		if signingKey == nil {
+			return nil, fmt.Errorf("unknown signing key: %s", kid)
+		}
+
+		return signingKey.publicKey, nil
 	})
 
-	if err == nil && token.Valid {
+	if err != nil {
+		return nil, err
+	}
+
+	if !token.Valid {
+		return nil, errors.New("token is invalid")
+	}
+
+	return token, nil
+}
+
+func (auth *TokenAuthenticator) GetTokenClaim(tokenString string, claim string) (value interface{}, err error) {
+	token, err := auth.parseToken(tokenString)
+
+	if err == nil {
 		return token.Claims[claim], nil
 	}
 
@@ -102,6 +460,22 @@ func (auth *TokenAuthenticator) GetTokenClaim(tokenString string, claim string)
 	return nil, err
 }
 
+func (auth *TokenAuthenticator) GetTokenClaims(tokenString string) (claims map[string]interface{}, err error) {
+	token, err := auth.parseToken(tokenString)
+
+	if err == nil {
+		return token.Claims, nil
+	}
+
+	fmt.Printf("ERROR: %v", err)
+
+	return nil, err
+}
+
+func (auth *TokenAuthenticator) GetJSONWebKeySet() *JSONWebKeySet {
+	return auth.keys.JSONWebKeySet()
+}
+
 func readKeyFromFile(path string) (key []byte, err error) {
 	file, err := os.Open(path)
 
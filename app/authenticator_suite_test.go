@@ -26,13 +26,13 @@ func defineFactories() {
 				func(n int) interface{} {
 					return fmt.Sprintf("latherton%d@example.com", n)
 				})
-			factory["Password"] = "secret"
+			factory["Password"] = "correct horse battery"
 		})
 
 	gory.Define("userRegistrationDuplicate", UserRegistrationView{},
 		func(factory gory.Factory) {
 			factory["Email"] = "latherton@example.com"
-			factory["Password"] = "secret"
+			factory["Password"] = "correct horse battery"
 		})
 
 	gory.Define("userRegistrationDupEmail", UserRegistrationView{},
@@ -41,35 +41,35 @@ func defineFactories() {
 				func(n int) interface{} {
 					return fmt.Sprintf("latherton@example.com")
 				})
-			factory["Password"] = "secretpassword"
+			factory["Password"] = "secret horse battery staple"
 		})
 
 	gory.Define("userRegistrationMissingEmail", UserRegistrationView{},
 		func(factory gory.Factory) {
-			factory["Password"] = "secretpassword"
+			factory["Password"] = "secret horse battery staple"
 		})
 
 	gory.Define("loginValid", LoginView{},
 		func(factory gory.Factory) {
 			factory["Email"] = "latherton@example.com"
-			factory["Password"] = "secret"
+			factory["Password"] = "correct horse battery"
 		})
 
 	gory.Define("passwordChangeRequest", ChangePasswordView{},
 		func(factory gory.Factory) {
-			factory["OldPassword"] = "secret"
-			factory["NewPassword"] = "new secret"
+			factory["OldPassword"] = "correct horse battery"
+			factory["NewPassword"] = "new horse battery staple"
 		})
 
 	gory.Define("passwordChangeRequestWrongPassword", ChangePasswordView{},
 		func(factory gory.Factory) {
 			factory["OldPassword"] = "wrong"
-			factory["NewPassword"] = "new secret"
+			factory["NewPassword"] = "new horse battery staple"
 		})
 
 	gory.Define("passwordChangeRequestMissingInfo", ChangePasswordView{},
 		func(factory gory.Factory) {
-			factory["OldPassword"] = "secret"
+			factory["OldPassword"] = "correct horse battery"
 		})
 
 }
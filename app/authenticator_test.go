@@ -3,17 +3,35 @@
 package authenticator_test
 
 import (
+	"context"
 	. "github.com/lukeatherton/authenticator/app"
 	"github.com/satori/go.uuid"
 
 	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
 	"encoding/json"
+	"encoding/pem"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
 
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"strings"
 
+	"github.com/fxamacker/cbor/v2"
 	"github.com/gin-gonic/gin"
 	"github.com/modocache/gory"
 	. "github.com/onsi/ginkgo"
@@ -49,35 +67,49 @@ func (publisher *TestPublisher) PublishMessage(message DomainEvent) (err error)
 	return nil
 }
 
+/*
+Generate a throwaway RSA key pair and return the paths of its PEM files.
+*/
+func writeTestKeyPair() (privateKeyPath string, publicKeyPath string) {
+	privateKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	publicKeyBytes, _ := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+
+	dir, _ := ioutil.TempDir("", "authenticator")
+	privateKeyPath = filepath.Join(dir, "key.pem")
+	publicKeyPath = filepath.Join(dir, "key.pub")
+
+	ioutil.WriteFile(privateKeyPath, pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(privateKey)}), 0600)
+	ioutil.WriteFile(publicKeyPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKeyBytes}), 0644)
+
+	return privateKeyPath, publicKeyPath
+}
+
 /*
 Server unit tests.
 */
 var _ = Describe("Auth Server", func() {
-	var repo Repo
+	var repo TestRepo
 	var server *gin.Engine
 	var request *http.Request
 	var recorder *httptest.ResponseRecorder
 
 	var testPublisher *TestPublisher
 	var testAuth Authenticator
-	hostString := []string{}
-	hostString = append(hostString, "127.0.0.1")
-	//dbHosts []string, authDb string, dbUsername string, dbPassword string
-	repo = NewMongoTestRepo(hostString, "admin", "", "")
+	repo = newTestRepo()
 
 	BeforeEach(func() {
-		// Set up a new server, connected to a test database,
+		// Set up a new server, connected to a test repo,
 		// before each test.
 		testPublisher = &TestPublisher{}
-		testAuth = BuildAuthenticator(repo, "../crypto/testKey.pem", "../crypto/testKey.pub")
-		server = NewRouter(testPublisher, repo, testAuth)
+		testAuth = BuildAuthenticator(repo, NewMemoryRevocationStore(), "https://auth.example.com", "../crypto/testKey.pem", "../crypto/testKey.pub")
+		server = NewRouter(testPublisher, repo, testAuth, NewMemoryRateLimitStore())
 
 		// Record HTTP responses.
 		recorder = httptest.NewRecorder()
 	})
 
 	AfterEach(func() {
-		// Clear the database after each test.
+		// Clear the repo after each test.
 		//session.DB(dbName).DropDatabase()
 		repo.Cleanup()
 	})
@@ -99,298 +131,2672 @@ var _ = Describe("Auth Server", func() {
 		})
 	})
 
-	Describe("GET /emails?email=latherton@example.com", func() {
-
-		var credentials *Credentials
+	Describe("GET /.well-known/jwks.json", func() {
 
-		// Set up a new GET request before every test
-		// in this describe block.
 		BeforeEach(func() {
-			request, _ = http.NewRequest("GET", "/api/emails?email=latherton@example.com", nil)
+			request, _ = http.NewRequest("GET", "/.well-known/jwks.json", nil)
 		})
 
-		Context("when no users exist", func() {
+		It("returns a status code of 200", func() {
+			server.ServeHTTP(recorder, request)
+			fmt.Printf("%v\n", recorder)
+			Expect(recorder.Code).To(Equal(200))
+		})
 
-			It("returns a status code of 200", func() {
-				server.ServeHTTP(recorder, request)
-				fmt.Printf("%v\n", recorder)
-				Expect(recorder.Code).To(Equal(200))
-			})
+		It("publishes the key used to sign tokens", func() {
+			server.ServeHTTP(recorder, request)
+			fmt.Printf("%v\n", recorder)
 
-			/*It("returns a empty body", func() {
-				server.ServeHTTP(recorder, request)
-				fmt.Printf("%v\n", recorder)
-				Expect(recorder.Body.String()).To(Equal("[]"))
-				//Expect(recorder.Body.String()).To(Equal(`"Email-Available"`))
-			})*/
+			var keySet JSONWebKeySet
+			json.Unmarshal(recorder.Body.Bytes(), &keySet)
+
+			Expect(keySet.Keys).To(HaveLen(1))
+			Expect(keySet.Keys[0].Kty).To(Equal("RSA"))
+			Expect(keySet.Keys[0].Kid).To(Equal(testAuth.GetJSONWebKeySet().Keys[0].Kid))
 		})
 
-		Context("when email in use", func() {
+		Context("after rotating the signing key", func() {
+			var credentials *Credentials
+			var rotatedAuth Authenticator
+			var token string
 
-			// Insert a valid company uri
-			// before each test in this context.
 			BeforeEach(func() {
 				regView := gory.Build("userRegistrationDuplicate").(*UserRegistrationView)
 				credentials, _ = DecodeRegistrationDetails(regView)
 				credentials.Id = uuid.NewV4()
 
-				repo.SaveCredentials(credentials.Id, credentials)
+				repo.SaveCredentials(context.Background(), credentials.Id, credentials)
+
+				token, _ = testAuth.Authenticate(context.Background(), regView.Email, regView.Password, "")
+
+				privateKeyPath, publicKeyPath := writeTestKeyPair()
+				rotatedAuth = BuildAuthenticator(repo, NewMemoryRevocationStore(), "https://auth.example.com", privateKeyPath, publicKeyPath, "../crypto/testKey.pub")
+				server = NewRouter(testPublisher, repo, rotatedAuth, NewMemoryRateLimitStore())
 			})
 
-			It("returns a status code of 302", func() {
+			It("publishes both keys", func() {
 				server.ServeHTTP(recorder, request)
 				fmt.Printf("%v\n", recorder)
-				Expect(recorder.Code).To(Equal(302))
+
+				var keySet JSONWebKeySet
+				json.Unmarshal(recorder.Body.Bytes(), &keySet)
+
+				Expect(keySet.Keys).To(HaveLen(2))
 			})
 
-			/*It("returns the user info", func() {
-				server.ServeHTTP(recorder, request)
-				fmt.Printf("%v\n", recorder)
+			It("still validates tokens signed with the retired key", func() {
+				Expect(rotatedAuth.ValidateToken(context.Background(), token)).To(Equal(true))
+			})
 
-				responseJSON := mapFromJSON(recorder.Body.Bytes())
-				Expect(responseJSON["user_id"]).ToNot(Equal(""))
-			})*/
+			It("signs new tokens with the new key", func() {
+				newToken, _ := rotatedAuth.Authenticate(context.Background(), credentials.Email, "correct horse battery", "")
 
+				Expect(rotatedAuth.ValidateToken(context.Background(), newToken)).To(Equal(true))
+				Expect(testAuth.ValidateToken(context.Background(), newToken)).To(Equal(false))
+			})
 		})
 	})
 
-	Describe("GET /verification?email=latherton@example.com&code=", func() {
+	Describe("GET /.well-known/openid-configuration", func() {
+
+		BeforeEach(func() {
+			request, _ = http.NewRequest("GET", "/.well-known/openid-configuration", nil)
+		})
+
+		It("returns the issuer and endpoints", func() {
+			server.ServeHTTP(recorder, request)
+			fmt.Printf("%v\n", recorder)
+
+			responseJSON := mapFromJSON(recorder.Body.Bytes())
+
+			Expect(recorder.Code).To(Equal(200))
+			Expect(responseJSON["issuer"]).To(Equal("https://auth.example.com"))
+			Expect(responseJSON["jwks_uri"]).To(Equal("https://auth.example.com/.well-known/jwks.json"))
+			Expect(responseJSON["userinfo_endpoint"]).To(Equal("https://auth.example.com/userinfo"))
+		})
+	})
 
+	Describe("GET /userinfo", func() {
 		var credentials *Credentials
 
-		Context("when no users exist", func() {
+		BeforeEach(func() {
+			regView := gory.Build("userRegistrationDuplicate").(*UserRegistrationView)
+			credentials, _ = DecodeRegistrationDetails(regView)
+			credentials.Id = uuid.NewV4()
+			credentials.IsEmailVerified = true
 
-			// Set up a new GET request before every test
-			// in this describe block.
-			BeforeEach(func() {
-				request, _ = http.NewRequest("GET", "/api/verification?email=latherton@example.com&code=123", nil)
-			})
+			repo.SaveCredentials(context.Background(), credentials.Id, credentials)
 
-			It("returns a status code of 400", func() {
-				server.ServeHTTP(recorder, request)
-				fmt.Printf("%v\n", recorder)
-				Expect(recorder.Code).To(Equal(400))
-			})
+			request, _ = http.NewRequest("GET", "/userinfo", nil)
+		})
 
-			/*It("returns a empty body", func() {
+		Context("without a token", func() {
+
+			It("returns a status code of 401", func() {
 				server.ServeHTTP(recorder, request)
 				fmt.Printf("%v\n", recorder)
-				Expect(recorder.Body.String()).To(Equal("[]"))
-				//Expect(recorder.Body.String()).To(Equal(`"Email-Available"`))
-			})*/
+				Expect(recorder.Code).To(Equal(401))
+			})
 		})
 
-		Context("when user not yet verified", func() {
+		Context("with a valid token", func() {
 
-			// Insert a valid company uri
-			// before each test in this context.
 			BeforeEach(func() {
-				regView := gory.Build("userRegistrationDuplicate").(*UserRegistrationView)
-				credentials, _ = DecodeRegistrationDetails(regView)
-				credentials.Id = uuid.NewV4()
-				credentials.EmailVerificationCode = uuid.NewV4().String()
-
-				repo.SaveCredentials(credentials.Id, credentials)
-
-				request, _ = http.NewRequest("GET", fmt.Sprintf("/api/verification?email=%s&code=%s", credentials.Email, credentials.EmailVerificationCode), nil)
+				token, _ := testAuth.Authenticate(context.Background(), credentials.Email, "correct horse battery", "")
+				request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
 			})
 
-			It("returns a status code of 200", func() {
+			It("returns the user claims", func() {
 				server.ServeHTTP(recorder, request)
 				fmt.Printf("%v\n", recorder)
+
+				responseJSON := mapFromJSON(recorder.Body.Bytes())
+
 				Expect(recorder.Code).To(Equal(200))
+				Expect(responseJSON["sub"]).To(Equal(credentials.Id.String()))
+				Expect(responseJSON["email"]).To(Equal(credentials.Email))
+				Expect(responseJSON["email_verified"]).To(Equal(true))
 			})
+		})
 
-			It("updates repo", func() {
+		Context("with a revoked token", func() {
+
+			BeforeEach(func() {
+				token, _ := testAuth.Authenticate(context.Background(), credentials.Email, "correct horse battery", "")
+				testAuth.RevokeToken(context.Background(), token)
+				request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+			})
+
+			It("returns a status code of 401", func() {
 				server.ServeHTTP(recorder, request)
 				fmt.Printf("%v\n", recorder)
+				Expect(recorder.Code).To(Equal(401))
+			})
 
-				savedCredentials, _ := repo.GetCredentials(credentials.Id)
+			It("does not run the handler", func() {
+				handled := false
 
-				Expect(savedCredentials.IsEmailVerified).To(BeTrue())
+				router := gin.New()
+				router.GET("/userinfo", Authorization(testAuth), func(c *gin.Context) {
+					handled = true
+				})
+
+				router.ServeHTTP(recorder, request)
+				Expect(recorder.Code).To(Equal(401))
+				Expect(handled).To(BeFalse())
 			})
+		})
 
-			/*It("returns the user info", func() {
-				server.ServeHTTP(recorder, request)
-				fmt.Printf("%v\n", recorder)
+		Context("with an ID token", func() {
 
-				responseJSON := mapFromJSON(recorder.Body.Bytes())
-				Expect(responseJSON["user_id"]).ToNot(Equal(""))
-			})*/
+			BeforeEach(func() {
+				idToken, _ := testAuth.IssueIdToken(context.Background(), credentials.Id, "client", "", time.Now())
+				request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", idToken))
+			})
 
+			It("returns a status code of 401", func() {
+				server.ServeHTTP(recorder, request)
+				fmt.Printf("%v\n", recorder)
+				Expect(recorder.Code).To(Equal(401))
+			})
 		})
 	})
 
-	Describe("POST /registrations", func() {
+	Describe("OAuth authorization code flow", func() {
+		var credentials *Credentials
+		var authorizeQuery url.Values
 
-		Context("with invalid JSON", func() {
+		codeVerifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+		codeChallenge := "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
 
-			// Create a POST request using JSON from our invalid
-			// factory object before each test in this context.
-			BeforeEach(func() {
-				body, _ := json.Marshal(
-					gory.Build("userRegistrationMissingEmail"))
-				request, _ = http.NewRequest(
-					"POST", "/api/registrations", bytes.NewReader(body))
-				request.Header.Set("content-type", "application/json")
+		BeforeEach(func() {
+			regView := gory.Build("userRegistrationDuplicate").(*UserRegistrationView)
+			credentials, _ = DecodeRegistrationDetails(regView)
+			credentials.Id = uuid.NewV4()
+
+			repo.SaveCredentials(context.Background(), credentials.Id, credentials)
+
+			repo.SaveClient(context.Background(), &Client{
+				ClientId:     "webapp",
+				Name:         "Web App",
+				RedirectUris: []string{"https://app.example.com/callback"},
 			})
 
+			authorizeQuery = url.Values{
+				"response_type":         {"code"},
+				"client_id":             {"webapp"},
+				"redirect_uri":          {"https://app.example.com/callback"},
+				"scope":                 {"openid email"},
+				"state":                 {"xyz"},
+				"nonce":                 {"abc"},
+				"code_challenge":        {codeChallenge},
+				"code_challenge_method": {"S256"},
+			}
+		})
+
+		authorize := func(email string, password string) *httptest.ResponseRecorder {
+			form := url.Values{}
+			for key := range authorizeQuery {
+				form.Set(key, authorizeQuery.Get(key))
+			}
+			form.Set("email", email)
+			form.Set("password", password)
+
+			request, _ := http.NewRequest("POST", "/authorize", strings.NewReader(form.Encode()))
+			request.Header.Set("content-type", "application/x-www-form-urlencoded")
+
+			response := httptest.NewRecorder()
+			server.ServeHTTP(response, request)
+			return response
+		}
+
+		exchange := func(code string, verifier string) *httptest.ResponseRecorder {
+			form := url.Values{
+				"grant_type":    {"authorization_code"},
+				"code":          {code},
+				"client_id":     {"webapp"},
+				"redirect_uri":  {"https://app.example.com/callback"},
+				"code_verifier": {verifier},
+			}
+
+			request, _ := http.NewRequest("POST", "/token", strings.NewReader(form.Encode()))
+			request.Header.Set("content-type", "application/x-www-form-urlencoded")
+
+			response := httptest.NewRecorder()
+			server.ServeHTTP(response, request)
+			return response
+		}
+
+		Context("GET /authorize with an unknown client", func() {
+
 			It("returns a status code of 400", func() {
+				authorizeQuery.Set("client_id", "unknown")
+				request, _ = http.NewRequest("GET", "/authorize?"+authorizeQuery.Encode(), nil)
+
 				server.ServeHTTP(recorder, request)
 				fmt.Printf("%v\n", recorder)
 				Expect(recorder.Code).To(Equal(400))
 			})
 		})
 
-		Context("with valid JSON", func() {
+		Context("GET /authorize with an unregistered redirect uri", func() {
 
-			// Create a POST request with valid JSON from
-			// our factory before each test in this context.
-			BeforeEach(func() {
-				body, _ := json.Marshal(
-					gory.Build("userRegistration"))
-				request, _ = http.NewRequest(
-					"POST", "/api/registrations", bytes.NewReader(body))
-				request.Header.Set("content-type", "application/json")
-			})
+			It("returns a status code of 400 without redirecting", func() {
+				authorizeQuery.Set("redirect_uri", "https://evil.example.com/callback")
+				request, _ = http.NewRequest("GET", "/authorize?"+authorizeQuery.Encode(), nil)
 
-			It("returns a status code of 201", func() {
 				server.ServeHTTP(recorder, request)
 				fmt.Printf("%v\n", recorder)
-				Expect(recorder.Code).To(Equal(201))
+				Expect(recorder.Code).To(Equal(400))
+				Expect(recorder.Header().Get("Location")).To(BeEmpty())
 			})
+		})
+
+		Context("GET /authorize without a code challenge", func() {
+
+			It("redirects back with an error", func() {
+				authorizeQuery.Del("code_challenge")
+				request, _ = http.NewRequest("GET", "/authorize?"+authorizeQuery.Encode(), nil)
 
-			It("publishes user registered events", func() {
 				server.ServeHTTP(recorder, request)
 				fmt.Printf("%v\n", recorder)
 
-				Eventually(func() []DomainEvent {
-					return testPublisher.messages
-				}).Should(HaveLen(2))
-
-				for _, m := range testPublisher.messages {
-					switch m.GetMessageType() {
-					case "User.Registered":
-						var message UserRegistered
-						message, _ = m.(UserRegistered)
-						Expect(message.Email == "latherton0@example.com")
+				location, _ := url.Parse(recorder.Header().Get("Location"))
+				Expect(recorder.Code).To(Equal(302))
+				Expect(location.Query().Get("error")).To(Equal("invalid_request"))
+				Expect(location.Query().Get("state")).To(Equal("xyz"))
+			})
+		})
 
-					case "Email.Verification.Pending":
-						var message EmailVerificationPending
-						message, _ = m.(EmailVerificationPending)
-						Expect(message.Email == "latherton0@example.com")
-					}
-				}
+		Context("GET /authorize with a valid request", func() {
 
-			})
+			It("shows the login page", func() {
+				request, _ = http.NewRequest("GET", "/authorize?"+authorizeQuery.Encode(), nil)
 
-			It("returns the user info", func() {
 				server.ServeHTTP(recorder, request)
 				fmt.Printf("%v\n", recorder)
+				Expect(recorder.Code).To(Equal(200))
+				Expect(recorder.Body.String()).To(ContainSubstring(codeChallenge))
+			})
+		})
 
-				responseJSON := mapFromJSON(recorder.Body.Bytes())
-
-				token := strings.Replace(responseJSON["token"].(string), "\"", "", -1)
-				token = strings.Trim(token, "\r\n")
+		Context("POST /authorize with an invalid password", func() {
 
-				Expect(testAuth.ValidateToken(token)).To(Equal(true))
+			It("returns a status code of 401", func() {
+				response := authorize(credentials.Email, "wrong")
+				Expect(response.Code).To(Equal(401))
+			})
+		})
 
-				// token := strings.Replace(recorder.Body.String(), "\"", "", -1)
-				// token = strings.Trim(token, "\r\n")
+		Context("POST /authorize with valid credentials", func() {
 
-				// Expect(testAuth.ValidateToken(token)).To(Equal(true))
+			It("redirects back with a code and the state", func() {
+				response := authorize(credentials.Email, "correct horse battery")
 
-				// responseArray := strings.Split(recorder.Body.String(), ".")
-				// fmt.Printf("TOKEN: %s\n", responseArray[1])
+				location, _ := url.Parse(response.Header().Get("Location"))
+				Expect(response.Code).To(Equal(302))
+				Expect(location.Host).To(Equal("app.example.com"))
+				Expect(location.Query().Get("code")).ToNot(BeEmpty())
+				Expect(location.Query().Get("state")).To(Equal("xyz"))
+			})
+		})
 
-				// userInfo := responseArray[1]
+		Context("POST /token with a valid code and verifier", func() {
 
-				// //this fixes an issue decoding part of the token
-				// if l := len(userInfo) % 4; l > 0 {
-				// 	userInfo += strings.Repeat("=", 4-l)
-				// }
+			It("returns an access token and an ID token", func() {
+				location, _ := url.Parse(authorize(credentials.Email, "correct horse battery").Header().Get("Location"))
+				response := exchange(location.Query().Get("code"), codeVerifier)
 
-				// response, err := base64.URLEncoding.DecodeString(userInfo)
-				// if err != nil {
-				// 	panic(err)
-				// 	return
-				// }
+				responseJSON := mapFromJSON(response.Body.Bytes())
 
-				// responseJSON := mapFromJSON(response)
-				Expect(responseJSON["id"]).ToNot(Equal(""))
+				Expect(response.Code).To(Equal(200))
+				Expect(responseJSON["token_type"]).To(Equal("Bearer"))
+				Expect(testAuth.ValidateToken(context.Background(), responseJSON["access_token"].(string))).To(Equal(true))
+				Expect(responseJSON["refresh_token"]).ToNot(BeEmpty())
+				Expect(testAuth.GetTokenClaim(responseJSON["id_token"].(string), "nonce")).To(Equal("abc"))
+				Expect(testAuth.GetTokenClaim(responseJSON["id_token"].(string), "aud")).To(Equal("webapp"))
 			})
 
-			// Measure("new users should be created in under 500ms", func(b Benchmarker) {
-			// 	runtime := b.Time("runtime", func() {
-			// 		server.ServeHTTP(recorder, request)
-			// 		Expect(recorder.Code).To(Equal(201))
-			// 	})
+			It("only accepts the code once", func() {
+				location, _ := url.Parse(authorize(credentials.Email, "correct horse battery").Header().Get("Location"))
+				exchange(location.Query().Get("code"), codeVerifier)
+				response := exchange(location.Query().Get("code"), codeVerifier)
 
-			// 	Ω(runtime.Seconds()).Should(BeNumerically("<", 0.5), "creating users shouldn't take longer than 500ms.")
+				responseJSON := mapFromJSON(response.Body.Bytes())
 
-			// 	//b.RecordValue("disk usage (in MB)", HowMuchDiskSpaceDidYouUse())
-			// }, 10)
+				Expect(response.Code).To(Equal(400))
+				Expect(responseJSON["error"]).To(Equal("invalid_grant"))
+			})
 		})
 
-		Context("with JSON containing a duplicate email", func() {
-
-			var credentials *Credentials
-
-			BeforeEach(func() {
-				regView := gory.Build("userRegistrationDuplicate").(*UserRegistrationView)
-				credentials, _ = DecodeRegistrationDetails(regView)
-				credentials.Id = uuid.NewV4()
+		Context("POST /token with the wrong verifier", func() {
 
-				repo.SaveCredentials(credentials.Id, credentials)
+			It("returns an invalid_grant error", func() {
+				location, _ := url.Parse(authorize(credentials.Email, "correct horse battery").Header().Get("Location"))
+				response := exchange(location.Query().Get("code"), "wrong-verifier-wrong-verifier-wrong-verifier")
 
-				body, _ := json.Marshal(
-					gory.Build("userRegistrationDupEmail"))
-				request, _ = http.NewRequest(
-					"POST", "/api/registrations", bytes.NewReader(body))
-				request.Header.Set("content-type", "application/json")
-			})
+				responseJSON := mapFromJSON(response.Body.Bytes())
 
-			It("returns a status code of 400", func() {
-				server.ServeHTTP(recorder, request)
-				fmt.Printf("%v\n", recorder)
-				Expect(recorder.Code).To(Equal(400))
+				Expect(response.Code).To(Equal(400))
+				Expect(responseJSON["error"]).To(Equal("invalid_grant"))
 			})
 		})
 	})
 
-	Describe("POST /auth", func() {
+	Describe("POST /token with grant_type=client_credentials", func() {
 
-		Context("with invalid JSON", func() {
+		BeforeEach(func() {
+			client := &Client{
+				ClientId: "billing-service",
+				Name:     "Billing Service",
+				Scopes:   []string{"users:read", "users:write"},
+			}
+			client.SetSecret("s3cret")
+
+			repo.SaveClient(context.Background(), client)
+		})
 
-			// Create a POST request using JSON from our invalid
-			// factory object before each test in this context.
-			BeforeEach(func() {
-				body, _ := json.Marshal(
-					gory.Build("loginValid"))
-				request, _ = http.NewRequest(
-					"POST", "/api/auth", bytes.NewReader(body))
-				request.Header.Set("content-type", "application/json")
-			})
+		requestToken := func(clientId string, clientSecret string, scope string) {
+			form := url.Values{"grant_type": {"client_credentials"}, "scope": {scope}}
 
-			It("returns a status code of 401", func() {
-				server.ServeHTTP(recorder, request)
-				fmt.Printf("%v\n", recorder)
-				Expect(recorder.Code).To(Equal(401))
-			})
-		})
+			request, _ = http.NewRequest("POST", "/token", strings.NewReader(form.Encode()))
+			request.Header.Set("content-type", "application/x-www-form-urlencoded")
+			request.SetBasicAuth(clientId, clientSecret)
 
-		Context("with existing user JSON", func() {
-			var credentials *Credentials
+			server.ServeHTTP(recorder, request)
+			fmt.Printf("%v\n", recorder)
+		}
 
-			// Create a POST request with valid JSON from
-			// our factory before each test in this context.
-			BeforeEach(func() {
-				regView := gory.Build("userRegistrationDuplicate").(*UserRegistrationView)
+		Context("with valid client credentials", func() {
+
+			It("returns a token carrying the client id and granted scopes", func() {
+				requestToken("billing-service", "s3cret", "users:read")
+
+				responseJSON := mapFromJSON(recorder.Body.Bytes())
+				token := responseJSON["access_token"].(string)
+
+				Expect(recorder.Code).To(Equal(200))
+				Expect(responseJSON["scope"]).To(Equal("users:read"))
+				Expect(testAuth.ValidateToken(context.Background(), token)).To(Equal(true))
+				Expect(testAuth.GetTokenClaim(token, "client_id")).To(Equal("billing-service"))
+				Expect(testAuth.GetTokenClaim(token, "scope")).To(Equal("users:read"))
+				Expect(testAuth.GetTokenClaim(token, "id")).To(BeNil())
+				Expect(testAuth.GetTokenClaim(token, "email")).To(BeNil())
+			})
+
+			It("cannot be used on user endpoints", func() {
+				requestToken("billing-service", "s3cret", "")
+
+				responseJSON := mapFromJSON(recorder.Body.Bytes())
+
+				request, _ = http.NewRequest("GET", "/userinfo", nil)
+				request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", responseJSON["access_token"]))
+
+				response := httptest.NewRecorder()
+				server.ServeHTTP(response, request)
+				Expect(response.Code).To(Equal(401))
+			})
+		})
+
+		Context("with the wrong secret", func() {
+
+			It("returns a status code of 401", func() {
+				requestToken("billing-service", "wrong", "")
+
+				responseJSON := mapFromJSON(recorder.Body.Bytes())
+
+				Expect(recorder.Code).To(Equal(401))
+				Expect(responseJSON["error"]).To(Equal("invalid_client"))
+			})
+		})
+
+		Context("with a scope the client is not allowed", func() {
+
+			It("returns an invalid_scope error", func() {
+				requestToken("billing-service", "s3cret", "users:delete")
+
+				responseJSON := mapFromJSON(recorder.Body.Bytes())
+
+				Expect(recorder.Code).To(Equal(400))
+				Expect(responseJSON["error"]).To(Equal("invalid_scope"))
+			})
+		})
+	})
+
+	Describe("POST /tokens/introspect", func() {
+		var credentials *Credentials
+		var token string
+
+		BeforeEach(func() {
+			client := &Client{ClientId: "resource-server", Name: "Resource Server"}
+			client.SetSecret("s3cret")
+
+			repo.SaveClient(context.Background(), client)
+
+			regView := gory.Build("userRegistrationDuplicate").(*UserRegistrationView)
+			credentials, _ = DecodeRegistrationDetails(regView)
+			credentials.Id = uuid.NewV4()
+
+			repo.SaveCredentials(context.Background(), credentials.Id, credentials)
+
+			token, _ = testAuth.Authenticate(context.Background(), credentials.Email, "correct horse battery", "")
+		})
+
+		introspect := func(clientSecret string, token string) {
+			form := url.Values{"token": {token}}
+
+			request, _ = http.NewRequest("POST", "/api/tokens/introspect", strings.NewReader(form.Encode()))
+			request.Header.Set("content-type", "application/x-www-form-urlencoded")
+			request.SetBasicAuth("resource-server", clientSecret)
+
+			server.ServeHTTP(recorder, request)
+			fmt.Printf("%v\n", recorder)
+		}
+
+		Context("without client authentication", func() {
+
+			It("returns a status code of 401", func() {
+				introspect("wrong", token)
+				Expect(recorder.Code).To(Equal(401))
+			})
+		})
+
+		Context("with an active token", func() {
+
+			It("returns the token claims", func() {
+				introspect("s3cret", token)
+
+				responseJSON := mapFromJSON(recorder.Body.Bytes())
+
+				Expect(recorder.Code).To(Equal(200))
+				Expect(responseJSON["active"]).To(Equal(true))
+				Expect(responseJSON["sub"]).To(Equal(credentials.Id.String()))
+				Expect(responseJSON["email"]).To(Equal(credentials.Email))
+				Expect(responseJSON["jti"]).ToNot(BeEmpty())
+			})
+		})
+
+		Context("with a revoked token", func() {
+
+			It("reports the token as inactive", func() {
+				testAuth.RevokeToken(context.Background(), token)
+				introspect("s3cret", token)
+
+				responseJSON := mapFromJSON(recorder.Body.Bytes())
+
+				Expect(recorder.Code).To(Equal(200))
+				Expect(responseJSON).To(Equal(map[string]interface{}{"active": false}))
+			})
+		})
+
+		Context("with garbage", func() {
+
+			It("reports the token as inactive", func() {
+				introspect("s3cret", "not-a-token")
+
+				responseJSON := mapFromJSON(recorder.Body.Bytes())
+				Expect(responseJSON["active"]).To(Equal(false))
+			})
+		})
+	})
+
+	Describe("GET /emails?email=latherton@example.com", func() {
+
+		var credentials *Credentials
+
+		// Set up a new GET request before every test
+		// in this describe block.
+		BeforeEach(func() {
+			request, _ = http.NewRequest("GET", "/api/emails?email=latherton@example.com", nil)
+		})
+
+		Context("when no users exist", func() {
+
+			It("returns a status code of 200", func() {
+				server.ServeHTTP(recorder, request)
+				fmt.Printf("%v\n", recorder)
+				Expect(recorder.Code).To(Equal(200))
+			})
+
+			/*It("returns a empty body", func() {
+				server.ServeHTTP(recorder, request)
+				fmt.Printf("%v\n", recorder)
+				Expect(recorder.Body.String()).To(Equal("[]"))
+				//Expect(recorder.Body.String()).To(Equal(`"Email-Available"`))
+			})*/
+		})
+
+		Context("when email in use", func() {
+
+			// Insert a valid company uri
+			// before each test in this context.
+			BeforeEach(func() {
+				regView := gory.Build("userRegistrationDuplicate").(*UserRegistrationView)
 				credentials, _ = DecodeRegistrationDetails(regView)
 				credentials.Id = uuid.NewV4()
-				credentials.IsEmailVerified = true
 
-				repo.SaveCredentials(credentials.Id, credentials)
+				repo.SaveCredentials(context.Background(), credentials.Id, credentials)
+			})
+
+			It("returns a status code of 302", func() {
+				server.ServeHTTP(recorder, request)
+				fmt.Printf("%v\n", recorder)
+				Expect(recorder.Code).To(Equal(302))
+			})
+
+			/*It("returns the user info", func() {
+				server.ServeHTTP(recorder, request)
+				fmt.Printf("%v\n", recorder)
+
+				responseJSON := mapFromJSON(recorder.Body.Bytes())
+				Expect(responseJSON["user_id"]).ToNot(Equal(""))
+			})*/
+
+		})
+
+		Context("when the request deadline has passed", func() {
+			var timeout time.Duration
+
+			BeforeEach(func() {
+				timeout = RequestTimeout
+				RequestTimeout = -time.Second
+				server = NewRouter(testPublisher, repo, testAuth, NewMemoryRateLimitStore())
+			})
+
+			AfterEach(func() {
+				RequestTimeout = timeout
+			})
+
+			It("returns a status code of 500 without looking up the email", func() {
+				server.ServeHTTP(recorder, request)
+				Expect(recorder.Code).To(Equal(500))
+				Expect(recorder.Body.String()).To(ContainSubstring(context.DeadlineExceeded.Error()))
+			})
+		})
+	})
+
+	Describe("GET /verification?email=latherton@example.com&code=", func() {
+
+		var credentials *Credentials
+
+		Context("when no users exist", func() {
+
+			// Set up a new GET request before every test
+			// in this describe block.
+			BeforeEach(func() {
+				request, _ = http.NewRequest("GET", "/api/verification?email=latherton@example.com&code=123", nil)
+			})
+
+			It("returns a status code of 400", func() {
+				server.ServeHTTP(recorder, request)
+				fmt.Printf("%v\n", recorder)
+				Expect(recorder.Code).To(Equal(400))
+			})
+
+			/*It("returns a empty body", func() {
+				server.ServeHTTP(recorder, request)
+				fmt.Printf("%v\n", recorder)
+				Expect(recorder.Body.String()).To(Equal("[]"))
+				//Expect(recorder.Body.String()).To(Equal(`"Email-Available"`))
+			})*/
+		})
+
+		Context("when user not yet verified", func() {
+
+			// Insert a valid company uri
+			// before each test in this context.
+			BeforeEach(func() {
+				regView := gory.Build("userRegistrationDuplicate").(*UserRegistrationView)
+				credentials, _ = DecodeRegistrationDetails(regView)
+				credentials.Id = uuid.NewV4()
+				code, _ := credentials.IssueEmailVerificationCode()
+
+				repo.SaveCredentials(context.Background(), credentials.Id, credentials)
+
+				request, _ = http.NewRequest("GET", fmt.Sprintf("/api/verification?email=%s&code=%s", credentials.Email, code), nil)
+			})
+
+			It("returns a status code of 200", func() {
+				server.ServeHTTP(recorder, request)
+				fmt.Printf("%v\n", recorder)
+				Expect(recorder.Code).To(Equal(200))
+			})
+
+			It("updates repo", func() {
+				server.ServeHTTP(recorder, request)
+				fmt.Printf("%v\n", recorder)
+
+				savedCredentials, _ := repo.GetCredentials(context.Background(), credentials.Id)
+
+				Expect(savedCredentials.IsEmailVerified).To(BeTrue())
+				Expect(savedCredentials.ConfirmedDate).ToNot(BeZero())
+			})
+
+			It("only accepts the code once", func() {
+				server.ServeHTTP(recorder, request)
+
+				savedCredentials, _ := repo.GetCredentials(context.Background(), credentials.Id)
+				Expect(savedCredentials.VerificationCodeHash).To(BeEmpty())
+			})
+		})
+
+		Context("with a code mailed before codes were hashed", func() {
+
+			BeforeEach(func() {
+				regView := gory.Build("userRegistrationDuplicate").(*UserRegistrationView)
+				credentials, _ = DecodeRegistrationDetails(regView)
+				credentials.Id = uuid.NewV4()
+				credentials.LegacyVerification = "legacy-code"
+
+				repo.SaveCredentials(context.Background(), credentials.Id, credentials)
+
+				request, _ = http.NewRequest("GET", fmt.Sprintf("/api/verification?email=%s&code=legacy-code", credentials.Email), nil)
+			})
+
+			It("verifies the email once", func() {
+				server.ServeHTTP(recorder, request)
+				fmt.Printf("%v\n", recorder)
+				Expect(recorder.Code).To(Equal(200))
+
+				savedCredentials, _ := repo.GetCredentials(context.Background(), credentials.Id)
+				Expect(savedCredentials.IsEmailVerified).To(BeTrue())
+				Expect(savedCredentials.LegacyVerification).To(BeEmpty())
+			})
+
+			It("no longer accepts it once a new code is issued", func() {
+				savedCredentials, _ := repo.GetCredentials(context.Background(), credentials.Id)
+				savedCredentials.IssueEmailVerificationCode()
+				repo.SaveCredentials(context.Background(), credentials.Id, savedCredentials)
+
+				server.ServeHTTP(recorder, request)
+				fmt.Printf("%v\n", recorder)
+				Expect(recorder.Code).To(Equal(400))
+			})
+		})
+
+		Context("with an expired code", func() {
+
+			BeforeEach(func() {
+				regView := gory.Build("userRegistrationDuplicate").(*UserRegistrationView)
+				credentials, _ = DecodeRegistrationDetails(regView)
+				credentials.Id = uuid.NewV4()
+
+				EmailVerificationLifetime = -time.Minute
+				code, _ := credentials.IssueEmailVerificationCode()
+				EmailVerificationLifetime = time.Hour * 24
+
+				repo.SaveCredentials(context.Background(), credentials.Id, credentials)
+
+				request, _ = http.NewRequest("GET", fmt.Sprintf("/api/verification?email=%s&code=%s", credentials.Email, code), nil)
+			})
+
+			It("returns a status code of 400", func() {
+				server.ServeHTTP(recorder, request)
+				fmt.Printf("%v\n", recorder)
+				Expect(recorder.Code).To(Equal(400))
+
+				savedCredentials, _ := repo.GetCredentials(context.Background(), credentials.Id)
+				Expect(savedCredentials.IsEmailVerified).To(BeFalse())
+			})
+
+			/*It("returns the user info", func() {
+				server.ServeHTTP(recorder, request)
+				fmt.Printf("%v\n", recorder)
+
+				responseJSON := mapFromJSON(recorder.Body.Bytes())
+				Expect(responseJSON["user_id"]).ToNot(Equal(""))
+			})*/
+
+		})
+
+		Context("when the credentials keep changing", func() {
+
+			BeforeEach(func() {
+				regView := gory.Build("userRegistrationDuplicate").(*UserRegistrationView)
+				credentials, _ = DecodeRegistrationDetails(regView)
+				credentials.Id = uuid.NewV4()
+				code, _ := credentials.IssueEmailVerificationCode()
+
+				repo.SaveCredentials(context.Background(), credentials.Id, credentials)
+
+				// Every save loses the race to another request.
+				conflicting := &conflictingRepo{repo}
+				testAuth = BuildAuthenticator(conflicting, NewMemoryRevocationStore(), "https://auth.example.com", "../crypto/testKey.pem", "../crypto/testKey.pub")
+				server = NewRouter(testPublisher, conflicting, testAuth, NewMemoryRateLimitStore())
+
+				request, _ = http.NewRequest("GET", fmt.Sprintf("/api/verification?email=%s&code=%s", credentials.Email, code), nil)
+			})
+
+			It("returns a status code of 409", func() {
+				server.ServeHTTP(recorder, request)
+				fmt.Printf("%v\n", recorder)
+				Expect(recorder.Code).To(Equal(409))
+
+				savedCredentials, _ := repo.GetCredentials(context.Background(), credentials.Id)
+				Expect(savedCredentials.IsEmailVerified).To(BeFalse())
+			})
+		})
+	})
+
+	Describe("POST /verification/resends", func() {
+		var credentials *Credentials
+
+		resend := func(email string) *httptest.ResponseRecorder {
+			body, _ := json.Marshal(VerificationResendView{Email: email})
+			request, _ := http.NewRequest(
+				"POST", "/api/verification/resends", bytes.NewReader(body))
+			request.Header.Set("content-type", "application/json")
+
+			recorder := httptest.NewRecorder()
+			server.ServeHTTP(recorder, request)
+			return recorder
+		}
+
+		BeforeEach(func() {
+			regView := gory.Build("userRegistrationDuplicate").(*UserRegistrationView)
+			credentials, _ = DecodeRegistrationDetails(regView)
+			credentials.Id = uuid.NewV4()
+			credentials.IssueEmailVerificationCode()
+
+			repo.SaveCredentials(context.Background(), credentials.Id, credentials)
+		})
+
+		It("sends a new code that replaces the old one", func() {
+			previous := credentials.VerificationCodeHash
+
+			Expect(resend("LAtherton@example.com").Code).To(Equal(202))
+
+			Eventually(func() []DomainEvent {
+				return testPublisher.messages
+			}).Should(HaveLen(1))
+
+			message, _ := testPublisher.messages[0].(EmailVerificationPending)
+			Expect(message.GetMessageType()).To(Equal("Email.Verification.Pending"))
+			Expect(message.Email).To(Equal("latherton@example.com"))
+
+			saved, _ := repo.GetCredentials(context.Background(), credentials.Id)
+			Expect(saved.VerificationCodeHash).ToNot(Equal(previous))
+
+			request, _ := http.NewRequest("GET", fmt.Sprintf("/api/verification?email=%s&code=%s", credentials.Email, message.EmailVerificationCode), nil)
+			server.ServeHTTP(recorder, request)
+			Expect(recorder.Code).To(Equal(200))
+		})
+
+		It("sends nothing for unknown or verified emails", func() {
+			Expect(resend("unknown@example.com").Code).To(Equal(202))
+
+			credentials.IsEmailVerified = true
+			repo.SaveCredentials(context.Background(), credentials.Id, credentials)
+
+			Expect(resend("latherton@example.com").Code).To(Equal(202))
+
+			Consistently(func() []DomainEvent {
+				return testPublisher.messages
+			}).Should(BeEmpty())
+		})
+
+		It("is rate limited per email", func() {
+			for i := 0; i < VerificationResendRateLimit.Burst; i++ {
+				Expect(resend("latherton@example.com").Code).To(Equal(202))
+			}
+
+			Expect(resend("latherton@example.com").Code).To(Equal(429))
+		})
+	})
+
+	Describe("POST /registrations", func() {
+
+		Context("with a password that breaks the policy", func() {
+
+			BeforeEach(func() {
+				body, _ := json.Marshal(UserRegistrationView{Email: "latherton0@example.com", Password: "password"})
+				request, _ = http.NewRequest(
+					"POST", "/api/registrations", bytes.NewReader(body))
+				request.Header.Set("content-type", "application/json")
+			})
+
+			It("returns a status code of 400 with an error for each rule", func() {
+				server.ServeHTTP(recorder, request)
+				fmt.Printf("%v\n", recorder)
+				Expect(recorder.Code).To(Equal(400))
+
+				var response ErrorResponse
+				json.Unmarshal(recorder.Body.Bytes(), &response)
+
+				Expect(response.Errors).To(HaveLen(1))
+				Expect(response.Errors[0].Code).To(Equal(ErrCodePasswordTooWeak))
+			})
+
+			It("does not create the user", func() {
+				server.ServeHTTP(recorder, request)
+
+				userId, _ := repo.FindEmail(context.Background(), "latherton0@example.com")
+				Expect(userId).To(Equal(uuid.Nil))
+			})
+		})
+
+		Context("with invalid JSON", func() {
+
+			// Create a POST request using JSON from our invalid
+			// factory object before each test in this context.
+			BeforeEach(func() {
+				body, _ := json.Marshal(
+					gory.Build("userRegistrationMissingEmail"))
+				request, _ = http.NewRequest(
+					"POST", "/api/registrations", bytes.NewReader(body))
+				request.Header.Set("content-type", "application/json")
+			})
+
+			It("returns a status code of 400", func() {
+				server.ServeHTTP(recorder, request)
+				fmt.Printf("%v\n", recorder)
+				Expect(recorder.Code).To(Equal(400))
+			})
+		})
+
+		Context("with valid JSON", func() {
+
+			// Create a POST request with valid JSON from
+			// our factory before each test in this context.
+			BeforeEach(func() {
+				body, _ := json.Marshal(
+					gory.Build("userRegistration"))
+				request, _ = http.NewRequest(
+					"POST", "/api/registrations", bytes.NewReader(body))
+				request.Header.Set("content-type", "application/json")
+			})
+
+			It("returns a status code of 201", func() {
+				server.ServeHTTP(recorder, request)
+				fmt.Printf("%v\n", recorder)
+				Expect(recorder.Code).To(Equal(201))
+			})
+
+			It("publishes user registered events", func() {
+				server.ServeHTTP(recorder, request)
+				fmt.Printf("%v\n", recorder)
+
+				Eventually(func() []DomainEvent {
+					return testPublisher.messages
+				}).Should(HaveLen(2))
+
+				for _, m := range testPublisher.messages {
+					switch m.GetMessageType() {
+					case "User.Registered":
+						var message UserRegistered
+						message, _ = m.(UserRegistered)
+						Expect(message.Email == "latherton0@example.com")
+
+					case "Email.Verification.Pending":
+						var message EmailVerificationPending
+						message, _ = m.(EmailVerificationPending)
+						Expect(message.Email == "latherton0@example.com")
+					}
+				}
+
+			})
+
+			It("returns the user info", func() {
+				server.ServeHTTP(recorder, request)
+				fmt.Printf("%v\n", recorder)
+
+				responseJSON := mapFromJSON(recorder.Body.Bytes())
+
+				token := strings.Replace(responseJSON["token"].(string), "\"", "", -1)
+				token = strings.Trim(token, "\r\n")
+
+				Expect(testAuth.ValidateToken(context.Background(), token)).To(Equal(true))
+
+				// token := strings.Replace(recorder.Body.String(), "\"", "", -1)
+				// token = strings.Trim(token, "\r\n")
+
+				// Expect(testAuth.ValidateToken(context.Background(), token)).To(Equal(true))
+
+				// responseArray := strings.Split(recorder.Body.String(), ".")
+				// fmt.Printf("TOKEN: %s\n", responseArray[1])
+
+				// userInfo := responseArray[1]
+
+				// //this fixes an issue decoding part of the token
+				// if l := len(userInfo) % 4; l > 0 {
+				// 	userInfo += strings.Repeat("=", 4-l)
+				// }
+
+				// response, err := base64.URLEncoding.DecodeString(userInfo)
+				// if err != nil {
+				// 	panic(err)
+				// 	return
+				// }
+
+				// responseJSON := mapFromJSON(response)
+				Expect(responseJSON["id"]).ToNot(Equal(""))
+			})
+
+			// Measure("new users should be created in under 500ms", func(b Benchmarker) {
+			// 	runtime := b.Time("runtime", func() {
+			// 		server.ServeHTTP(recorder, request)
+			// 		Expect(recorder.Code).To(Equal(201))
+			// 	})
+
+			// 	Ω(runtime.Seconds()).Should(BeNumerically("<", 0.5), "creating users shouldn't take longer than 500ms.")
+
+			// 	//b.RecordValue("disk usage (in MB)", HowMuchDiskSpaceDidYouUse())
+			// }, 10)
+		})
+
+		Context("with JSON containing a duplicate email", func() {
+
+			var credentials *Credentials
+
+			BeforeEach(func() {
+				regView := gory.Build("userRegistrationDuplicate").(*UserRegistrationView)
+				credentials, _ = DecodeRegistrationDetails(regView)
+				credentials.Id = uuid.NewV4()
+
+				repo.SaveCredentials(context.Background(), credentials.Id, credentials)
+
+				body, _ := json.Marshal(
+					gory.Build("userRegistrationDupEmail"))
+				request, _ = http.NewRequest(
+					"POST", "/api/registrations", bytes.NewReader(body))
+				request.Header.Set("content-type", "application/json")
+			})
+
+			It("returns a status code of 400", func() {
+				server.ServeHTTP(recorder, request)
+				fmt.Printf("%v\n", recorder)
+				Expect(recorder.Code).To(Equal(400))
+			})
+		})
+	})
+
+	Describe("POST /auth", func() {
+
+		Context("with invalid JSON", func() {
+
+			// Create a POST request using JSON from our invalid
+			// factory object before each test in this context.
+			BeforeEach(func() {
+				body, _ := json.Marshal(
+					gory.Build("loginValid"))
+				request, _ = http.NewRequest(
+					"POST", "/api/auth", bytes.NewReader(body))
+				request.Header.Set("content-type", "application/json")
+			})
+
+			It("returns a status code of 401", func() {
+				server.ServeHTTP(recorder, request)
+				fmt.Printf("%v\n", recorder)
+				Expect(recorder.Code).To(Equal(401))
+			})
+		})
+
+		Context("with existing user JSON", func() {
+			var credentials *Credentials
+
+			// Create a POST request with valid JSON from
+			// our factory before each test in this context.
+			BeforeEach(func() {
+				regView := gory.Build("userRegistrationDuplicate").(*UserRegistrationView)
+				credentials, _ = DecodeRegistrationDetails(regView)
+				credentials.Id = uuid.NewV4()
+				credentials.IsEmailVerified = true
+
+				repo.SaveCredentials(context.Background(), credentials.Id, credentials)
+
+				body, _ := json.Marshal(
+					gory.Build("loginValid"))
+				request, _ = http.NewRequest(
+					"POST", "/api/auth", bytes.NewReader(body))
+				request.Header.Set("content-type", "application/json")
+			})
+
+			It("returns a status code of 200", func() {
+				server.ServeHTTP(recorder, request)
+				fmt.Printf("%v\n", recorder)
+				Expect(recorder.Code).To(Equal(200))
+			})
+
+			It("returns the user info", func() {
+				server.ServeHTTP(recorder, request)
+				fmt.Printf("%v\n", recorder)
+
+				responseJSON := mapFromJSON(recorder.Body.Bytes())
+
+				token := strings.Replace(responseJSON["token"].(string), "\"", "", -1)
+				token = strings.Trim(token, "\r\n")
+
+				Expect(testAuth.ValidateToken(context.Background(), token)).To(Equal(true))
+
+				// token := strings.Split(responseJSON["token"], ".")
+
+				// userInfo := token[1]
+
+				// //this fixes an issue decoding part of the token
+				// if l := len(userInfo) % 4; l > 0 {
+				// 	userInfo += strings.Repeat("=", 4-l)
+				// }
+
+				// response, err := base64.URLEncoding.DecodeString(userInfo)
+				// if err != nil {
+				// 	panic(err)
+				// 	return
+				// }
+
+				Expect(responseJSON["id"]).To(Equal(credentials.Id.String()))
+			})
+
+			It("returns an ID token when a client id is supplied", func() {
+				body, _ := json.Marshal(LoginView{Email: credentials.Email, Password: "correct horse battery", ClientId: "client", Nonce: "n-0S6_WzA2Mj"})
+				request, _ = http.NewRequest(
+					"POST", "/api/auth", bytes.NewReader(body))
+				request.Header.Set("content-type", "application/json")
+
+				server.ServeHTTP(recorder, request)
+				fmt.Printf("%v\n", recorder)
+
+				responseJSON := mapFromJSON(recorder.Body.Bytes())
+				idToken := responseJSON["idToken"].(string)
+
+				Expect(testAuth.GetTokenClaim(idToken, "iss")).To(Equal("https://auth.example.com"))
+				Expect(testAuth.GetTokenClaim(idToken, "sub")).To(Equal(credentials.Id.String()))
+				Expect(testAuth.GetTokenClaim(idToken, "aud")).To(Equal("client"))
+				Expect(testAuth.GetTokenClaim(idToken, "nonce")).To(Equal("n-0S6_WzA2Mj"))
+				Expect(testAuth.GetTokenClaim(idToken, "auth_time")).ToNot(BeNil())
+			})
+
+			It("returns a refresh token", func() {
+				server.ServeHTTP(recorder, request)
+				fmt.Printf("%v\n", recorder)
+
+				responseJSON := mapFromJSON(recorder.Body.Bytes())
+				Expect(responseJSON["refreshToken"]).ToNot(BeEmpty())
+			})
+
+			It("fails when the password is changed while it is being checked", func() {
+				changing := &changingRepo{TestRepo: repo, change: func() {
+					changed, _ := repo.GetCredentials(context.Background(), credentials.Id)
+					changed.ReplacePassword("new horse battery staple", time.Now().Add(time.Second))
+					repo.SaveCredentials(context.Background(), changed.Id, changed)
+				}}
+				changingAuth := BuildAuthenticator(changing, NewMemoryRevocationStore(), "https://auth.example.com", "../crypto/testKey.pem", "../crypto/testKey.pub")
+
+				token, err := changingAuth.Authenticate(context.Background(), credentials.Email, "correct horse battery", "")
+				Expect(err).To(Equal(ErrInvalidPassword))
+				Expect(token).To(BeEmpty())
+			})
+
+			// Measure("authentication should take less than 400ms", func(b Benchmarker) {
+			// 	runtime := b.Time("runtime", func() {
+			// 		server.ServeHTTP(recorder, request)
+			// 		Expect(recorder.Code).To(Equal(200))
+			// 	})
+
+			// 	Ω(runtime.Seconds()).Should(BeNumerically("<", 0.4), "authentication shouldn't take longer than 400ms.")
+
+			// 	//b.RecordValue("disk usage (in MB)", HowMuchDiskSpaceDidYouUse())
+			// }, 10)
+		})
+
+		Context("with a password hashed before PHC hashes were introduced", func() {
+			var credentials *Credentials
+
+			BeforeEach(func() {
+				passwordKey := DeriveKey("correct horse battery")
+				credentials = &Credentials{Id: uuid.NewV4(), Email: "latherton@example.com", Salt: passwordKey.Salt, Key: passwordKey.Key, IsEmailVerified: true}
+
+				repo.SaveCredentials(context.Background(), credentials.Id, credentials)
+
+				body, _ := json.Marshal(
+					gory.Build("loginValid"))
+				request, _ = http.NewRequest(
+					"POST", "/api/auth", bytes.NewReader(body))
+				request.Header.Set("content-type", "application/json")
+			})
+
+			It("returns a status code of 200", func() {
+				server.ServeHTTP(recorder, request)
+				fmt.Printf("%v\n", recorder)
+				Expect(recorder.Code).To(Equal(200))
+			})
+
+			It("rehashes the password with the default hasher", func() {
+				server.ServeHTTP(recorder, request)
+
+				saved, _ := repo.GetCredentials(context.Background(), credentials.Id)
+				Expect(saved.PasswordHash).To(HavePrefix("$argon2id$"))
+				Expect(saved.Key).To(BeEmpty())
+
+				matched, needsRehash := saved.CheckPassword("correct horse battery")
+				Expect(matched).To(Equal(true))
+				Expect(needsRehash).To(Equal(false))
+			})
+		})
+
+		Context("with a password hashed by another algorithm", func() {
+			var credentials *Credentials
+
+			BeforeEach(func() {
+				passwordHash, _ := (&BcryptHasher{Cost: 4}).Hash("correct horse battery")
+				credentials = &Credentials{Id: uuid.NewV4(), Email: "latherton@example.com", PasswordHash: passwordHash, IsEmailVerified: true}
+
+				repo.SaveCredentials(context.Background(), credentials.Id, credentials)
+
+				body, _ := json.Marshal(
+					gory.Build("loginValid"))
+				request, _ = http.NewRequest(
+					"POST", "/api/auth", bytes.NewReader(body))
+				request.Header.Set("content-type", "application/json")
+			})
+
+			It("accepts the password and rehashes it", func() {
+				server.ServeHTTP(recorder, request)
+				fmt.Printf("%v\n", recorder)
+				Expect(recorder.Code).To(Equal(200))
+
+				saved, _ := repo.GetCredentials(context.Background(), credentials.Id)
+				Expect(saved.PasswordHash).To(HavePrefix("$argon2id$"))
+			})
+
+			It("leaves the hash alone when the password is wrong", func() {
+				body, _ := json.Marshal(LoginView{Email: credentials.Email, Password: "wrong"})
+				request, _ = http.NewRequest(
+					"POST", "/api/auth", bytes.NewReader(body))
+				request.Header.Set("content-type", "application/json")
+
+				server.ServeHTTP(recorder, request)
+				Expect(recorder.Code).To(Equal(401))
+
+				saved, _ := repo.GetCredentials(context.Background(), credentials.Id)
+				Expect(saved.PasswordHash).To(Equal(credentials.PasswordHash))
+			})
+		})
+
+	})
+
+	Describe("Account lockout", func() {
+		var credentials *Credentials
+
+		BeforeEach(func() {
+			regView := gory.Build("userRegistrationDuplicate").(*UserRegistrationView)
+			credentials, _ = DecodeRegistrationDetails(regView)
+			credentials.Id = uuid.NewV4()
+
+			repo.SaveCredentials(context.Background(), credentials.Id, credentials)
+		})
+
+		login := func(password string) *httptest.ResponseRecorder {
+			body, _ := json.Marshal(LoginView{Email: "latherton@example.com", Password: password})
+			loginRequest, _ := http.NewRequest("POST", "/api/auth", bytes.NewReader(body))
+			loginRequest.Header.Set("content-type", "application/json")
+
+			loginRecorder := httptest.NewRecorder()
+			server.ServeHTTP(loginRecorder, loginRequest)
+			fmt.Printf("%v\n", loginRecorder)
+
+			return loginRecorder
+		}
+
+		// rewind moves the last failure back in time, so the delay before the
+		// next attempt has passed.
+		rewind := func() {
+			saved, _ := repo.GetCredentials(context.Background(), credentials.Id)
+			saved.LastFailedLoginDate = saved.LastFailedLoginDate.Add(-time.Hour)
+			repo.SaveCredentials(context.Background(), credentials.Id, saved)
+		}
+
+		It("refuses the right password during the delay after repeated failures", func() {
+			var wrong *httptest.ResponseRecorder
+			for i := 0; i < LoginDelayThreshold; i++ {
+				wrong = login("wrong")
+			}
+
+			delayed := login("correct horse battery")
+			Expect(delayed.Code).To(Equal(401))
+			Expect(delayed.Body.String()).To(Equal(wrong.Body.String()))
+
+			rewind()
+			Expect(login("correct horse battery").Code).To(Equal(200))
+		})
+
+		It("clears failed attempts after a successful login", func() {
+			login("wrong")
+			Expect(login("correct horse battery").Code).To(Equal(200))
+
+			saved, _ := repo.GetCredentials(context.Background(), credentials.Id)
+			Expect(saved.FailedLoginAttempts).To(Equal(0))
+		})
+
+		Context("after too many failed attempts", func() {
+			var wrong *httptest.ResponseRecorder
+
+			BeforeEach(func() {
+				for i := 0; i < LockoutThreshold; i++ {
+					rewind()
+					wrong = login("wrong")
+				}
+			})
+
+			It("locks the account", func() {
+				saved, _ := repo.GetCredentials(context.Background(), credentials.Id)
+				Expect(saved.LockedUntil).To(BeTemporally(">", time.Now()))
+
+				locked := login("correct horse battery")
+				Expect(locked.Code).To(Equal(401))
+				Expect(locked.Body.String()).To(Equal(wrong.Body.String()))
+			})
+
+			It("publishes an account locked event", func() {
+				Eventually(func() []DomainEvent {
+					return testPublisher.messages
+				}).Should(HaveLen(1))
+
+				message, _ := testPublisher.messages[0].(AccountLocked)
+				Expect(message.GetMessageType()).To(Equal("Account.Locked"))
+				Expect(message.Id).To(Equal(credentials.Id))
+				Expect(message.Email).To(Equal("latherton@example.com"))
+			})
+
+			It("unlocks once the lockout has passed", func() {
+				saved, _ := repo.GetCredentials(context.Background(), credentials.Id)
+				saved.LockedUntil = time.Now().Add(-time.Second)
+				repo.SaveCredentials(context.Background(), credentials.Id, saved)
+
+				Expect(login("correct horse battery").Code).To(Equal(200))
+			})
+
+			Context("POST /admin/unlocks", func() {
+				var client *Client
+
+				BeforeEach(func() {
+					client = &Client{
+						ClientId: "support-service",
+						Name:     "Support Service",
+						Scopes:   []string{"users:read", AdminScope},
+					}
+					client.SetSecret("s3cret")
+
+					repo.SaveClient(context.Background(), client)
+				})
+
+				unlock := func(bearer string) *httptest.ResponseRecorder {
+					body, _ := json.Marshal(AccountUnlockView{Email: "latherton@example.com"})
+					unlockRequest, _ := http.NewRequest("POST", "/api/admin/unlocks", bytes.NewReader(body))
+					unlockRequest.Header.Set("content-type", "application/json")
+					unlockRequest.Header.Set("Authorization", fmt.Sprintf("Bearer %s", bearer))
+
+					unlockRecorder := httptest.NewRecorder()
+					server.ServeHTTP(unlockRecorder, unlockRequest)
+					fmt.Printf("%v\n", unlockRecorder)
+
+					return unlockRecorder
+				}
+
+				It("unlocks the account for a client with the admin scope", func() {
+					response, _ := testAuth.IssueClientToken(client, AdminScope)
+
+					Expect(unlock(response.AccessToken).Code).To(Equal(200))
+					Expect(login("correct horse battery").Code).To(Equal(200))
+				})
+
+				It("returns a status code of 403 without the admin scope", func() {
+					response, _ := testAuth.IssueClientToken(client, "users:read")
+
+					Expect(unlock(response.AccessToken).Code).To(Equal(403))
+					Expect(login("correct horse battery").Code).To(Equal(401))
+				})
+
+				It("returns a status code of 403 for a user token", func() {
+					saved, _ := repo.GetCredentials(context.Background(), credentials.Id)
+					saved.LockedUntil = time.Time{}
+					repo.SaveCredentials(context.Background(), credentials.Id, saved)
+					token, _ := testAuth.Authenticate(context.Background(), "latherton@example.com", "correct horse battery", "")
+
+					Expect(unlock(token).Code).To(Equal(403))
+				})
+
+				It("returns a status code of 401 without a token", func() {
+					Expect(unlock("").Code).To(Equal(401))
+				})
+			})
+		})
+
+		Context("with too many failures from one IP", func() {
+			var limit int
+
+			BeforeEach(func() {
+				limit = LoginThrottleLimit
+				LoginThrottleLimit = 2
+				server = NewRouter(testPublisher, repo, testAuth, NewMemoryRateLimitStore())
+			})
+
+			AfterEach(func() {
+				LoginThrottleLimit = limit
+			})
+
+			It("refuses further logins from that IP for any account", func() {
+				for i := 0; i < 2; i++ {
+					body, _ := json.Marshal(LoginView{Email: fmt.Sprintf("nobody%d@example.com", i), Password: "wrong"})
+					loginRequest, _ := http.NewRequest("POST", "/api/auth", bytes.NewReader(body))
+					loginRequest.Header.Set("content-type", "application/json")
+					server.ServeHTTP(httptest.NewRecorder(), loginRequest)
+				}
+
+				throttled := login("correct horse battery")
+				Expect(throttled.Code).To(Equal(401))
+				Expect(throttled.Body.String()).To(Equal(login("wrong").Body.String()))
+
+				saved, _ := repo.GetCredentials(context.Background(), credentials.Id)
+				Expect(saved.FailedLoginAttempts).To(Equal(0))
+			})
+		})
+	})
+
+	Describe("Rate limiting", func() {
+
+		checkEmail := func(remoteAddr string) *httptest.ResponseRecorder {
+			checkRequest, _ := http.NewRequest("GET", "/api/emails?email=someone@example.com", nil)
+			checkRequest.RemoteAddr = remoteAddr
+
+			checkRecorder := httptest.NewRecorder()
+			server.ServeHTTP(checkRecorder, checkRequest)
+
+			return checkRecorder
+		}
+
+		requestReset := func(email string) *httptest.ResponseRecorder {
+			body, _ := json.Marshal(PasswordResetRequestView{Email: email})
+			resetRequest, _ := http.NewRequest("POST", "/api/credentials/resetrequests", bytes.NewReader(body))
+			resetRequest.Header.Set("content-type", "application/json")
+			resetRequest.RemoteAddr = "192.0.2.1:1234"
+
+			resetRecorder := httptest.NewRecorder()
+			server.ServeHTTP(resetRecorder, resetRequest)
+
+			return resetRecorder
+		}
+
+		It("returns a status code of 429 with Retry-After once an IP runs out", func() {
+			for i := 0; i < EmailCheckRateLimit.Burst; i++ {
+				Expect(checkEmail("192.0.2.1:1234").Code).ToNot(Equal(429))
+			}
+
+			limited := checkEmail("192.0.2.1:5678")
+			fmt.Printf("%v\n", limited)
+			Expect(limited.Code).To(Equal(429))
+			Expect(limited.Header().Get("Retry-After")).To(Equal("6"))
+
+			responseJSON := mapFromJSON(limited.Body.Bytes())
+			Expect(responseJSON["code"]).To(Equal(float64(ErrCodeRateLimited)))
+		})
+
+		It("limits each IP separately", func() {
+			for i := 0; i < EmailCheckRateLimit.Burst; i++ {
+				checkEmail("192.0.2.1:1234")
+			}
+
+			Expect(checkEmail("192.0.2.2:1234").Code).ToNot(Equal(429))
+		})
+
+		It("keeps a bucket for each policy", func() {
+			post := func(path string) *httptest.ResponseRecorder {
+				postRequest, _ := http.NewRequest("POST", path, bytes.NewReader([]byte("{}")))
+				postRequest.Header.Set("content-type", "application/json")
+				postRequest.RemoteAddr = "192.0.2.1:1234"
+
+				postRecorder := httptest.NewRecorder()
+				server.ServeHTTP(postRecorder, postRequest)
+
+				return postRecorder
+			}
+
+			for i := 0; i < MFARateLimit.Burst; i++ {
+				post("/api/auth/mfa")
+			}
+
+			Expect(post("/api/auth/mfa").Code).To(Equal(429))
+			Expect(post("/api/auth/links/redemptions").Code).ToNot(Equal(429))
+			Expect(post("/api/credentials/resets").Code).ToNot(Equal(429))
+		})
+
+		It("limits each email separately and leaves the body for the handler", func() {
+			for i := 0; i < EmailMessageRateLimit.Burst; i++ {
+				Expect(requestReset("LAtherton@example.com").Code).To(Equal(202))
+			}
+
+			Expect(requestReset("latherton@example.com").Code).To(Equal(429))
+			Expect(requestReset("someone@example.com").Code).To(Equal(202))
+		})
+
+		It("lets requests through when the store fails", func() {
+			server = NewRouter(testPublisher, repo, testAuth, failingRateLimitStore{})
+
+			for i := 0; i <= EmailCheckRateLimit.Burst; i++ {
+				Expect(checkEmail("192.0.2.1:1234").Code).ToNot(Equal(429))
+			}
+		})
+
+		Context("with the in-memory store", func() {
+
+			It("refills buckets over time", func() {
+				store := NewMemoryRateLimitStore()
+
+				allowed, _, _ := store.Take("key", 1, time.Millisecond*50)
+				Expect(allowed).To(Equal(true))
+
+				allowed, retryAfter, _ := store.Take("key", 1, time.Millisecond*50)
+				Expect(allowed).To(Equal(false))
+				Expect(retryAfter).To(BeNumerically(">", 0))
+				Expect(retryAfter).To(BeNumerically("<=", time.Millisecond*50))
+
+				time.Sleep(time.Millisecond * 60)
+
+				allowed, _, _ = store.Take("key", 1, time.Millisecond*50)
+				Expect(allowed).To(Equal(true))
+			})
+		})
+	})
+
+	Describe("Password hashers", func() {
+
+		It("verify their own PHC encoded hashes", func() {
+			for id, hasher := range PasswordHashers {
+				encoded, err := hasher.Hash("secret")
+				Expect(err).To(BeNil())
+				Expect(encoded).To(HavePrefix("$" + id + "$"))
+
+				matched, err := hasher.Verify("secret", encoded)
+				Expect(err).To(BeNil())
+				Expect(matched).To(Equal(true))
+
+				matched, _ = hasher.Verify("wrong", encoded)
+				Expect(matched).To(Equal(false))
+			}
+		})
+
+		It("flag hashes made with weaker parameters", func() {
+			weak, _ := (&ScryptHasher{LogN: 10, R: 8, P: 1, SaltLength: 16, KeyLength: 32}).Hash("secret")
+
+			Expect(PasswordHashers["scrypt"].NeedsRehash(weak)).To(Equal(true))
+		})
+	})
+
+	Describe("Password policy", func() {
+
+		It("accepts a long passphrase", func() {
+			Expect(DefaultPasswordPolicy.Validate("correct horse battery", "latherton@example.com")).To(BeEmpty())
+		})
+
+		It("reports each rule the password breaks", func() {
+			policy := PasswordPolicy{MinLength: 8, MaxLength: 10, MinCharacterClasses: 3}
+
+			Expect(policy.Validate("abc", "")).To(HaveLen(2))
+			Expect(policy.Validate("abcdefghijkl", "")).To(HaveLen(2))
+			Expect(policy.Validate("Abcdefgh1", "")).To(BeEmpty())
+		})
+
+		It("rejects the email as the password", func() {
+			errs := PasswordPolicy{DisallowEmail: true}.Validate("LAtherton@example.com", "latherton@example.com")
+
+			Expect(errs).To(HaveLen(1))
+			Expect(errs[0].Code).To(Equal(ErrCodePasswordMatchesEmail))
+		})
+
+		It("scores guessable passwords low", func() {
+			Expect(PasswordStrength("password")).To(Equal(0))
+			Expect(PasswordStrength("aaaaaaaa")).To(BeNumerically("<", 2))
+			Expect(PasswordStrength("12345678")).To(BeNumerically("<", 2))
+			Expect(PasswordStrength("asdfghjkl")).To(BeNumerically("<", 2))
+			Expect(PasswordStrength("latherton1", "latherton@example.com")).To(BeNumerically("<", 2))
+		})
+
+		It("scores long or varied passwords high", func() {
+			Expect(PasswordStrength("correct horse battery")).To(Equal(4))
+			Expect(PasswordStrength("Tr0ub4dor&3")).To(BeNumerically(">=", 3))
+		})
+
+		It("refuses the last few passwords again", func() {
+			DefaultPasswordPolicy.HistoryLength = 3
+			defer func() { DefaultPasswordPolicy.HistoryLength = 5 }()
+
+			credentials := &Credentials{}
+			credentials.SetPassword("first horse battery")
+
+			Expect(credentials.ReplacePassword("second horse battery", time.Now())).To(BeNil())
+			Expect(credentials.ReplacePassword("third horse battery", time.Now())).To(BeNil())
+			Expect(credentials.PasswordHistory).To(HaveLen(2))
+
+			err := credentials.ReplacePassword("first horse battery", time.Now())
+			Expect(err).To(BeAssignableToTypeOf(&PasswordPolicyError{}))
+			Expect(err.(*PasswordPolicyError).Errors[0].Code).To(Equal(ErrCodePasswordReused))
+
+			Expect(credentials.ReplacePassword("fourth horse battery", time.Now())).To(BeNil())
+			Expect(credentials.PasswordHistory).To(HaveLen(2))
+			Expect(credentials.ReplacePassword("first horse battery", time.Now())).To(BeNil())
+		})
+
+		It("refuses a password hashed before PHC hashes were introduced", func() {
+			passwordKey := DeriveKey("first horse battery")
+			credentials := &Credentials{Salt: passwordKey.Salt, Key: passwordKey.Key}
+
+			Expect(credentials.ReplacePassword("first horse battery", time.Now())).ToNot(BeNil())
+			Expect(credentials.ReplacePassword("second horse battery", time.Now())).To(BeNil())
+			Expect(credentials.PasswordHistory).To(HaveLen(1))
+
+			err := credentials.ReplacePassword("first horse battery", time.Now())
+			Expect(err).To(BeAssignableToTypeOf(&PasswordPolicyError{}))
+			Expect(err.(*PasswordPolicyError).Errors[0].Code).To(Equal(ErrCodePasswordReused))
+		})
+
+		Context("with a breach corpus", func() {
+			var dir string
+			var corpus *BreachCorpus
+			var breached = breachHash("correct horse battery")
+			var other = breachHash("Tr0ub4dor&3")
+
+			BeforeEach(func() {
+				dir, _ = ioutil.TempDir("", "breaches")
+
+				// Range files as served by the range API, with padding.
+				ioutil.WriteFile(filepath.Join(dir, breached[:5]+".txt"),
+					[]byte(breached[5:]+":3\r\n"+strings.Repeat("0", 35)+":0\r\n"), 0600)
+				ioutil.WriteFile(filepath.Join(dir, other[:5]+".txt"),
+					[]byte(other[5:]+":1\r\n"), 0600)
+
+				corpus, _ = LoadBreachCorpus(dir)
+			})
+
+			AfterEach(func() {
+				os.RemoveAll(dir)
+			})
+
+			It("counts breached passwords from range files", func() {
+				Expect(corpus.Len()).To(Equal(2))
+				Expect(corpus.Count("correct horse battery")).To(Equal(3))
+				Expect(corpus.Count("Tr0ub4dor&3")).To(Equal(1))
+				Expect(corpus.Count("new horse battery staple")).To(Equal(0))
+			})
+
+			It("counts breached passwords from a file of full hashes", func() {
+				path := filepath.Join(dir, "pwned-passwords.txt")
+				ioutil.WriteFile(path, []byte(other+":1\n"+breached+":3\n"), 0600)
+
+				corpus, err := LoadBreachCorpus(path)
+				Expect(err).To(BeNil())
+				Expect(corpus.Count("correct horse battery")).To(Equal(3))
+				Expect(corpus.Count("Tr0ub4dor&3")).To(Equal(1))
+			})
+
+			It("rejects a malformed file", func() {
+				path := filepath.Join(dir, "pwned-passwords.txt")
+				ioutil.WriteFile(path, []byte("not a hash\n"), 0600)
+
+				_, err := LoadBreachCorpus(path)
+				Expect(err).ToNot(BeNil())
+			})
+
+			It("refuses passwords seen at least the threshold", func() {
+				policy := PasswordPolicy{BreachCorpus: corpus, MinBreachCount: 2}
+
+				errs := policy.Validate("correct horse battery", "")
+				Expect(errs).To(HaveLen(1))
+				Expect(errs[0].Code).To(Equal(ErrCodePasswordBreached))
+
+				Expect(policy.Validate("Tr0ub4dor&3", "")).To(BeEmpty())
+			})
+
+			It("refuses breached passwords on signup", func() {
+				DefaultPasswordPolicy.BreachCorpus = corpus
+				defer func() { DefaultPasswordPolicy.BreachCorpus = nil }()
+
+				body, _ := json.Marshal(UserRegistrationView{Email: "latherton0@example.com", Password: "correct horse battery"})
+				request, _ = http.NewRequest(
+					"POST", "/api/registrations", bytes.NewReader(body))
+				request.Header.Set("content-type", "application/json")
+
+				server.ServeHTTP(recorder, request)
+				Expect(recorder.Code).To(Equal(400))
+
+				var response ErrorResponse
+				json.Unmarshal(recorder.Body.Bytes(), &response)
+
+				Expect(response.Errors).To(HaveLen(1))
+				Expect(response.Errors[0].Code).To(Equal(ErrCodePasswordBreached))
+			})
+		})
+	})
+
+	Describe("POST /tokens/refresh", func() {
+		var credentials *Credentials
+		var refreshToken string
+
+		BeforeEach(func() {
+			regView := gory.Build("userRegistrationDuplicate").(*UserRegistrationView)
+			credentials, _ = DecodeRegistrationDetails(regView)
+			credentials.Id = uuid.NewV4()
+
+			repo.SaveCredentials(context.Background(), credentials.Id, credentials)
+
+			refreshToken, _ = testAuth.IssueRefreshToken(context.Background(), credentials.Id, []string{AmrPassword})
+		})
+
+		Context("with an unknown refresh token", func() {
+
+			BeforeEach(func() {
+				body, _ := json.Marshal(RefreshTokenView{RefreshToken: "unknown"})
+				request, _ = http.NewRequest(
+					"POST", "/api/tokens/refresh", bytes.NewReader(body))
+				request.Header.Set("content-type", "application/json")
+			})
+
+			It("returns a status code of 401", func() {
+				server.ServeHTTP(recorder, request)
+				fmt.Printf("%v\n", recorder)
+				Expect(recorder.Code).To(Equal(401))
+			})
+		})
+
+		Context("with a valid refresh token", func() {
+
+			BeforeEach(func() {
+				body, _ := json.Marshal(RefreshTokenView{RefreshToken: refreshToken})
+				request, _ = http.NewRequest(
+					"POST", "/api/tokens/refresh", bytes.NewReader(body))
+				request.Header.Set("content-type", "application/json")
+			})
+
+			It("returns a status code of 200", func() {
+				server.ServeHTTP(recorder, request)
+				fmt.Printf("%v\n", recorder)
+				Expect(recorder.Code).To(Equal(200))
+			})
+
+			It("returns a new token and a rotated refresh token", func() {
+				server.ServeHTTP(recorder, request)
+				fmt.Printf("%v\n", recorder)
+
+				responseJSON := mapFromJSON(recorder.Body.Bytes())
+
+				Expect(testAuth.ValidateToken(context.Background(), responseJSON["token"].(string))).To(Equal(true))
+				Expect(responseJSON["id"]).To(Equal(credentials.Id.String()))
+				Expect(responseJSON["refreshToken"]).ToNot(Equal(refreshToken))
+			})
+		})
+
+		Context("with a refresh token that has already been used", func() {
+			var rotatedRefreshToken string
+
+			BeforeEach(func() {
+				_, rotatedRefreshToken, _ = testAuth.RefreshToken(context.Background(), refreshToken)
+
+				body, _ := json.Marshal(RefreshTokenView{RefreshToken: refreshToken})
+				request, _ = http.NewRequest(
+					"POST", "/api/tokens/refresh", bytes.NewReader(body))
+				request.Header.Set("content-type", "application/json")
+			})
+
+			It("returns a status code of 401", func() {
+				server.ServeHTTP(recorder, request)
+				fmt.Printf("%v\n", recorder)
+				Expect(recorder.Code).To(Equal(401))
+			})
+
+			It("revokes the rest of the token family", func() {
+				server.ServeHTTP(recorder, request)
+				fmt.Printf("%v\n", recorder)
+
+				_, _, err := testAuth.RefreshToken(context.Background(), rotatedRefreshToken)
+				Expect(err).To(HaveOccurred())
+			})
+		})
+	})
+
+	Describe("POST /tokens/revoke", func() {
+		var credentials *Credentials
+		var token string
+
+		BeforeEach(func() {
+			regView := gory.Build("userRegistration").(*UserRegistrationView)
+			credentials, _ = DecodeRegistrationDetails(regView)
+			credentials.Id = uuid.NewV4()
+
+			repo.SaveCredentials(context.Background(), credentials.Id, credentials)
+
+			token, _ = testAuth.Authenticate(context.Background(), regView.Email, regView.Password, "")
+		})
+
+		Context("with missing token", func() {
+
+			BeforeEach(func() {
+				body, _ := json.Marshal(RevokeTokenView{})
+				request, _ = http.NewRequest(
+					"POST", "/api/tokens/revoke", bytes.NewReader(body))
+				request.Header.Set("content-type", "application/json")
+			})
+
+			It("returns a status code of 400", func() {
+				server.ServeHTTP(recorder, request)
+				fmt.Printf("%v\n", recorder)
+				Expect(recorder.Code).To(Equal(400))
+			})
+		})
+
+		Context("with a valid token", func() {
+
+			BeforeEach(func() {
+				body, _ := json.Marshal(RevokeTokenView{Token: token})
+				request, _ = http.NewRequest(
+					"POST", "/api/tokens/revoke", bytes.NewReader(body))
+				request.Header.Set("content-type", "application/json")
+			})
+
+			It("returns a status code of 200", func() {
+				server.ServeHTTP(recorder, request)
+				fmt.Printf("%v\n", recorder)
+				Expect(recorder.Code).To(Equal(200))
+			})
+
+			It("rejects the token afterwards", func() {
+				server.ServeHTTP(recorder, request)
+				fmt.Printf("%v\n", recorder)
+				Expect(testAuth.ValidateToken(context.Background(), token)).To(Equal(false))
+			})
+		})
+
+		Context("with a refresh token", func() {
+			var refreshToken string
+
+			BeforeEach(func() {
+				refreshToken, _ = testAuth.IssueRefreshToken(context.Background(), credentials.Id, []string{AmrPassword})
+
+				body, _ := json.Marshal(RevokeTokenView{Token: refreshToken})
+				request, _ = http.NewRequest(
+					"POST", "/api/tokens/revoke", bytes.NewReader(body))
+				request.Header.Set("content-type", "application/json")
+			})
+
+			It("rejects the refresh token afterwards", func() {
+				server.ServeHTTP(recorder, request)
+				fmt.Printf("%v\n", recorder)
+
+				_, _, err := testAuth.RefreshToken(context.Background(), refreshToken)
+				Expect(err).To(HaveOccurred())
+			})
+		})
+	})
+
+	Describe("POST /credentials/updaterequests", func() {
+		var credentials *Credentials
+		var token string
+
+		BeforeEach(func() {
+			regView := gory.Build("userRegistration").(*UserRegistrationView)
+			credentials, _ = DecodeRegistrationDetails(regView)
+			credentials.Id = uuid.NewV4()
+			credentials.IsEmailVerified = true
+
+			repo.SaveCredentials(context.Background(), credentials.Id, credentials)
+
+			token, _ = testAuth.Authenticate(context.Background(), regView.Email, regView.Password, "")
+		})
+
+		Context("with invalid JSON", func() {
+
+			// Create a POST request using JSON from our invalid
+			// factory object before each test in this context.
+			BeforeEach(func() {
+				body, _ := json.Marshal(
+					gory.Build("passwordChangeRequestMissingInfo"))
+				request, _ = http.NewRequest(
+					"POST", "/api/credentials/updaterequests", bytes.NewReader(body))
+				request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+				request.Header.Set("content-type", "application/json")
+			})
+
+			It("returns a status code of 400", func() {
+				server.ServeHTTP(recorder, request)
+				fmt.Printf("%v\n", recorder)
+				Expect(recorder.Code).To(Equal(400))
+			})
+		})
+
+		Context("with a new password that breaks the policy", func() {
+
+			BeforeEach(func() {
+				body, _ := json.Marshal(ChangePasswordView{OldPassword: "correct horse battery", NewPassword: credentials.Email})
+				request, _ = http.NewRequest(
+					"POST", "/api/credentials/updaterequests", bytes.NewReader(body))
+				request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+				request.Header.Set("content-type", "application/json")
+			})
+
+			It("returns a status code of 400 and keeps the old password", func() {
+				server.ServeHTTP(recorder, request)
+				fmt.Printf("%v\n", recorder)
+				Expect(recorder.Code).To(Equal(400))
+
+				var response ErrorResponse
+				json.Unmarshal(recorder.Body.Bytes(), &response)
+
+				Expect(response.Errors).To(HaveLen(2))
+				Expect(response.Errors[0].Code).To(Equal(ErrCodePasswordMatchesEmail))
+				Expect(response.Errors[1].Code).To(Equal(ErrCodePasswordTooWeak))
+
+				_, err := testAuth.Authenticate(context.Background(), credentials.Email, "correct horse battery", "")
+				Expect(err).To(BeNil())
+			})
+		})
+
+		Context("with the current password as the new one", func() {
+
+			BeforeEach(func() {
+				body, _ := json.Marshal(ChangePasswordView{OldPassword: "correct horse battery", NewPassword: "correct horse battery"})
+				request, _ = http.NewRequest(
+					"POST", "/api/credentials/updaterequests", bytes.NewReader(body))
+				request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+				request.Header.Set("content-type", "application/json")
+			})
+
+			It("returns a status code of 400", func() {
+				server.ServeHTTP(recorder, request)
+				fmt.Printf("%v\n", recorder)
+				Expect(recorder.Code).To(Equal(400))
+
+				var response ErrorResponse
+				json.Unmarshal(recorder.Body.Bytes(), &response)
+
+				Expect(response.Errors).To(HaveLen(1))
+				Expect(response.Errors[0].Code).To(Equal(ErrCodePasswordReused))
+			})
+		})
+
+		Context("before the minimum password age", func() {
+
+			BeforeEach(func() {
+				DefaultPasswordPolicy.MinAge = time.Hour
+
+				body, _ := json.Marshal(
+					gory.Build("passwordChangeRequest"))
+				request, _ = http.NewRequest(
+					"POST", "/api/credentials/updaterequests", bytes.NewReader(body))
+				request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+				request.Header.Set("content-type", "application/json")
+			})
+
+			AfterEach(func() {
+				DefaultPasswordPolicy.MinAge = 0
+			})
+
+			It("returns a status code of 400 and keeps the old password", func() {
+				server.ServeHTTP(recorder, request)
+				fmt.Printf("%v\n", recorder)
+				Expect(recorder.Code).To(Equal(400))
+
+				var response ErrorResponse
+				json.Unmarshal(recorder.Body.Bytes(), &response)
+
+				Expect(response.Errors).To(HaveLen(1))
+				Expect(response.Errors[0].Code).To(Equal(ErrCodePasswordTooRecent))
+
+				_, err := testAuth.Authenticate(context.Background(), credentials.Email, "correct horse battery", "")
+				Expect(err).To(BeNil())
+			})
+		})
+
+		Context("with invalid password", func() {
+
+			// Create a POST request using JSON from our invalid
+			// factory object before each test in this context.
+			BeforeEach(func() {
+				body, _ := json.Marshal(
+					gory.Build("passwordChangeRequestWrongPassword"))
+				request, _ = http.NewRequest(
+					"POST", "/api/credentials/updaterequests", bytes.NewReader(body))
+				request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+				request.Header.Set("content-type", "application/json")
+			})
+
+			It("returns a status code of 401", func() {
+				server.ServeHTTP(recorder, request)
+				fmt.Printf("%v\n", recorder)
+				Expect(recorder.Code).To(Equal(401))
+			})
+		})
+
+		Context("with valid JSON", func() {
+
+			// Create a POST request with valid JSON from
+			// our factory before each test in this context.
+			BeforeEach(func() {
+				body, _ := json.Marshal(
+					gory.Build("passwordChangeRequest"))
+				request, _ = http.NewRequest(
+					"POST", "/api/credentials/updaterequests", bytes.NewReader(body))
+				request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+				request.Header.Set("content-type", "application/json")
+			})
+
+			It("returns a status code of 201", func() {
+				server.ServeHTTP(recorder, request)
+				fmt.Printf("%v\n", recorder)
+				Expect(recorder.Code).To(Equal(201))
+			})
+
+			It("returns the user info", func() {
+				server.ServeHTTP(recorder, request)
+				fmt.Printf("%v\n", recorder)
+
+				responseJSON := mapFromJSON(recorder.Body.Bytes())
+
+				token := strings.Replace(responseJSON["token"].(string), "\"", "", -1)
+				token = strings.Trim(token, "\r\n")
+
+				Expect(testAuth.ValidateToken(context.Background(), token)).To(Equal(true))
+
+				// token := strings.Replace(recorder.Body.String(), "\"", "", -1)
+				// token = strings.Trim(token, "\r\n")
+
+				// Expect(testAuth.ValidateToken(context.Background(), token)).To(Equal(true))
+
+				// responseArray := strings.Split(recorder.Body.String(), ".")
+
+				// userInfo := responseArray[1]
+
+				// //this fixes an issue decoding part of the token
+				// if l := len(userInfo) % 4; l > 0 {
+				// 	userInfo += strings.Repeat("=", 4-l)
+				// }
+
+				// response, err := base64.URLEncoding.DecodeString(userInfo)
+				// if err != nil {
+				// 	panic(err)
+				// 	return
+				// }
+
+				// responseJSON := mapFromJSON(response)
+				Expect(responseJSON["id"]).ToNot(Equal(""))
+			})
+
+			It("revokes the token used to change the password", func() {
+				server.ServeHTTP(recorder, request)
+				fmt.Printf("%v\n", recorder)
+				Expect(testAuth.ValidateToken(context.Background(), token)).To(Equal(false))
+			})
+		})
+	})
+
+	Describe("POST /credentials/resetrequests", func() {
+
+		BeforeEach(func() {
+			regView := gory.Build("userRegistrationDuplicate").(*UserRegistrationView)
+			credentials, _ := DecodeRegistrationDetails(regView)
+			credentials.Id = uuid.NewV4()
+
+			repo.SaveCredentials(context.Background(), credentials.Id, credentials)
+		})
+
+		Context("with missing email", func() {
+
+			It("returns a status code of 400", func() {
+				request, _ = http.NewRequest(
+					"POST", "/api/credentials/resetrequests", bytes.NewReader([]byte("{}")))
+				request.Header.Set("content-type", "application/json")
+
+				server.ServeHTTP(recorder, request)
+				fmt.Printf("%v\n", recorder)
+				Expect(recorder.Code).To(Equal(400))
+			})
+		})
+
+		Context("with a registered email", func() {
+
+			BeforeEach(func() {
+				body, _ := json.Marshal(PasswordResetRequestView{Email: "latherton@example.com"})
+				request, _ = http.NewRequest(
+					"POST", "/api/credentials/resetrequests", bytes.NewReader(body))
+				request.Header.Set("content-type", "application/json")
+			})
+
+			It("returns a status code of 202", func() {
+				server.ServeHTTP(recorder, request)
+				fmt.Printf("%v\n", recorder)
+				Expect(recorder.Code).To(Equal(202))
+			})
+
+			It("publishes a password reset requested event", func() {
+				server.ServeHTTP(recorder, request)
+
+				Eventually(func() []DomainEvent {
+					return testPublisher.messages
+				}).Should(HaveLen(1))
+
+				message, _ := testPublisher.messages[0].(PasswordResetRequested)
+				Expect(message.GetMessageType()).To(Equal("Password.Reset.Requested"))
+				Expect(message.Email).To(Equal("latherton@example.com"))
+				Expect(message.ResetToken).ToNot(BeEmpty())
+			})
+		})
+
+		Context("with an unknown email", func() {
+
+			BeforeEach(func() {
+				body, _ := json.Marshal(PasswordResetRequestView{Email: "nobody@example.com"})
+				request, _ = http.NewRequest(
+					"POST", "/api/credentials/resetrequests", bytes.NewReader(body))
+				request.Header.Set("content-type", "application/json")
+			})
+
+			It("responds exactly as for a registered email", func() {
+				server.ServeHTTP(recorder, request)
+				fmt.Printf("%v\n", recorder)
+
+				body, _ := json.Marshal(PasswordResetRequestView{Email: "latherton@example.com"})
+				registeredRequest, _ := http.NewRequest(
+					"POST", "/api/credentials/resetrequests", bytes.NewReader(body))
+				registeredRequest.Header.Set("content-type", "application/json")
+				registeredRecorder := httptest.NewRecorder()
+				server.ServeHTTP(registeredRecorder, registeredRequest)
+
+				Expect(recorder.Code).To(Equal(registeredRecorder.Code))
+				Expect(recorder.Body.String()).To(Equal(registeredRecorder.Body.String()))
+			})
+
+			It("publishes nothing", func() {
+				server.ServeHTTP(recorder, request)
+
+				Consistently(func() []DomainEvent {
+					return testPublisher.messages
+				}).Should(BeEmpty())
+			})
+		})
+	})
+
+	Describe("POST /credentials/resets", func() {
+		var credentials *Credentials
+		var resetToken string
+		var token string
+
+		BeforeEach(func() {
+			regView := gory.Build("userRegistrationDuplicate").(*UserRegistrationView)
+			credentials, _ = DecodeRegistrationDetails(regView)
+			credentials.Id = uuid.NewV4()
+
+			repo.SaveCredentials(context.Background(), credentials.Id, credentials)
+
+			token, _ = testAuth.Authenticate(context.Background(), regView.Email, regView.Password, "")
+			_, resetToken, _ = testAuth.RequestPasswordReset(context.Background(), regView.Email)
+		})
+
+		Context("with an unknown token", func() {
+
+			BeforeEach(func() {
+				body, _ := json.Marshal(PasswordResetView{Token: "unknown", NewPassword: "new horse battery staple"})
+				request, _ = http.NewRequest(
+					"POST", "/api/credentials/resets", bytes.NewReader(body))
+				request.Header.Set("content-type", "application/json")
+			})
+
+			It("returns a status code of 400", func() {
+				server.ServeHTTP(recorder, request)
+				fmt.Printf("%v\n", recorder)
+				Expect(recorder.Code).To(Equal(400))
+			})
+		})
+
+		Context("with a valid token", func() {
+
+			BeforeEach(func() {
+				body, _ := json.Marshal(PasswordResetView{Token: resetToken, NewPassword: "new horse battery staple"})
+				request, _ = http.NewRequest(
+					"POST", "/api/credentials/resets", bytes.NewReader(body))
+				request.Header.Set("content-type", "application/json")
+			})
+
+			It("sets the new password", func() {
+				server.ServeHTTP(recorder, request)
+				fmt.Printf("%v\n", recorder)
+				Expect(recorder.Code).To(Equal(200))
+
+				_, err := testAuth.Authenticate(context.Background(), credentials.Email, "new horse battery staple", "")
+				Expect(err).To(BeNil())
+
+				_, err = testAuth.Authenticate(context.Background(), credentials.Email, "correct horse battery", "")
+				Expect(err).ToNot(BeNil())
+			})
+
+			It("only accepts the token once", func() {
+				server.ServeHTTP(recorder, request)
+
+				body, _ := json.Marshal(PasswordResetView{Token: resetToken, NewPassword: "another horse battery staple"})
+				request, _ = http.NewRequest(
+					"POST", "/api/credentials/resets", bytes.NewReader(body))
+				request.Header.Set("content-type", "application/json")
+				recorder = httptest.NewRecorder()
+
+				server.ServeHTTP(recorder, request)
+				fmt.Printf("%v\n", recorder)
+				Expect(recorder.Code).To(Equal(400))
+			})
+
+			It("revokes tokens issued before the reset", func() {
+				server.ServeHTTP(recorder, request)
+
+				Expect(testAuth.ValidateToken(context.Background(), token)).To(Equal(false))
+			})
+		})
+
+		Context("with a new password that breaks the policy", func() {
+
+			BeforeEach(func() {
+				body, _ := json.Marshal(PasswordResetView{Token: resetToken, NewPassword: "aaaa"})
+				request, _ = http.NewRequest(
+					"POST", "/api/credentials/resets", bytes.NewReader(body))
+				request.Header.Set("content-type", "application/json")
+			})
+
+			It("returns a status code of 400 with an error for each rule", func() {
+				server.ServeHTTP(recorder, request)
+				fmt.Printf("%v\n", recorder)
+				Expect(recorder.Code).To(Equal(400))
+
+				var response ErrorResponse
+				json.Unmarshal(recorder.Body.Bytes(), &response)
+
+				Expect(response.Errors).To(HaveLen(2))
+				Expect(response.Errors[0].Code).To(Equal(ErrCodePasswordTooShort))
+				Expect(response.Errors[1].Code).To(Equal(ErrCodePasswordTooWeak))
+			})
+
+			It("leaves the token usable", func() {
+				server.ServeHTTP(recorder, request)
+
+				_, err := testAuth.ResetPassword(context.Background(), resetToken, "new horse battery staple")
+				Expect(err).To(BeNil())
+			})
+		})
+
+		Context("with the current password as the new one", func() {
+
+			BeforeEach(func() {
+				body, _ := json.Marshal(PasswordResetView{Token: resetToken, NewPassword: "correct horse battery"})
+				request, _ = http.NewRequest(
+					"POST", "/api/credentials/resets", bytes.NewReader(body))
+				request.Header.Set("content-type", "application/json")
+			})
+
+			It("returns a status code of 400 and leaves the token usable", func() {
+				server.ServeHTTP(recorder, request)
+				fmt.Printf("%v\n", recorder)
+				Expect(recorder.Code).To(Equal(400))
+
+				var response ErrorResponse
+				json.Unmarshal(recorder.Body.Bytes(), &response)
+
+				Expect(response.Errors).To(HaveLen(1))
+				Expect(response.Errors[0].Code).To(Equal(ErrCodePasswordReused))
+
+				_, err := testAuth.ResetPassword(context.Background(), resetToken, "new horse battery staple")
+				Expect(err).To(BeNil())
+			})
+		})
+
+		Context("with an expired token", func() {
+
+			BeforeEach(func() {
+				PasswordResetLifetime = -time.Minute
+				_, resetToken, _ = testAuth.RequestPasswordReset(context.Background(), credentials.Email)
+				PasswordResetLifetime = time.Hour
+
+				body, _ := json.Marshal(PasswordResetView{Token: resetToken, NewPassword: "new horse battery staple"})
+				request, _ = http.NewRequest(
+					"POST", "/api/credentials/resets", bytes.NewReader(body))
+				request.Header.Set("content-type", "application/json")
+			})
+
+			It("returns a status code of 400", func() {
+				server.ServeHTTP(recorder, request)
+				fmt.Printf("%v\n", recorder)
+				Expect(recorder.Code).To(Equal(400))
+			})
+		})
+	})
+
+	Describe("POST /emails/changerequests", func() {
+		var credentials *Credentials
+		var token string
+
+		requestChange := func(email string, password string) *httptest.ResponseRecorder {
+			body, _ := json.Marshal(EmailChangeRequestView{Email: email, Password: password})
+			request, _ := http.NewRequest(
+				"POST", "/api/emails/changerequests", bytes.NewReader(body))
+			request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+			request.Header.Set("content-type", "application/json")
+
+			recorder := httptest.NewRecorder()
+			server.ServeHTTP(recorder, request)
+			return recorder
+		}
+
+		confirmChange := func(code string) *httptest.ResponseRecorder {
+			body, _ := json.Marshal(EmailChangeConfirmationView{Code: code})
+			request, _ := http.NewRequest(
+				"POST", "/api/emails/changes", bytes.NewReader(body))
+			request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+			request.Header.Set("content-type", "application/json")
+
+			recorder := httptest.NewRecorder()
+			server.ServeHTTP(recorder, request)
+			return recorder
+		}
+
+		publishedCode := func() string {
+			Eventually(func() []DomainEvent {
+				return testPublisher.messages
+			}).Should(HaveLen(1))
+
+			message, _ := testPublisher.messages[0].(EmailChangeRequested)
+			return message.VerificationCode
+		}
+
+		BeforeEach(func() {
+			regView := gory.Build("userRegistrationDuplicate").(*UserRegistrationView)
+			credentials, _ = DecodeRegistrationDetails(regView)
+			credentials.Id = uuid.NewV4()
+			credentials.IsEmailVerified = true
+
+			repo.SaveCredentials(context.Background(), credentials.Id, credentials)
+
+			token, _ = testAuth.Authenticate(context.Background(), regView.Email, regView.Password, "")
+		})
+
+		It("requires the current password", func() {
+			Expect(requestChange("new@example.com", "wrong").Code).To(Equal(401))
+			Expect(requestChange("new@example.com", "").Code).To(Equal(400))
+		})
+
+		It("refuses an email that is already registered", func() {
+			taken := &Credentials{Id: uuid.NewV4(), Email: "taken@example.com"}
+			repo.SaveCredentials(context.Background(), taken.Id, taken)
+
+			recorder := requestChange("Taken@example.com", "correct horse battery")
+			Expect(recorder.Code).To(Equal(400))
+			Expect(mapFromJSON(recorder.Body.Bytes())["code"]).To(BeEquivalentTo(ErrCodeAlreadyExists))
+		})
+
+		It("notifies both addresses and keeps the old email until verified", func() {
+			Expect(requestChange("New@example.com", "correct horse battery").Code).To(Equal(202))
+
+			Eventually(func() []DomainEvent {
+				return testPublisher.messages
+			}).Should(HaveLen(1))
+
+			message, _ := testPublisher.messages[0].(EmailChangeRequested)
+			Expect(message.GetMessageType()).To(Equal("Email.Change.Requested"))
+			Expect(message.Email).To(Equal("latherton@example.com"))
+			Expect(message.NewEmail).To(Equal("new@example.com"))
+			Expect(message.VerificationCode).ToNot(BeEmpty())
+
+			saved, _ := repo.GetCredentials(context.Background(), credentials.Id)
+			Expect(saved.Email).To(Equal("latherton@example.com"))
+			Expect(saved.PendingEmail).To(Equal("new@example.com"))
+			Expect(saved.PendingEmailCodeHash).ToNot(Equal(message.VerificationCode))
+
+			_, err := testAuth.Authenticate(context.Background(), "latherton@example.com", "correct horse battery", "")
+			Expect(err).To(BeNil())
+		})
+
+		It("swaps the email and reissues tokens once verified", func() {
+			requestChange("new@example.com", "correct horse battery")
+			code := publishedCode()
+
+			recorder := confirmChange(code)
+			fmt.Printf("%v\n", recorder)
+			Expect(recorder.Code).To(Equal(200))
+
+			responseJSON := mapFromJSON(recorder.Body.Bytes())
+			Expect(responseJSON["email"]).To(Equal("new@example.com"))
+			Expect(testAuth.ValidateToken(context.Background(), responseJSON["token"].(string))).To(Equal(true))
+			Expect(testAuth.ValidateToken(context.Background(), token)).To(Equal(false))
+
+			_, err := testAuth.Authenticate(context.Background(), "new@example.com", "correct horse battery", "")
+			Expect(err).To(BeNil())
+
+			_, err = testAuth.Authenticate(context.Background(), "latherton@example.com", "correct horse battery", "")
+			Expect(err).ToNot(BeNil())
+
+			Eventually(func() []DomainEvent {
+				return testPublisher.messages
+			}).Should(HaveLen(2))
+
+			changed, _ := testPublisher.messages[1].(EmailChanged)
+			Expect(changed.GetMessageType()).To(Equal("Email.Changed"))
+			Expect(changed.Email).To(Equal("new@example.com"))
+			Expect(changed.OldEmail).To(Equal("latherton@example.com"))
+		})
+
+		It("refuses a wrong code", func() {
+			requestChange("new@example.com", "correct horse battery")
+			publishedCode()
+
+			Expect(confirmChange("wrong").Code).To(Equal(400))
+
+			saved, _ := repo.GetCredentials(context.Background(), credentials.Id)
+			Expect(saved.Email).To(Equal("latherton@example.com"))
+		})
+
+		It("refuses an expired code", func() {
+			EmailChangeLifetime = -time.Minute
+			defer func() { EmailChangeLifetime = time.Hour * 24 }()
+
+			requestChange("new@example.com", "correct horse battery")
+
+			Expect(confirmChange(publishedCode()).Code).To(Equal(400))
+		})
+
+		It("refuses the change if the email was registered in the meantime", func() {
+			requestChange("new@example.com", "correct horse battery")
+			code := publishedCode()
+
+			taken := &Credentials{Id: uuid.NewV4(), Email: "new@example.com"}
+			repo.SaveCredentials(context.Background(), taken.Id, taken)
+
+			Expect(confirmChange(code).Code).To(Equal(400))
+		})
+	})
+
+	Describe("Passwordless login links", func() {
+		var credentials *Credentials
+
+		BeforeEach(func() {
+			regView := gory.Build("userRegistrationDuplicate").(*UserRegistrationView)
+			credentials, _ = DecodeRegistrationDetails(regView)
+			credentials.Id = uuid.NewV4()
+
+			repo.SaveCredentials(context.Background(), credentials.Id, credentials)
+		})
+
+		redeem := func(view LoginLinkRedemptionView) *httptest.ResponseRecorder {
+			body, _ := json.Marshal(view)
+			redeemRequest, _ := http.NewRequest("POST", "/api/auth/links/redemptions", bytes.NewReader(body))
+			redeemRequest.Header.Set("content-type", "application/json")
+
+			redeemRecorder := httptest.NewRecorder()
+			server.ServeHTTP(redeemRecorder, redeemRequest)
+			fmt.Printf("%v\n", redeemRecorder)
+
+			return redeemRecorder
+		}
+
+		Context("POST /auth/links with missing email", func() {
+
+			It("returns a status code of 400", func() {
+				request, _ = http.NewRequest("POST", "/api/auth/links", bytes.NewReader([]byte("{}")))
+				request.Header.Set("content-type", "application/json")
+
+				server.ServeHTTP(recorder, request)
+				fmt.Printf("%v\n", recorder)
+				Expect(recorder.Code).To(Equal(400))
+			})
+		})
+
+		Context("POST /auth/links with a registered email", func() {
+
+			BeforeEach(func() {
+				body, _ := json.Marshal(LoginLinkRequestView{Email: "LAtherton@example.com"})
+				request, _ = http.NewRequest("POST", "/api/auth/links", bytes.NewReader(body))
+				request.Header.Set("content-type", "application/json")
+			})
+
+			It("publishes a login link requested event", func() {
+				server.ServeHTTP(recorder, request)
+				fmt.Printf("%v\n", recorder)
+				Expect(recorder.Code).To(Equal(202))
+
+				Eventually(func() []DomainEvent {
+					return testPublisher.messages
+				}).Should(HaveLen(1))
+
+				message, _ := testPublisher.messages[0].(LoginLinkRequested)
+				Expect(message.GetMessageType()).To(Equal("Login.Link.Requested"))
+				Expect(message.Email).To(Equal("latherton@example.com"))
+				Expect(message.LoginToken).ToNot(BeEmpty())
+				Expect(message.LoginCode).To(MatchRegexp("^[0-9]{6}$"))
+			})
+		})
+
+		Context("POST /auth/links with an unknown email", func() {
+
+			It("returns the same response without publishing an event", func() {
+				body, _ := json.Marshal(LoginLinkRequestView{Email: "nobody@example.com"})
+				request, _ = http.NewRequest("POST", "/api/auth/links", bytes.NewReader(body))
+				request.Header.Set("content-type", "application/json")
+
+				server.ServeHTTP(recorder, request)
+				fmt.Printf("%v\n", recorder)
+				Expect(recorder.Code).To(Equal(202))
+
+				Consistently(func() []DomainEvent {
+					return testPublisher.messages
+				}).Should(BeEmpty())
+			})
+		})
+
+		Context("POST /auth/links/redemptions", func() {
+			var linkToken string
+			var code string
+
+			BeforeEach(func() {
+				_, linkToken, code, _ = testAuth.RequestLoginLink(context.Background(), credentials.Email)
+			})
+
+			It("returns a status code of 400 without a token or code", func() {
+				Expect(redeem(LoginLinkRedemptionView{Email: credentials.Email}).Code).To(Equal(400))
+			})
+
+			It("issues a token for the link and verifies the email", func() {
+				redeemRecorder := redeem(LoginLinkRedemptionView{Token: linkToken})
+				Expect(redeemRecorder.Code).To(Equal(200))
+
+				responseJSON := mapFromJSON(redeemRecorder.Body.Bytes())
+				Expect(responseJSON["id"]).To(Equal(credentials.Id.String()))
+				Expect(testAuth.ValidateToken(context.Background(), responseJSON["token"].(string))).To(Equal(true))
+				Expect(responseJSON["refreshToken"]).ToNot(BeEmpty())
+
+				amr, _ := testAuth.GetTokenClaim(responseJSON["token"].(string), "amr")
+				Expect(amr).To(Equal([]interface{}{"email"}))
+
+				saved, _ := repo.GetCredentials(context.Background(), credentials.Id)
+				Expect(saved.IsEmailVerified).To(Equal(true))
+
+				Eventually(func() []DomainEvent {
+					return testPublisher.messages
+				}).Should(HaveLen(1))
+
+				message, _ := testPublisher.messages[0].(EmailVerified)
+				Expect(message.GetMessageType()).To(Equal("Email.Verified"))
+			})
+
+			It("does not accept a login link token as an access token", func() {
+				Expect(testAuth.ValidateToken(context.Background(), linkToken)).To(Equal(false))
+			})
+
+			It("issues a token for the code", func() {
+				Expect(redeem(LoginLinkRedemptionView{Email: "LAtherton@example.com", Code: code}).Code).To(Equal(200))
+			})
+
+			It("only accepts the link or the code once", func() {
+				Expect(redeem(LoginLinkRedemptionView{Token: linkToken}).Code).To(Equal(200))
+				Expect(redeem(LoginLinkRedemptionView{Token: linkToken}).Code).To(Equal(401))
+				Expect(redeem(LoginLinkRedemptionView{Email: credentials.Email, Code: code}).Code).To(Equal(401))
+			})
+
+			It("rejects a link that has been replaced", func() {
+				_, nextLinkToken, _, _ := testAuth.RequestLoginLink(context.Background(), credentials.Email)
+
+				Expect(redeem(LoginLinkRedemptionView{Token: linkToken}).Code).To(Equal(401))
+				Expect(redeem(LoginLinkRedemptionView{Token: nextLinkToken}).Code).To(Equal(200))
+			})
+
+			It("discards the link after too many wrong codes", func() {
+				for i := 0; i < LoginCodeMaxAttempts; i++ {
+					Expect(redeem(LoginLinkRedemptionView{Email: credentials.Email, Code: "not-it"}).Code).To(Equal(401))
+				}
+
+				Expect(redeem(LoginLinkRedemptionView{Email: credentials.Email, Code: code}).Code).To(Equal(401))
+				Expect(redeem(LoginLinkRedemptionView{Token: linkToken}).Code).To(Equal(401))
+			})
+
+			It("rejects an expired link", func() {
+				lifetime := LoginLinkLifetime
+				LoginLinkLifetime = -time.Minute
+				defer func() { LoginLinkLifetime = lifetime }()
+
+				_, expiredLinkToken, expiredCode, _ := testAuth.RequestLoginLink(context.Background(), credentials.Email)
+
+				Expect(redeem(LoginLinkRedemptionView{Email: credentials.Email, Code: expiredCode}).Code).To(Equal(401))
+				Expect(redeem(LoginLinkRedemptionView{Token: expiredLinkToken}).Code).To(Equal(401))
+			})
+
+			Context("with TOTP enabled", func() {
+				var secret string
+
+				BeforeEach(func() {
+					secret, _, _ = testAuth.EnrollTOTP(context.Background(), credentials.Id)
+					totpCode, _ := GenerateTOTPCode(secret, time.Now())
+					testAuth.ConfirmTOTP(context.Background(), credentials.Id, totpCode)
+				})
+
+				It("returns an mfa challenge recording the login link", func() {
+					redeemRecorder := redeem(LoginLinkRedemptionView{Token: linkToken})
+					Expect(redeemRecorder.Code).To(Equal(401))
+
+					mfaToken := mapFromJSON(redeemRecorder.Body.Bytes())["mfaToken"].(string)
+					totpCode, _ := GenerateTOTPCode(secret, time.Now().Add(TOTPPeriod))
+
+					token, _, err := testAuth.CompleteMFA(context.Background(), mfaToken, totpCode)
+					Expect(err).To(BeNil())
+
+					amr, _ := testAuth.GetTokenClaim(token, "amr")
+					Expect(amr).To(ConsistOf("email", "otp", "mfa"))
+				})
+
+				It("publishes an email verified event with the challenge", func() {
+					Expect(redeem(LoginLinkRedemptionView{Token: linkToken}).Code).To(Equal(401))
+
+					Eventually(func() []DomainEvent {
+						return testPublisher.messages
+					}).Should(HaveLen(1))
+
+					message, _ := testPublisher.messages[0].(EmailVerified)
+					Expect(message.GetMessageType()).To(Equal("Email.Verified"))
+					Expect(message.Id).To(Equal(credentials.Id))
+					Expect(message.Email).To(Equal("latherton@example.com"))
+				})
+			})
+		})
+	})
+
+	Describe("TOTP two-factor authentication", func() {
+		var credentials *Credentials
+		var token string
+
+		BeforeEach(func() {
+			regView := gory.Build("userRegistrationDuplicate").(*UserRegistrationView)
+			credentials, _ = DecodeRegistrationDetails(regView)
+			credentials.Id = uuid.NewV4()
+
+			repo.SaveCredentials(context.Background(), credentials.Id, credentials)
+
+			token, _ = testAuth.Authenticate(context.Background(), regView.Email, regView.Password, "")
+		})
+
+		It("records the password as the only factor used", func() {
+			amr, _ := testAuth.GetTokenClaim(token, "amr")
+			Expect(amr).To(Equal([]interface{}{"pwd"}))
+		})
+
+		Context("POST /mfa/totp without a token", func() {
+
+			It("returns a status code of 401", func() {
+				request, _ = http.NewRequest("POST", "/api/mfa/totp", nil)
+
+				server.ServeHTTP(recorder, request)
+				fmt.Printf("%v\n", recorder)
+				Expect(recorder.Code).To(Equal(401))
+			})
+		})
+
+		Context("POST /mfa/totp", func() {
+
+			BeforeEach(func() {
+				request, _ = http.NewRequest("POST", "/api/mfa/totp", nil)
+				request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+			})
+
+			It("returns a secret and an otpauth uri", func() {
+				server.ServeHTTP(recorder, request)
+				fmt.Printf("%v\n", recorder)
+				Expect(recorder.Code).To(Equal(201))
+
+				responseJSON := mapFromJSON(recorder.Body.Bytes())
+				Expect(responseJSON["secret"]).ToNot(BeEmpty())
+				Expect(responseJSON["uri"]).To(HavePrefix("otpauth://totp/auth.example.com:latherton@example.com?"))
+				Expect(responseJSON["uri"]).To(ContainSubstring("secret=" + responseJSON["secret"].(string)))
+			})
+
+			It("does not require a code to log in until confirmed", func() {
+				server.ServeHTTP(recorder, request)
+
+				_, err := testAuth.Authenticate(context.Background(), credentials.Email, "correct horse battery", "")
+				Expect(err).To(BeNil())
+			})
+		})
+
+		Context("POST /mfa/totp/confirm", func() {
+			var secret string
+
+			BeforeEach(func() {
+				secret, _, _ = testAuth.EnrollTOTP(context.Background(), credentials.Id)
+			})
+
+			It("rejects the wrong code", func() {
+				body, _ := json.Marshal(TOTPConfirmationView{Code: "000000"})
+				request, _ = http.NewRequest("POST", "/api/mfa/totp/confirm", bytes.NewReader(body))
+				request.Header.Set("content-type", "application/json")
+				request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+
+				server.ServeHTTP(recorder, request)
+				fmt.Printf("%v\n", recorder)
+				Expect(recorder.Code).To(Equal(400))
+			})
+
+			It("enables TOTP with a valid code", func() {
+				code, _ := GenerateTOTPCode(secret, time.Now())
+				body, _ := json.Marshal(TOTPConfirmationView{Code: code})
+				request, _ = http.NewRequest("POST", "/api/mfa/totp/confirm", bytes.NewReader(body))
+				request.Header.Set("content-type", "application/json")
+				request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+
+				server.ServeHTTP(recorder, request)
+				fmt.Printf("%v\n", recorder)
+				Expect(recorder.Code).To(Equal(200))
+
+				responseJSON := mapFromJSON(recorder.Body.Bytes())
+				Expect(responseJSON["recoveryCodes"]).To(HaveLen(10))
+
+				_, err := testAuth.Authenticate(context.Background(), credentials.Email, "correct horse battery", "")
+				Expect(err).To(Equal(ErrMFARequired))
+			})
+		})
+
+		Context("with TOTP enabled", func() {
+			var secret string
+			var recoveryCodes []string
+
+			BeforeEach(func() {
+				secret, _, _ = testAuth.EnrollTOTP(context.Background(), credentials.Id)
+				code, _ := GenerateTOTPCode(secret, time.Now())
+				recoveryCodes, _ = testAuth.ConfirmTOTP(context.Background(), credentials.Id, code)
 
 				body, _ := json.Marshal(
 					gory.Build("loginValid"))
@@ -399,163 +2805,542 @@ var _ = Describe("Auth Server", func() {
 				request.Header.Set("content-type", "application/json")
 			})
 
-			It("returns a status code of 200", func() {
+			completeMFA := func(mfaToken string, code string) *httptest.ResponseRecorder {
+				body, _ := json.Marshal(MFAView{MfaToken: mfaToken, Code: code})
+				mfaRequest, _ := http.NewRequest("POST", "/api/auth/mfa", bytes.NewReader(body))
+				mfaRequest.Header.Set("content-type", "application/json")
+
+				mfaRecorder := httptest.NewRecorder()
+				server.ServeHTTP(mfaRecorder, mfaRequest)
+				fmt.Printf("%v\n", mfaRecorder)
+
+				return mfaRecorder
+			}
+
+			It("returns an mfa challenge instead of a token", func() {
 				server.ServeHTTP(recorder, request)
 				fmt.Printf("%v\n", recorder)
-				Expect(recorder.Code).To(Equal(200))
+				Expect(recorder.Code).To(Equal(401))
+
+				responseJSON := mapFromJSON(recorder.Body.Bytes())
+				Expect(responseJSON["mfaRequired"]).To(Equal(true))
+				Expect(responseJSON["token"]).To(BeNil())
+				Expect(testAuth.ValidateToken(context.Background(), responseJSON["mfaToken"].(string))).To(Equal(false))
 			})
 
-			It("returns the user info", func() {
+			It("issues a token recording both factors once the code is supplied", func() {
 				server.ServeHTTP(recorder, request)
-				fmt.Printf("%v\n", recorder)
+				mfaToken := mapFromJSON(recorder.Body.Bytes())["mfaToken"].(string)
 
-				responseJSON := mapFromJSON(recorder.Body.Bytes())
+				code, _ := GenerateTOTPCode(secret, time.Now().Add(TOTPPeriod))
+				mfaRecorder := completeMFA(mfaToken, code)
+				Expect(mfaRecorder.Code).To(Equal(200))
 
-				token := strings.Replace(responseJSON["token"].(string), "\"", "", -1)
-				token = strings.Trim(token, "\r\n")
+				responseJSON := mapFromJSON(mfaRecorder.Body.Bytes())
+				Expect(testAuth.ValidateToken(context.Background(), responseJSON["token"].(string))).To(Equal(true))
+				Expect(responseJSON["refreshToken"]).ToNot(BeEmpty())
 
-				Expect(testAuth.ValidateToken(token)).To(Equal(true))
+				amr, _ := testAuth.GetTokenClaim(responseJSON["token"].(string), "amr")
+				Expect(amr).To(ConsistOf("pwd", "otp", "mfa"))
+			})
 
-				// token := strings.Split(responseJSON["token"], ".")
+			It("rejects the wrong code", func() {
+				server.ServeHTTP(recorder, request)
+				mfaToken := mapFromJSON(recorder.Body.Bytes())["mfaToken"].(string)
 
-				// userInfo := token[1]
+				Expect(completeMFA(mfaToken, "000000").Code).To(Equal(401))
+			})
 
-				// //this fixes an issue decoding part of the token
-				// if l := len(userInfo) % 4; l > 0 {
-				// 	userInfo += strings.Repeat("=", 4-l)
-				// }
+			// rewind moves the last failure back in time, so the delay before the
+			// next attempt has passed.
+			rewind := func() {
+				saved, _ := repo.GetCredentials(context.Background(), credentials.Id)
+				saved.LastFailedLoginDate = saved.LastFailedLoginDate.Add(-time.Hour)
+				repo.SaveCredentials(context.Background(), credentials.Id, saved)
+			}
 
-				// response, err := base64.URLEncoding.DecodeString(userInfo)
-				// if err != nil {
-				// 	panic(err)
-				// 	return
-				// }
+			It("revokes the challenge after too many wrong codes", func() {
+				server.ServeHTTP(recorder, request)
+				mfaToken := mapFromJSON(recorder.Body.Bytes())["mfaToken"].(string)
 
-				Expect(responseJSON["id"]).To(Equal(credentials.Id.String()))
+				for i := 0; i < MFACodeMaxAttempts; i++ {
+					rewind()
+					Expect(completeMFA(mfaToken, "000000").Code).To(Equal(401))
+				}
+
+				rewind()
+				code, _ := GenerateTOTPCode(secret, time.Now().Add(TOTPPeriod))
+				Expect(completeMFA(mfaToken, code).Code).To(Equal(401))
+
+				nextMfaToken, _ := testAuth.Authenticate(context.Background(), credentials.Email, "correct horse battery", "")
+				Expect(completeMFA(nextMfaToken, code).Code).To(Equal(200))
 			})
 
-			// Measure("authentication should take less than 400ms", func(b Benchmarker) {
-			// 	runtime := b.Time("runtime", func() {
-			// 		server.ServeHTTP(recorder, request)
-			// 		Expect(recorder.Code).To(Equal(200))
-			// 	})
+			It("refuses the right code during the delay after repeated wrong codes", func() {
+				server.ServeHTTP(recorder, request)
+				mfaToken := mapFromJSON(recorder.Body.Bytes())["mfaToken"].(string)
 
-			// 	Ω(runtime.Seconds()).Should(BeNumerically("<", 0.4), "authentication shouldn't take longer than 400ms.")
+				for i := 0; i < LoginDelayThreshold; i++ {
+					completeMFA(mfaToken, "000000")
+				}
 
-			// 	//b.RecordValue("disk usage (in MB)", HowMuchDiskSpaceDidYouUse())
-			// }, 10)
+				code, _ := GenerateTOTPCode(secret, time.Now().Add(TOTPPeriod))
+				Expect(completeMFA(mfaToken, code).Code).To(Equal(401))
+
+				rewind()
+				Expect(completeMFA(mfaToken, code).Code).To(Equal(200))
+
+				saved, _ := repo.GetCredentials(context.Background(), credentials.Id)
+				Expect(saved.FailedLoginAttempts).To(Equal(0))
+			})
+
+			It("locks the account after too many wrong codes", func() {
+				for i := 0; i < LockoutThreshold; i++ {
+					rewind()
+					mfaToken, _ := testAuth.Authenticate(context.Background(), credentials.Email, "correct horse battery", "")
+					Expect(completeMFA(mfaToken, "000000").Code).To(Equal(401))
+				}
+
+				saved, _ := repo.GetCredentials(context.Background(), credentials.Id)
+				Expect(saved.LockedUntil).To(BeTemporally(">", time.Now()))
+
+				_, err := testAuth.Authenticate(context.Background(), credentials.Email, "correct horse battery", "")
+				Expect(err).To(Equal(ErrInvalidPassword))
+
+				Eventually(func() []DomainEvent {
+					return testPublisher.messages
+				}).Should(HaveLen(1))
+
+				message, _ := testPublisher.messages[0].(AccountLocked)
+				Expect(message.Id).To(Equal(credentials.Id))
+				Expect(message.Email).To(Equal("latherton@example.com"))
+			})
+
+			It("only accepts each challenge and code once", func() {
+				server.ServeHTTP(recorder, request)
+				mfaToken := mapFromJSON(recorder.Body.Bytes())["mfaToken"].(string)
+
+				code, _ := GenerateTOTPCode(secret, time.Now().Add(TOTPPeriod))
+				Expect(completeMFA(mfaToken, code).Code).To(Equal(200))
+				Expect(completeMFA(mfaToken, code).Code).To(Equal(401))
+
+				nextMfaToken, _ := testAuth.Authenticate(context.Background(), credentials.Email, "correct horse battery", "")
+				Expect(completeMFA(nextMfaToken, code).Code).To(Equal(401))
+			})
+
+			It("accepts a recovery code in place of a TOTP code", func() {
+				server.ServeHTTP(recorder, request)
+				mfaToken := mapFromJSON(recorder.Body.Bytes())["mfaToken"].(string)
+
+				mfaRecorder := completeMFA(mfaToken, recoveryCodes[0])
+				Expect(mfaRecorder.Code).To(Equal(200))
+
+				responseJSON := mapFromJSON(mfaRecorder.Body.Bytes())
+				Expect(testAuth.ValidateToken(context.Background(), responseJSON["token"].(string))).To(Equal(true))
+			})
+
+			It("ignores case and separators in recovery codes", func() {
+				mfaToken, _ := testAuth.Authenticate(context.Background(), credentials.Email, "correct horse battery", "")
+				code := strings.ToUpper(strings.Replace(recoveryCodes[3], "-", " ", -1))
+
+				Expect(completeMFA(mfaToken, code).Code).To(Equal(200))
+			})
+
+			It("only accepts each recovery code once", func() {
+				mfaToken, _ := testAuth.Authenticate(context.Background(), credentials.Email, "correct horse battery", "")
+				Expect(completeMFA(mfaToken, recoveryCodes[0]).Code).To(Equal(200))
+
+				nextMfaToken, _ := testAuth.Authenticate(context.Background(), credentials.Email, "correct horse battery", "")
+				Expect(completeMFA(nextMfaToken, recoveryCodes[0]).Code).To(Equal(401))
+
+				lastMfaToken, _ := testAuth.Authenticate(context.Background(), credentials.Email, "correct horse battery", "")
+				Expect(completeMFA(lastMfaToken, recoveryCodes[1]).Code).To(Equal(200))
+			})
+
+			It("publishes a recovery code used event", func() {
+				mfaToken, _ := testAuth.Authenticate(context.Background(), credentials.Email, "correct horse battery", "")
+				completeMFA(mfaToken, recoveryCodes[0])
+
+				Eventually(func() []DomainEvent {
+					return testPublisher.messages
+				}).Should(HaveLen(1))
+
+				message, _ := testPublisher.messages[0].(RecoveryCodeUsed)
+				Expect(message.GetMessageType()).To(Equal("Mfa.RecoveryCode.Used"))
+				Expect(message.Id).To(Equal(credentials.Id))
+				Expect(message.Email).To(Equal("latherton@example.com"))
+			})
+
+			It("does not publish an event for a TOTP code", func() {
+				mfaToken, _ := testAuth.Authenticate(context.Background(), credentials.Email, "correct horse battery", "")
+				code, _ := GenerateTOTPCode(secret, time.Now().Add(TOTPPeriod))
+				Expect(completeMFA(mfaToken, code).Code).To(Equal(200))
+
+				Consistently(func() []DomainEvent {
+					return testPublisher.messages
+				}).Should(BeEmpty())
+			})
+
+			Context("POST /mfa/recoverycodes", func() {
+
+				It("replaces the recovery codes", func() {
+					regenerateRequest, _ := http.NewRequest("POST", "/api/mfa/recoverycodes", nil)
+					regenerateRequest.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+
+					server.ServeHTTP(recorder, regenerateRequest)
+					fmt.Printf("%v\n", recorder)
+					Expect(recorder.Code).To(Equal(201))
+
+					newCodes := mapFromJSON(recorder.Body.Bytes())["recoveryCodes"].([]interface{})
+					Expect(newCodes).To(HaveLen(10))
+
+					mfaToken, _ := testAuth.Authenticate(context.Background(), credentials.Email, "correct horse battery", "")
+					Expect(completeMFA(mfaToken, recoveryCodes[0]).Code).To(Equal(401))
+					Expect(completeMFA(mfaToken, newCodes[0].(string)).Code).To(Equal(200))
+				})
+			})
 		})
 
+		Context("POST /mfa/recoverycodes without TOTP enabled", func() {
+
+			It("returns a status code of 400", func() {
+				request, _ = http.NewRequest("POST", "/api/mfa/recoverycodes", nil)
+				request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+
+				server.ServeHTTP(recorder, request)
+				fmt.Printf("%v\n", recorder)
+				Expect(recorder.Code).To(Equal(400))
+			})
+		})
 	})
 
-	Describe("POST /credentials/updaterequests", func() {
+	Describe("WebAuthn passkeys", func() {
 		var credentials *Credentials
 		var token string
+		var passkey *softAuthenticator
 
 		BeforeEach(func() {
-			regView := gory.Build("userRegistration").(*UserRegistrationView)
+			regView := gory.Build("userRegistrationDuplicate").(*UserRegistrationView)
 			credentials, _ = DecodeRegistrationDetails(regView)
 			credentials.Id = uuid.NewV4()
-			credentials.IsEmailVerified = true
 
-			repo.SaveCredentials(credentials.Id, credentials)
+			repo.SaveCredentials(context.Background(), credentials.Id, credentials)
 
-			token, _ = testAuth.Authenticate(regView.Email, regView.Password, "")
+			token, _ = testAuth.Authenticate(context.Background(), regView.Email, regView.Password, "")
+			passkey = newSoftAuthenticator()
 		})
 
-		Context("with invalid JSON", func() {
+		post := func(uri string, view interface{}, bearer string) *httptest.ResponseRecorder {
+			body, _ := json.Marshal(view)
+			postRequest, _ := http.NewRequest("POST", uri, bytes.NewReader(body))
+			postRequest.Header.Set("content-type", "application/json")
+			if bearer != "" {
+				postRequest.Header.Set("Authorization", fmt.Sprintf("Bearer %s", bearer))
+			}
 
-			// Create a POST request using JSON from our invalid
-			// factory object before each test in this context.
-			BeforeEach(func() {
-				body, _ := json.Marshal(
-					gory.Build("passwordChangeRequestMissingInfo"))
-				request, _ = http.NewRequest(
-					"POST", "/api/credentials/updaterequests", bytes.NewReader(body))
-				request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
-				request.Header.Set("content-type", "application/json")
+			postRecorder := httptest.NewRecorder()
+			server.ServeHTTP(postRecorder, postRequest)
+			fmt.Printf("%v\n", postRecorder)
+
+			return postRecorder
+		}
+
+		beginRegistration := func() *WebAuthnCreationResponse {
+			var options *WebAuthnCreationResponse
+			json.Unmarshal(post("/api/webauthn/registrations/begin", nil, token).Body.Bytes(), &options)
+			return options
+		}
+
+		beginLogin := func(email string) *WebAuthnRequestResponse {
+			var options *WebAuthnRequestResponse
+			json.Unmarshal(post("/api/webauthn/logins/begin", WebAuthnLoginRequestView{Email: email}, "").Body.Bytes(), &options)
+			return options
+		}
+
+		Context("POST /webauthn/registrations/begin without a token", func() {
+
+			It("returns a status code of 401", func() {
+				Expect(post("/api/webauthn/registrations/begin", nil, "").Code).To(Equal(401))
 			})
+		})
 
-			It("returns a status code of 400", func() {
-				server.ServeHTTP(recorder, request)
-				fmt.Printf("%v\n", recorder)
-				Expect(recorder.Code).To(Equal(400))
+		Context("POST /webauthn/registrations/begin", func() {
+
+			It("returns creation options for the relying party", func() {
+				options := beginRegistration()
+
+				Expect(options.SessionToken).ToNot(BeEmpty())
+				Expect(options.PublicKey.Challenge).ToNot(BeEmpty())
+				Expect(options.PublicKey.RelyingParty.Id).To(Equal("auth.example.com"))
+				Expect(options.PublicKey.User.Name).To(Equal(credentials.Email))
+				Expect(options.PublicKey.AuthenticatorSelection.UserVerification).To(Equal("required"))
+				Expect(testAuth.ValidateToken(context.Background(), options.SessionToken)).To(Equal(false))
 			})
 		})
 
-		Context("with invalid password", func() {
+		Context("POST /webauthn/registrations/finish", func() {
 
-			// Create a POST request using JSON from our invalid
-			// factory object before each test in this context.
-			BeforeEach(func() {
-				body, _ := json.Marshal(
-					gory.Build("passwordChangeRequestWrongPassword"))
-				request, _ = http.NewRequest(
-					"POST", "/api/credentials/updaterequests", bytes.NewReader(body))
-				request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
-				request.Header.Set("content-type", "application/json")
+			It("registers a passkey with no attestation", func() {
+				options := beginRegistration()
+				view := passkey.register(options, "https://auth.example.com", "none")
+
+				Expect(post("/api/webauthn/registrations/finish", view, token).Code).To(Equal(201))
+
+				saved, _ := repo.GetCredentials(context.Background(), credentials.Id)
+				Expect(saved.WebAuthnCredentials).To(HaveLen(1))
+				Expect(saved.WebAuthnCredentials[0].CredentialId).To(Equal(passkey.credentialId))
+				Expect(saved.WebAuthnCredentials[0].Name).To(Equal("test key"))
 			})
 
-			It("returns a status code of 401", func() {
-				server.ServeHTTP(recorder, request)
-				fmt.Printf("%v\n", recorder)
-				Expect(recorder.Code).To(Equal(401))
+			It("registers a passkey with packed self attestation", func() {
+				options := beginRegistration()
+				view := passkey.register(options, "https://auth.example.com", "packed")
+
+				Expect(post("/api/webauthn/registrations/finish", view, token).Code).To(Equal(201))
+			})
+
+			It("rejects a response from another origin", func() {
+				options := beginRegistration()
+				view := passkey.register(options, "https://evil.example.com", "none")
+
+				Expect(post("/api/webauthn/registrations/finish", view, token).Code).To(Equal(400))
+			})
+
+			It("only accepts each session once", func() {
+				options := beginRegistration()
+				view := passkey.register(options, "https://auth.example.com", "none")
+
+				Expect(post("/api/webauthn/registrations/finish", view, token).Code).To(Equal(201))
+				Expect(post("/api/webauthn/registrations/finish", view, token).Code).To(Equal(400))
+			})
+
+			It("rejects a credential that is already registered", func() {
+				Expect(post("/api/webauthn/registrations/finish", passkey.register(beginRegistration(), "https://auth.example.com", "none"), token).Code).To(Equal(201))
+				Expect(post("/api/webauthn/registrations/finish", passkey.register(beginRegistration(), "https://auth.example.com", "none"), token).Code).To(Equal(400))
 			})
 		})
 
-		Context("with valid JSON", func() {
+		Context("with a registered passkey", func() {
 
-			// Create a POST request with valid JSON from
-			// our factory before each test in this context.
 			BeforeEach(func() {
-				body, _ := json.Marshal(
-					gory.Build("passwordChangeRequest"))
-				request, _ = http.NewRequest(
-					"POST", "/api/credentials/updaterequests", bytes.NewReader(body))
-				request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
-				request.Header.Set("content-type", "application/json")
+				view := passkey.register(beginRegistration(), "https://auth.example.com", "none")
+				Expect(testAuth.FinishWebAuthnRegistration(context.Background(), credentials.Id, view)).To(BeNil())
 			})
 
-			It("returns a status code of 201", func() {
-				server.ServeHTTP(recorder, request)
-				fmt.Printf("%v\n", recorder)
-				Expect(recorder.Code).To(Equal(201))
+			It("lists the passkey when beginning a login by email", func() {
+				options := beginLogin(credentials.Email)
+
+				Expect(options.PublicKey.RelyingPartyId).To(Equal("auth.example.com"))
+				Expect(options.PublicKey.AllowCredentials).To(HaveLen(1))
+				Expect(options.PublicKey.AllowCredentials[0].Id).To(Equal(base64.RawURLEncoding.EncodeToString(passkey.credentialId)))
 			})
 
-			It("returns the user info", func() {
-				server.ServeHTTP(recorder, request)
-				fmt.Printf("%v\n", recorder)
+			It("issues a token recording the hardware key", func() {
+				view := passkey.assert(beginLogin(credentials.Email), "https://auth.example.com", true)
 
-				responseJSON := mapFromJSON(recorder.Body.Bytes())
+				loginRecorder := post("/api/webauthn/logins/finish", view, "")
+				Expect(loginRecorder.Code).To(Equal(200))
 
-				token := strings.Replace(responseJSON["token"].(string), "\"", "", -1)
-				token = strings.Trim(token, "\r\n")
+				responseJSON := mapFromJSON(loginRecorder.Body.Bytes())
+				Expect(responseJSON["id"]).To(Equal(credentials.Id.String()))
+				Expect(testAuth.ValidateToken(context.Background(), responseJSON["token"].(string))).To(Equal(true))
+				Expect(responseJSON["refreshToken"]).ToNot(BeEmpty())
 
-				Expect(testAuth.ValidateToken(token)).To(Equal(true))
+				amr, _ := testAuth.GetTokenClaim(responseJSON["token"].(string), "amr")
+				Expect(amr).To(ConsistOf("hwk", "mfa"))
+			})
 
-				// token := strings.Replace(recorder.Body.String(), "\"", "", -1)
-				// token = strings.Trim(token, "\r\n")
+			It("accepts a discoverable credential without an email", func() {
+				view := passkey.assert(beginLogin(""), "https://auth.example.com", true)
+
+				Expect(post("/api/webauthn/logins/finish", view, "").Code).To(Equal(200))
+			})
 
-				// Expect(testAuth.ValidateToken(token)).To(Equal(true))
+			It("rejects an assertion without user verification", func() {
+				view := passkey.assert(beginLogin(credentials.Email), "https://auth.example.com", false)
 
-				// responseArray := strings.Split(recorder.Body.String(), ".")
+				Expect(post("/api/webauthn/logins/finish", view, "").Code).To(Equal(401))
+			})
 
-				// userInfo := responseArray[1]
+			It("rejects an assertion signed by another key", func() {
+				impostor := newSoftAuthenticator()
+				impostor.credentialId = passkey.credentialId
+				impostor.signCount = passkey.signCount
+				view := impostor.assert(beginLogin(credentials.Email), "https://auth.example.com", true)
 
-				// //this fixes an issue decoding part of the token
-				// if l := len(userInfo) % 4; l > 0 {
-				// 	userInfo += strings.Repeat("=", 4-l)
-				// }
+				Expect(post("/api/webauthn/logins/finish", view, "").Code).To(Equal(401))
+			})
 
-				// response, err := base64.URLEncoding.DecodeString(userInfo)
-				// if err != nil {
-				// 	panic(err)
-				// 	return
-				// }
+			It("rejects a signature counter that does not increase", func() {
+				view := passkey.assert(beginLogin(credentials.Email), "https://auth.example.com", true)
+				Expect(post("/api/webauthn/logins/finish", view, "").Code).To(Equal(200))
 
-				// responseJSON := mapFromJSON(response)
-				Expect(responseJSON["id"]).ToNot(Equal(""))
+				passkey.signCount--
+				view = passkey.assert(beginLogin(credentials.Email), "https://auth.example.com", true)
+				Expect(post("/api/webauthn/logins/finish", view, "").Code).To(Equal(401))
+			})
+
+			It("only accepts each session once", func() {
+				view := passkey.assert(beginLogin(credentials.Email), "https://auth.example.com", true)
+
+				Expect(post("/api/webauthn/logins/finish", view, "").Code).To(Equal(200))
+				Expect(post("/api/webauthn/logins/finish", view, "").Code).To(Equal(401))
 			})
 		})
 	})
 })
+
+/*
+A software WebAuthn authenticator holding a single ES256 credential.
+*/
+type softAuthenticator struct {
+	key          *ecdsa.PrivateKey
+	credentialId []byte
+	signCount    uint32
+}
+
+func newSoftAuthenticator() *softAuthenticator {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	credentialId := make([]byte, 16)
+	rand.Read(credentialId)
+
+	return &softAuthenticator{key: key, credentialId: credentialId}
+}
+
+func (a *softAuthenticator) clientData(ceremony string, challenge string, origin string) []byte {
+	clientDataJSON, _ := json.Marshal(map[string]interface{}{"type": ceremony, "challenge": challenge, "origin": origin})
+	return clientDataJSON
+}
+
+func (a *softAuthenticator) authData(rpId string, flags byte, attested bool) []byte {
+	rpIdHash := sha256.Sum256([]byte(rpId))
+
+	authData := append([]byte{}, rpIdHash[:]...)
+	authData = append(authData, flags)
+	authData = binary.BigEndian.AppendUint32(authData, a.signCount)
+
+	if attested {
+		publicKey, _ := cbor.Marshal(map[int]interface{}{
+			1:  2,
+			3:  -7,
+			-1: 1,
+			-2: a.key.X.FillBytes(make([]byte, 32)),
+			-3: a.key.Y.FillBytes(make([]byte, 32)),
+		})
+
+		authData = append(authData, make([]byte, 16)...)
+		authData = binary.BigEndian.AppendUint16(authData, uint16(len(a.credentialId)))
+		authData = append(authData, a.credentialId...)
+		authData = append(authData, publicKey...)
+	}
+
+	return authData
+}
+
+func (a *softAuthenticator) sign(authData []byte, clientDataJSON []byte) []byte {
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	digest := sha256.Sum256(append(append([]byte{}, authData...), clientDataHash[:]...))
+	signature, _ := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	return signature
+}
+
+func (a *softAuthenticator) register(options *WebAuthnCreationResponse, origin string, format string) *WebAuthnRegistrationView {
+	clientDataJSON := a.clientData("webauthn.create", options.PublicKey.Challenge, origin)
+	authData := a.authData(options.PublicKey.RelyingParty.Id, 0x45, true)
+
+	attStmt := map[string]interface{}{}
+	if format == "packed" {
+		attStmt = map[string]interface{}{"alg": -7, "sig": a.sign(authData, clientDataJSON)}
+	}
+
+	attestationObject, _ := cbor.Marshal(map[string]interface{}{"fmt": format, "attStmt": attStmt, "authData": authData})
+
+	return &WebAuthnRegistrationView{
+		SessionToken: options.SessionToken,
+		Name:         "test key",
+		Credential: WebAuthnPublicKeyCredential{
+			Id:    base64.RawURLEncoding.EncodeToString(a.credentialId),
+			RawId: base64.RawURLEncoding.EncodeToString(a.credentialId),
+			Type:  "public-key",
+			Response: WebAuthnAuthenticatorResponse{
+				ClientDataJSON:    base64.RawURLEncoding.EncodeToString(clientDataJSON),
+				AttestationObject: base64.RawURLEncoding.EncodeToString(attestationObject),
+			},
+		},
+	}
+}
+
+func (a *softAuthenticator) assert(options *WebAuthnRequestResponse, origin string, verified bool) *WebAuthnLoginView {
+	a.signCount++
+
+	flags := byte(0x01)
+	if verified {
+		flags |= 0x04
+	}
+
+	clientDataJSON := a.clientData("webauthn.get", options.PublicKey.Challenge, origin)
+	authData := a.authData(options.PublicKey.RelyingPartyId, flags, false)
+
+	return &WebAuthnLoginView{
+		SessionToken: options.SessionToken,
+		Credential: WebAuthnPublicKeyCredential{
+			Id:    base64.RawURLEncoding.EncodeToString(a.credentialId),
+			RawId: base64.RawURLEncoding.EncodeToString(a.credentialId),
+			Type:  "public-key",
+			Response: WebAuthnAuthenticatorResponse{
+				ClientDataJSON:    base64.RawURLEncoding.EncodeToString(clientDataJSON),
+				AuthenticatorData: base64.RawURLEncoding.EncodeToString(authData),
+				Signature:         base64.RawURLEncoding.EncodeToString(a.sign(authData, clientDataJSON)),
+			},
+		},
+	}
+}
+
+/*
+A rate limit store that is always unavailable.
+*/
+type failingRateLimitStore struct{}
+
+func (failingRateLimitStore) Take(key string, burst int, interval time.Duration) (bool, time.Duration, error) {
+	return false, 0, fmt.Errorf("store unavailable")
+}
+
+/*
+The upper case hex SHA-1 of a password, as in breach corpora.
+*/
+func breachHash(password string) string {
+	hash := sha1.Sum([]byte(password))
+	return strings.ToUpper(hex.EncodeToString(hash[:]))
+}
+
+/*
+A repo that runs change once credentials are first read, as if another
+request saved a change straight afterwards.
+*/
+type changingRepo struct {
+	TestRepo
+	change func()
+}
+
+func (repo *changingRepo) GetCredentials(ctx context.Context, userId uuid.UUID) (*Credentials, error) {
+	credentials, err := repo.TestRepo.GetCredentials(ctx, userId)
+
+	if change := repo.change; change != nil {
+		repo.change = nil
+		change()
+	}
+
+	return credentials, err
+}
+
+/*
+A repo that refuses every credentials save, as if another request had always
+just changed them.
+*/
+type conflictingRepo struct {
+	TestRepo
+}
+
+func (repo *conflictingRepo) SaveCredentials(ctx context.Context, userId uuid.UUID, credentials *Credentials) error {
+	return ErrConflict
+}
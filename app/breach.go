@@ -0,0 +1,192 @@
+// Copyright (c) Luke Atherton 2015
+
+package authenticator
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const breachPrefixBits = 20
+
+var (
+	ErrInvalidBreachCorpus = errors.New("Breach Corpus Failed: Invalid line.")
+)
+
+// A BreachCorpus holds SHA-1 password hashes from known breaches with the
+// number of times each was seen. Hashes are kept sorted with a fanout table
+// over their first five hex digits, the same buckets the Have I Been Pwned
+// range API uses, so a lookup is a binary search of one small bucket.
+type BreachCorpus struct {
+	hashes [][sha1.Size]byte
+	counts []uint32
+	fanout []uint32
+}
+
+// breachOrder sorts a corpus by hash, keeping each count with its hash.
+type breachOrder struct {
+	*BreachCorpus
+}
+
+func (order breachOrder) Less(i, j int) bool {
+	return bytes.Compare(order.hashes[i][:], order.hashes[j][:]) < 0
+}
+
+func (order breachOrder) Swap(i, j int) {
+	order.hashes[i], order.hashes[j] = order.hashes[j], order.hashes[i]
+	order.counts[i], order.counts[j] = order.counts[j], order.counts[i]
+}
+
+// LoadBreachCorpus reads a Have I Been Pwned corpus. The path is either a
+// file of full hashes, one HASH:COUNT per line, or a directory of range
+// files named by their five digit prefix, e.g. 21BD1.txt, each holding
+// SUFFIX:COUNT lines as returned by the range API. Lines are parsed straight
+// into the corpus and sorted in place, so it is not held twice while loading.
+func LoadBreachCorpus(path string) (*BreachCorpus, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	corpus := &BreachCorpus{}
+
+	if !info.IsDir() {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+
+		if err := corpus.readRange(file, ""); err != nil {
+			return nil, fmt.Errorf("%v %s", err, path)
+		}
+
+		corpus.index()
+
+		return corpus, nil
+	}
+
+	files, err := ioutil.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, info := range files {
+		prefix := strings.TrimSuffix(info.Name(), filepath.Ext(info.Name()))
+		if info.IsDir() || len(prefix) != breachPrefixBits/4 {
+			continue
+		}
+
+		file, err := os.Open(filepath.Join(path, info.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		err = corpus.readRange(file, prefix)
+		file.Close()
+
+		if err != nil {
+			return nil, fmt.Errorf("%v %s", err, info.Name())
+		}
+	}
+
+	corpus.index()
+
+	return corpus, nil
+}
+
+// readRange adds the HASH:COUNT lines read to the corpus, with prefix put in
+// front of each hash. The corpus must be indexed once everything is read.
+func (corpus *BreachCorpus) readRange(reader io.Reader, prefix string) error {
+	scanner := bufio.NewScanner(reader)
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 {
+			return ErrInvalidBreachCorpus
+		}
+
+		decoded, err := hex.DecodeString(prefix + parts[0])
+		if err != nil || len(decoded) != sha1.Size {
+			return ErrInvalidBreachCorpus
+		}
+
+		count, err := strconv.ParseUint(strings.TrimSpace(parts[1]), 10, 32)
+		if err != nil {
+			return ErrInvalidBreachCorpus
+		}
+
+		// Padded range responses carry made up hashes with a count of 0.
+		if count == 0 {
+			continue
+		}
+
+		var hash [sha1.Size]byte
+		copy(hash[:], decoded)
+
+		corpus.hashes = append(corpus.hashes, hash)
+		corpus.counts = append(corpus.counts, uint32(count))
+	}
+
+	return scanner.Err()
+}
+
+// index sorts the hashes in place and builds the fanout table over them.
+func (corpus *BreachCorpus) index() {
+	sort.Sort(breachOrder{corpus})
+
+	corpus.fanout = make([]uint32, 1<<breachPrefixBits+1)
+
+	for _, hash := range corpus.hashes {
+		corpus.fanout[breachPrefix(hash)+1]++
+	}
+
+	for i := 1; i < len(corpus.fanout); i++ {
+		corpus.fanout[i] += corpus.fanout[i-1]
+	}
+}
+
+func breachPrefix(hash [sha1.Size]byte) int {
+	return int(hash[0])<<12 | int(hash[1])<<4 | int(hash[2])>>4
+}
+
+// Len returns the number of hashes in the corpus.
+func (corpus *BreachCorpus) Len() int {
+	return len(corpus.hashes)
+}
+
+// Count returns how many times the password was seen in breaches, or 0 if
+// it was not.
+func (corpus *BreachCorpus) Count(password string) int {
+	hash := sha1.Sum([]byte(password))
+	prefix := breachPrefix(hash)
+
+	start, end := int(corpus.fanout[prefix]), int(corpus.fanout[prefix+1])
+	bucket := corpus.hashes[start:end]
+
+	i := sort.Search(len(bucket), func(i int) bool {
+		return bytes.Compare(bucket[i][:], hash[:]) >= 0
+	})
+
+	if i < len(bucket) && bucket[i] == hash {
+		return int(corpus.counts[start+i])
+	}
+
+	return 0
+}
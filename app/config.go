@@ -6,6 +6,7 @@ import (
 	"flag"
 	"log"
 	"strings"
+	"time"
 
 	"github.com/BurntSushi/toml"
 )
@@ -16,13 +17,31 @@ type Config interface {
 	GetAmpqUsername() string
 	GetAmpqPassword() string
 
+	GetDbDriver() string
+	GetDbSource() string
 	GetDbHosts() []string
+	GetDbName() string
+	GetDbCollections() MongoCollections
+
+	GetRequestTimeout() time.Duration
 	GetAuthDb() string
 	GetDbUsername() string
 	GetDbPassword() string
 
 	GetPrivateKeyPath() string
 	GetPublicKeyPath() string
+	GetRetiredPublicKeyPaths() []string
+
+	GetIssuer() string
+
+	GetPasswordHasher() string
+	GetPasswordPolicy() PasswordPolicy
+	GetBreachCorpusPath() string
+
+	GetEmailVerificationLifetime() time.Duration
+
+	GetWebAuthnRelyingPartyId() string
+	GetWebAuthnOrigins() []string
 }
 
 type AppConfig struct {
@@ -32,10 +51,23 @@ type AppConfig struct {
 	ampqPassword    string
 	privateKeyPath  string
 	publicKeyPath   string
+	retiredKeyPaths []string
+	issuer          string
+	passwordHasher  string
+	passwordPolicy  PasswordPolicy
+	breachCorpus    string
+	verificationTTL time.Duration
+	webAuthnRpId    string
+	webAuthnOrigins []string
+	dbDriver        string
+	dbSource        string
 	dbHosts         []string
+	dbName          string
+	dbCollections   MongoCollections
 	authDb          string
 	dbUsername      string
 	dbPassword      string
+	requestTimeout  time.Duration
 }
 
 func BuildConfig() Config {
@@ -44,14 +76,30 @@ func BuildConfig() Config {
 	var ampqUsername string
 	var ampqPassword string
 
+	var dbDriver string
+	var dbSource string
 	var dbHostString string
 	var dbHosts []string
+	var dbName string
+	var dbCollections = DefaultMongoCollections
 	var authDb string
 	var dbUsername string
 	var dbPassword string
 
+	var requestTimeout time.Duration
+
 	var privateKeyPath string
 	var publicKeyPath string
+	var retiredKeyPathString string
+	var retiredKeyPaths []string
+	var issuer string
+	var passwordHasher string
+	var passwordPolicy PasswordPolicy
+	var breachCorpus string
+	var verificationTTL time.Duration
+	var webAuthnRpId string
+	var webAuthnOriginString string
+	var webAuthnOrigins []string
 	var configFile string
 
 	flag.StringVar(&configFile, "config", "", "path to yaml config file")
@@ -61,17 +109,49 @@ func BuildConfig() Config {
 	flag.StringVar(&ampqUsername, "mq-username", "", "ampq username")
 	flag.StringVar(&ampqPassword, "mq-password", "", "ampq password")
 
+	flag.StringVar(&dbDriver, "db-driver", "mongodb", "database backend (mongodb, postgres or sqlite3)")
+	flag.StringVar(&dbSource, "db-source", "", "connection string for postgres, or database file path for sqlite3")
 	flag.StringVar(&dbHostString, "db-hosts", "", "address list of db hosts")
+	flag.StringVar(&dbName, "db-name", AppDatabase, "name of the MongoDB database")
 	flag.StringVar(&authDb, "db-auth", "", "db to auth against")
 	flag.StringVar(&dbUsername, "db-username", "", "db username")
 	flag.StringVar(&dbPassword, "db-password", "", "db password")
 
+	flag.DurationVar(&requestTimeout, "request-timeout", RequestTimeout, "how long a request may spend on the database before it is abandoned, e.g. 10s")
+
 	flag.StringVar(&privateKeyPath, "crypto-private-key", "", "path to private key")
 	flag.StringVar(&publicKeyPath, "crypto-public-key", "", "path to public key")
+	flag.StringVar(&retiredKeyPathString, "crypto-retired-public-keys", "", "path list of retired public keys still accepted for validation")
+
+	flag.StringVar(&issuer, "oidc-issuer", "", "public base url of this service, used as the token issuer")
+
+	flag.StringVar(&passwordHasher, "password-hasher", "argon2id", "algorithm used to hash passwords (argon2id, 2a, scrypt or pbkdf2-sha512)")
+	flag.IntVar(&passwordPolicy.MinLength, "password-min-length", DefaultPasswordPolicy.MinLength, "minimum password length, 0 for none")
+	flag.IntVar(&passwordPolicy.MaxLength, "password-max-length", DefaultPasswordPolicy.MaxLength, "maximum password length, 0 for none")
+	flag.IntVar(&passwordPolicy.MinCharacterClasses, "password-min-classes", DefaultPasswordPolicy.MinCharacterClasses, "how many of lowercase, uppercase, digits and symbols a password must use")
+	flag.IntVar(&passwordPolicy.MinStrength, "password-min-strength", DefaultPasswordPolicy.MinStrength, "minimum password strength score from 0 to 4")
+	flag.StringVar(&breachCorpus, "password-breach-corpus", "", "path to a Have I Been Pwned hash file or directory of range files, breached passwords are refused")
+	flag.IntVar(&passwordPolicy.MinBreachCount, "password-breach-threshold", DefaultPasswordPolicy.MinBreachCount, "times a password must appear in the breach corpus to be refused")
+	flag.IntVar(&passwordPolicy.HistoryLength, "password-history", DefaultPasswordPolicy.HistoryLength, "number of recent passwords, the current one included, that cannot be reused")
+	flag.DurationVar(&passwordPolicy.MinAge, "password-min-age", DefaultPasswordPolicy.MinAge, "how long a password must be kept before it can be changed, e.g. 24h")
+	passwordPolicy.DisallowEmail = DefaultPasswordPolicy.DisallowEmail
+
+	flag.DurationVar(&verificationTTL, "email-verification-lifetime", EmailVerificationLifetime, "how long an email verification code can be used, e.g. 24h")
+
+	flag.StringVar(&webAuthnRpId, "webauthn-rp-id", "", "relying party id for passkeys, defaults to the issuer host")
+	flag.StringVar(&webAuthnOriginString, "webauthn-origins", "", "origin list passkey ceremonies are accepted from, defaults to the issuer origin")
 	flag.Parse()
 
 	dbHosts, _ = coerceStringSlice(dbHostString)
 
+	if retiredKeyPathString != "" {
+		retiredKeyPaths, _ = coerceStringSlice(retiredKeyPathString)
+	}
+
+	if webAuthnOriginString != "" {
+		webAuthnOrigins, _ = coerceStringSlice(webAuthnOriginString)
+	}
+
 	var cfgFile map[string]interface{}
 	if configFile != "" {
 		_, err := toml.DecodeFile(configFile, &cfgFile)
@@ -84,26 +164,128 @@ func BuildConfig() Config {
 		ampqUsernameSlice, _ := coerceStringSlice(cfgFile["mq-username"])
 		ampqPasswordSlice, _ := coerceStringSlice(cfgFile["mq-password"])
 
+		dbDriverSlice, _ := coerceStringSlice(cfgFile["db-driver"])
+		dbSourceSlice, _ := coerceStringSlice(cfgFile["db-source"])
 		dbHostsSlice, _ := coerceStringSlice(cfgFile["db-hosts"])
+		dbNameSlice, _ := coerceStringSlice(cfgFile["db-name"])
 		authDbSlice, _ := coerceStringSlice(cfgFile["db-auth"])
 		dbUsernameSlice, _ := coerceStringSlice(cfgFile["db-username"])
 		dbPasswordSlice, _ := coerceStringSlice(cfgFile["db-password"])
 
+		requestTimeoutSlice, _ := coerceStringSlice(cfgFile["request-timeout"])
+
 		privateKeyPathSlice, _ := coerceStringSlice(cfgFile["crypto-private-key"])
 		publicKeyPathSlice, _ := coerceStringSlice(cfgFile["crypto-public-key"])
+		retiredKeyPathsSlice, _ := coerceStringSlice(cfgFile["crypto-retired-public-keys"])
+
+		issuerSlice, _ := coerceStringSlice(cfgFile["oidc-issuer"])
+
+		passwordHasherSlice, _ := coerceStringSlice(cfgFile["password-hasher"])
+		coerceInt(cfgFile["password-min-length"], &passwordPolicy.MinLength)
+		coerceInt(cfgFile["password-max-length"], &passwordPolicy.MaxLength)
+		coerceInt(cfgFile["password-min-classes"], &passwordPolicy.MinCharacterClasses)
+		coerceInt(cfgFile["password-min-strength"], &passwordPolicy.MinStrength)
+		breachCorpusSlice, _ := coerceStringSlice(cfgFile["password-breach-corpus"])
+		coerceInt(cfgFile["password-breach-threshold"], &passwordPolicy.MinBreachCount)
+		coerceInt(cfgFile["password-history"], &passwordPolicy.HistoryLength)
+		passwordMinAgeSlice, _ := coerceStringSlice(cfgFile["password-min-age"])
+
+		verificationTTLSlice, _ := coerceStringSlice(cfgFile["email-verification-lifetime"])
+
+		webAuthnRpIdSlice, _ := coerceStringSlice(cfgFile["webauthn-rp-id"])
+		webAuthnOriginsSlice, _ := coerceStringSlice(cfgFile["webauthn-origins"])
 
 		topic = topicSlice[0]
 		exchangeAddress = exchangeAddressSlice[0]
 		ampqUsername = ampqUsernameSlice[0]
 		ampqPassword = ampqPasswordSlice[0]
 
+		// The MongoDB settings are left out when another backend is used.
 		dbHosts = dbHostsSlice
-		authDb = authDbSlice[0]
-		dbUsername = dbUsernameSlice[0]
-		dbPassword = dbPasswordSlice[0]
+		if len(authDbSlice) != 0 {
+			authDb = authDbSlice[0]
+			dbUsername = dbUsernameSlice[0]
+			dbPassword = dbPasswordSlice[0]
+		}
 
 		privateKeyPath = privateKeyPathSlice[0]
 		publicKeyPath = publicKeyPathSlice[0]
+
+		if len(retiredKeyPathsSlice) != 0 {
+			retiredKeyPaths = retiredKeyPathsSlice
+		}
+
+		if len(issuerSlice) != 0 {
+			issuer = issuerSlice[0]
+		}
+
+		if len(dbNameSlice) != 0 {
+			dbName = dbNameSlice[0]
+		}
+
+		// Collections are renamed in a [db-collections] table, e.g.
+		// credentials = "users".
+		if collections, ok := cfgFile["db-collections"].(map[string]interface{}); ok {
+			coerceString(collections["credentials"], &dbCollections.Credentials)
+			coerceString(collections["refreshtokens"], &dbCollections.RefreshTokens)
+			coerceString(collections["clients"], &dbCollections.Clients)
+			coerceString(collections["authorizationcodes"], &dbCollections.AuthorizationCodes)
+			coerceString(collections["passwordresets"], &dbCollections.PasswordResets)
+			coerceString(collections["loginlinks"], &dbCollections.LoginLinks)
+			coerceString(collections["revokedtokens"], &dbCollections.RevokedTokens)
+			coerceString(collections["revokedusers"], &dbCollections.RevokedUsers)
+		}
+
+		if len(dbDriverSlice) != 0 {
+			dbDriver = dbDriverSlice[0]
+		}
+
+		if len(dbSourceSlice) != 0 {
+			dbSource = dbSourceSlice[0]
+		}
+
+		if len(passwordHasherSlice) != 0 {
+			passwordHasher = passwordHasherSlice[0]
+		}
+
+		if len(breachCorpusSlice) != 0 {
+			breachCorpus = breachCorpusSlice[0]
+		}
+
+		if len(passwordMinAgeSlice) != 0 {
+			minAge, err := time.ParseDuration(passwordMinAgeSlice[0])
+			if err != nil {
+				log.Fatalf("ERROR: password-min-age must be a duration, e.g. 24h - %s", err.Error())
+			}
+
+			passwordPolicy.MinAge = minAge
+		}
+
+		if len(requestTimeoutSlice) != 0 {
+			timeout, err := time.ParseDuration(requestTimeoutSlice[0])
+			if err != nil {
+				log.Fatalf("ERROR: request-timeout must be a duration, e.g. 10s - %s", err.Error())
+			}
+
+			requestTimeout = timeout
+		}
+
+		if len(verificationTTLSlice) != 0 {
+			lifetime, err := time.ParseDuration(verificationTTLSlice[0])
+			if err != nil {
+				log.Fatalf("ERROR: email-verification-lifetime must be a duration, e.g. 24h - %s", err.Error())
+			}
+
+			verificationTTL = lifetime
+		}
+
+		if len(webAuthnRpIdSlice) != 0 {
+			webAuthnRpId = webAuthnRpIdSlice[0]
+		}
+
+		if len(webAuthnOriginsSlice) != 0 {
+			webAuthnOrigins = webAuthnOriginsSlice
+		}
 	}
 
 	if len(topic) == 0 {
@@ -122,8 +304,21 @@ func BuildConfig() Config {
 		log.Fatalf("--mq-password required")
 	}
 
-	if len(dbHosts) == 0 {
-		log.Fatalf("--db-hosts required")
+	switch dbDriver {
+	case "mongodb":
+		if len(dbHosts) == 0 {
+			log.Fatalf("--db-hosts required")
+		}
+
+		if len(dbName) == 0 {
+			log.Fatalf("--db-name required")
+		}
+	case "postgres", "sqlite3":
+		if len(dbSource) == 0 {
+			log.Fatalf("--db-source required")
+		}
+	default:
+		log.Fatalf("--db-driver must be one of mongodb, postgres or sqlite3")
 	}
 
 	// if len(authDb) != 0 {
@@ -146,14 +341,33 @@ func BuildConfig() Config {
 		log.Fatalf("--crypto-public-key required")
 	}
 
+	if len(issuer) == 0 {
+		log.Fatalf("--oidc-issuer required")
+	}
+
+	if _, ok := PasswordHashers[passwordHasher]; !ok {
+		log.Fatalf("--password-hasher must be one of argon2id, 2a, scrypt or pbkdf2-sha512")
+	}
+
+	if passwordPolicy.MinStrength < 0 || passwordPolicy.MinStrength > 4 {
+		log.Fatalf("--password-min-strength must be between 0 and 4")
+	}
+
 	log.Println("***** Configuration *****")
 	log.Println()
 	log.Println("Database")
+	log.Println(" ├─ db-driver ----------> ", dbDriver)
+	log.Println(" ├─ db-source ----------> ", dbSource)
 	log.Println(" ├─ db-hosts -----------> ", dbHosts)
+	log.Println(" ├─ db-name ------------> ", dbName)
+	log.Println(" ├─ db-collections -----> ", dbCollections)
 	log.Println(" ├─ db-auth ------------> ", authDb)
 	log.Println(" ├─ db-username --------> ", dbUsername)
 	log.Println(" └─ db-password --------> ", dbPassword)
 	log.Println()
+	log.Println("Requests")
+	log.Println(" └─ request-timeout ----> ", requestTimeout)
+	log.Println()
 	log.Println("Message Queue")
 	log.Println(" ├─ mq-topic -----------> ", topic)
 	log.Println(" ├─ mq-address ---------> ", exchangeAddress)
@@ -162,11 +376,33 @@ func BuildConfig() Config {
 	log.Println()
 	log.Println("Cryptography")
 	log.Println(" ├─ crypto-private-key -> ", privateKeyPath)
-	log.Println(" └─ crypto-public-key --> ", publicKeyPath)
+	log.Println(" ├─ crypto-public-key --> ", publicKeyPath)
+	log.Println(" └─ crypto-retired-public-keys -> ", retiredKeyPaths)
+	log.Println()
+	log.Println("OpenID Connect")
+	log.Println(" └─ oidc-issuer --------> ", issuer)
+	log.Println()
+	log.Println("Passwords")
+	log.Println(" ├─ password-hasher ----> ", passwordHasher)
+	log.Println(" ├─ password-min-length > ", passwordPolicy.MinLength)
+	log.Println(" ├─ password-max-length > ", passwordPolicy.MaxLength)
+	log.Println(" ├─ password-min-classes > ", passwordPolicy.MinCharacterClasses)
+	log.Println(" ├─ password-min-strength > ", passwordPolicy.MinStrength)
+	log.Println(" ├─ password-breach-corpus > ", breachCorpus)
+	log.Println(" ├─ password-breach-threshold > ", passwordPolicy.MinBreachCount)
+	log.Println(" ├─ password-history ---> ", passwordPolicy.HistoryLength)
+	log.Println(" └─ password-min-age ---> ", passwordPolicy.MinAge)
+	log.Println()
+	log.Println("Email Verification")
+	log.Println(" └─ email-verification-lifetime -> ", verificationTTL)
+	log.Println()
+	log.Println("WebAuthn")
+	log.Println(" ├─ webauthn-rp-id -----> ", webAuthnRpId)
+	log.Println(" └─ webauthn-origins ---> ", webAuthnOrigins)
 	log.Println()
 	log.Println("*************************")
 
-	config := &AppConfig{topic: topic, exchangeAddress: exchangeAddress, ampqUsername: ampqUsername, ampqPassword: ampqPassword, dbHosts: dbHosts, authDb: authDb, dbUsername: dbUsername, dbPassword: dbPassword, privateKeyPath: privateKeyPath, publicKeyPath: publicKeyPath}
+	config := &AppConfig{topic: topic, exchangeAddress: exchangeAddress, ampqUsername: ampqUsername, ampqPassword: ampqPassword, dbDriver: dbDriver, dbSource: dbSource, dbHosts: dbHosts, dbName: dbName, dbCollections: dbCollections, authDb: authDb, dbUsername: dbUsername, dbPassword: dbPassword, requestTimeout: requestTimeout, privateKeyPath: privateKeyPath, publicKeyPath: publicKeyPath, retiredKeyPaths: retiredKeyPaths, issuer: issuer, passwordHasher: passwordHasher, passwordPolicy: passwordPolicy, breachCorpus: breachCorpus, verificationTTL: verificationTTL, webAuthnRpId: webAuthnRpId, webAuthnOrigins: webAuthnOrigins}
 
 	return config
 }
@@ -187,10 +423,26 @@ func (config *AppConfig) GetAmpqPassword() string {
 	return config.ampqPassword
 }
 
+func (config *AppConfig) GetDbDriver() string {
+	return config.dbDriver
+}
+
+func (config *AppConfig) GetDbSource() string {
+	return config.dbSource
+}
+
 func (config *AppConfig) GetDbHosts() []string {
 	return config.dbHosts
 }
 
+func (config *AppConfig) GetDbName() string {
+	return config.dbName
+}
+
+func (config *AppConfig) GetDbCollections() MongoCollections {
+	return config.dbCollections
+}
+
 func (config *AppConfig) GetAuthDb() string {
 	return config.authDb
 }
@@ -211,6 +463,42 @@ func (config *AppConfig) GetPublicKeyPath() string {
 	return config.publicKeyPath
 }
 
+func (config *AppConfig) GetRetiredPublicKeyPaths() []string {
+	return config.retiredKeyPaths
+}
+
+func (config *AppConfig) GetIssuer() string {
+	return config.issuer
+}
+
+func (config *AppConfig) GetPasswordHasher() string {
+	return config.passwordHasher
+}
+
+func (config *AppConfig) GetPasswordPolicy() PasswordPolicy {
+	return config.passwordPolicy
+}
+
+func (config *AppConfig) GetBreachCorpusPath() string {
+	return config.breachCorpus
+}
+
+func (config *AppConfig) GetRequestTimeout() time.Duration {
+	return config.requestTimeout
+}
+
+func (config *AppConfig) GetEmailVerificationLifetime() time.Duration {
+	return config.verificationTTL
+}
+
+func (config *AppConfig) GetWebAuthnRelyingPartyId() string {
+	return config.webAuthnRpId
+}
+
+func (config *AppConfig) GetWebAuthnOrigins() []string {
+	return config.webAuthnOrigins
+}
+
 func coerceStringSlice(v interface{}) ([]string, error) {
 	var tmp []string
 	switch v.(type) {
@@ -227,3 +515,22 @@ func coerceStringSlice(v interface{}) ([]string, error) {
 	}
 	return tmp, nil
 }
+
+// coerceString sets target from a TOML string, leaving it alone if the key
+// is missing.
+func coerceString(v interface{}, target *string) {
+	if value, ok := v.(string); ok && value != "" {
+		*target = value
+	}
+}
+
+// coerceInt sets target from a TOML integer, leaving it alone if the key is
+// missing.
+func coerceInt(v interface{}, target *int) {
+	switch v.(type) {
+	case int64:
+		*target = int(v.(int64))
+	case int:
+		*target = v.(int)
+	}
+}
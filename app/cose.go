@@ -0,0 +1,219 @@
+// Copyright (c) Luke Atherton 2015
+
+package authenticator
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"errors"
+	"math/big"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// COSE algorithm and key type identifiers, see RFC 8152.
+const (
+	coseAlgES256 = -7
+	coseAlgEdDSA = -8
+	coseAlgRS256 = -257
+
+	coseKeyTypeOKP = 1
+	coseKeyTypeEC2 = 2
+	coseKeyTypeRSA = 3
+
+	coseCurveP256    = 1
+	coseCurveEd25519 = 6
+)
+
+var (
+	ErrUnsupportedCOSEKey = errors.New("unsupported COSE key")
+	ErrInvalidSignature   = errors.New("invalid signature")
+)
+
+// A coseKey is a credential public key along with the algorithm it signs
+// with.
+type coseKey struct {
+	Alg       int64
+	PublicKey crypto.PublicKey
+}
+
+// parseCOSEKey decodes an ES256, EdDSA or RS256 public key in COSE_Key
+// format.
+func parseCOSEKey(raw []byte) (*coseKey, error) {
+	var params map[int]interface{}
+	if err := cbor.Unmarshal(raw, &params); err != nil {
+		return nil, err
+	}
+
+	keyType := coseInt(params[1])
+	alg := coseInt(params[3])
+
+	switch {
+	case keyType == coseKeyTypeEC2 && alg == coseAlgES256:
+		x, _ := params[-2].([]byte)
+		y, _ := params[-3].([]byte)
+		if coseInt(params[-1]) != coseCurveP256 || len(x) != 32 || len(y) != 32 {
+			return nil, ErrUnsupportedCOSEKey
+		}
+
+		publicKey := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !publicKey.Curve.IsOnCurve(publicKey.X, publicKey.Y) {
+			return nil, ErrUnsupportedCOSEKey
+		}
+
+		return &coseKey{Alg: alg, PublicKey: publicKey}, nil
+
+	case keyType == coseKeyTypeOKP && alg == coseAlgEdDSA:
+		x, _ := params[-2].([]byte)
+		if coseInt(params[-1]) != coseCurveEd25519 || len(x) != ed25519.PublicKeySize {
+			return nil, ErrUnsupportedCOSEKey
+		}
+
+		return &coseKey{Alg: alg, PublicKey: ed25519.PublicKey(x)}, nil
+
+	case keyType == coseKeyTypeRSA && alg == coseAlgRS256:
+		n, _ := params[-1].([]byte)
+		e, _ := params[-2].([]byte)
+		if len(n) == 0 || len(e) == 0 || len(e) > 4 {
+			return nil, ErrUnsupportedCOSEKey
+		}
+
+		publicKey := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+
+		return &coseKey{Alg: alg, PublicKey: publicKey}, nil
+	}
+
+	return nil, ErrUnsupportedCOSEKey
+}
+
+func (key *coseKey) verify(message []byte, signature []byte) error {
+	return verifySignature(key.Alg, key.PublicKey, message, signature)
+}
+
+func verifySignature(alg int64, publicKey crypto.PublicKey, message []byte, signature []byte) error {
+	digest := sha256.Sum256(message)
+
+	switch alg {
+	case coseAlgES256:
+		if key, ok := publicKey.(*ecdsa.PublicKey); ok && ecdsa.VerifyASN1(key, digest[:], signature) {
+			return nil
+		}
+
+	case coseAlgEdDSA:
+		if key, ok := publicKey.(ed25519.PublicKey); ok && ed25519.Verify(key, message, signature) {
+			return nil
+		}
+
+	case coseAlgRS256:
+		if key, ok := publicKey.(*rsa.PublicKey); ok && rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature) == nil {
+			return nil
+		}
+	}
+
+	return ErrInvalidSignature
+}
+
+// coseInt reads an integer label or value, which the CBOR decoder returns as
+// either uint64 or int64 depending on its sign.
+func coseInt(value interface{}) int64 {
+	switch v := value.(type) {
+	case int64:
+		return v
+	case uint64:
+		return int64(v)
+	}
+
+	return 0
+}
+
+//=====================================================================================
+
+// id-fido-gen-ce-aaguid, the certificate extension carrying the AAGUID.
+var oidFIDOAAGUID = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 45724, 1, 1, 4}
+
+// verifyAttestation checks the attestation statement for the "none" and
+// "packed" formats. The attestation certificate, if any, is checked for
+// well-formedness only; it is not chained to a trusted root.
+func verifyAttestation(format string, attStmt cbor.RawMessage, authData []byte, clientDataHash []byte, credentialKey *coseKey, aaguid []byte) error {
+	switch format {
+	case "none":
+		var statement map[string]interface{}
+		if err := cbor.Unmarshal(attStmt, &statement); err != nil || len(statement) != 0 {
+			return ErrInvalidWebAuthnResponse
+		}
+
+		return nil
+
+	case "packed":
+		return verifyPackedAttestation(attStmt, authData, clientDataHash, credentialKey, aaguid)
+	}
+
+	return ErrInvalidWebAuthnResponse
+}
+
+// verifyPackedAttestation implements section 8.2 of the WebAuthn
+// specification, for both basic and self attestation.
+func verifyPackedAttestation(attStmt cbor.RawMessage, authData []byte, clientDataHash []byte, credentialKey *coseKey, aaguid []byte) error {
+	var statement struct {
+		Alg int64    `cbor:"alg"`
+		Sig []byte   `cbor:"sig"`
+		X5c [][]byte `cbor:"x5c"`
+	}
+
+	if err := cbor.Unmarshal(attStmt, &statement); err != nil {
+		return ErrInvalidWebAuthnResponse
+	}
+
+	signed := append(append([]byte{}, authData...), clientDataHash...)
+
+	// Self attestation is signed by the credential key itself.
+	if len(statement.X5c) == 0 {
+		if statement.Alg != credentialKey.Alg || credentialKey.verify(signed, statement.Sig) != nil {
+			return ErrInvalidWebAuthnResponse
+		}
+
+		return nil
+	}
+
+	certificate, err := x509.ParseCertificate(statement.X5c[0])
+	if err != nil {
+		return ErrInvalidWebAuthnResponse
+	}
+
+	if verifySignature(statement.Alg, certificate.PublicKey, signed, statement.Sig) != nil {
+		return ErrInvalidWebAuthnResponse
+	}
+
+	if certificate.Version != 3 || certificate.IsCA || !hasOrganizationalUnit(certificate, "Authenticator Attestation") {
+		return ErrInvalidWebAuthnResponse
+	}
+
+	for _, extension := range certificate.Extensions {
+		if !extension.Id.Equal(oidFIDOAAGUID) {
+			continue
+		}
+
+		var certificateAAGUID []byte
+		if _, err := asn1.Unmarshal(extension.Value, &certificateAAGUID); err != nil || extension.Critical || string(certificateAAGUID) != string(aaguid) {
+			return ErrInvalidWebAuthnResponse
+		}
+	}
+
+	return nil
+}
+
+func hasOrganizationalUnit(certificate *x509.Certificate, unit string) bool {
+	for _, organizationalUnit := range certificate.Subject.OrganizationalUnit {
+		if organizationalUnit == unit {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,229 @@
+// Copyright (c) Luke Atherton 2015
+
+package authenticator
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	. "github.com/lukeatherton/domain-events"
+	"github.com/satori/go.uuid"
+)
+
+var (
+	EmailChangeLifetime   = time.Hour * 24
+	EmailChangeCodeLength = 32
+)
+
+var (
+	ErrEmailExists        = errors.New("Email Change Failed: Email already exists.")
+	ErrInvalidEmailChange = errors.New("Email Change Failed: Invalid or expired verification code.")
+)
+
+// RequestEmailChange records newEmail as the user's pending email and returns
+// the code that proves they receive mail there. Email is left alone until
+// the change is confirmed, and a new request replaces any pending one.
+func (auth *TokenAuthenticator) RequestEmailChange(ctx context.Context, userId uuid.UUID, newEmail string) (string, error) {
+	if existingId, _ := auth.repo.FindEmail(ctx, newEmail); existingId != uuid.Nil {
+		return "", ErrEmailExists
+	}
+
+	credentials, err := auth.repo.GetCredentials(ctx, userId)
+	if err != nil {
+		return "", err
+	}
+
+	code, err := generateOpaqueToken(EmailChangeCodeLength)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = UpdateCredentials(ctx, auth.repo, credentials, func(credentials *Credentials) error {
+		credentials.PendingEmail = newEmail
+		credentials.PendingEmailCodeHash = hashOpaqueToken(code)
+		credentials.PendingEmailExpiry = time.Now().Add(EmailChangeLifetime)
+
+		return nil
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	return code, nil
+}
+
+// ConfirmEmailChange swaps in the pending email once the code sent there is
+// presented. Tokens issued before the change carry the old email so are
+// revoked, and a new token with the given authentication methods is
+// returned along with the old email.
+func (auth *TokenAuthenticator) ConfirmEmailChange(ctx context.Context, userId uuid.UUID, code string, amr []string) (string, string, error) {
+	credentials, err := auth.repo.GetCredentials(ctx, userId)
+	if err != nil {
+		return "", "", ErrInvalidEmailChange
+	}
+
+	var oldEmail string
+
+	credentials, err = UpdateCredentials(ctx, auth.repo, credentials, func(credentials *Credentials) error {
+		if credentials.PendingEmail == "" || time.Now().After(credentials.PendingEmailExpiry) ||
+			subtle.ConstantTimeCompare([]byte(hashOpaqueToken(code)), []byte(credentials.PendingEmailCodeHash)) != 1 {
+			return ErrInvalidEmailChange
+		}
+
+		// Someone may have registered the address since the change was
+		// requested.
+		if existingId, _ := auth.repo.FindEmail(ctx, credentials.PendingEmail); existingId != uuid.Nil {
+			return ErrEmailExists
+		}
+
+		oldEmail = credentials.Email
+
+		credentials.Email = credentials.PendingEmail
+		credentials.confirmEmail(time.Now())
+		credentials.PendingEmail = ""
+		credentials.PendingEmailCodeHash = ""
+		credentials.PendingEmailExpiry = time.Time{}
+
+		return nil
+	})
+
+	if err == ErrDuplicateEmail {
+		return "", "", ErrEmailExists
+	}
+
+	if err != nil {
+		return "", "", err
+	}
+
+	if err := auth.RevokeUserTokens(ctx, userId); err != nil {
+		return "", "", err
+	}
+
+	token, err := auth.issueToken(credentials, amr)
+
+	return token, oldEmail, err
+}
+
+// Starts changing the authenticated user's email. The current password is
+// required, and the verification code only goes out in the published event.
+func RequestEmailChange(c *gin.Context) {
+	auth := c.MustGet("auth").(Authenticator)
+	publisher := c.MustGet("publisher").(Publisher)
+	id := GetIdParam(c.MustGet("userId").(string), c)
+	email := c.MustGet("email").(string)
+
+	if id == uuid.Nil {
+		return
+	}
+
+	var view *EmailChangeRequestView
+	c.Bind(&view)
+
+	if view == nil || view.Email == "" {
+		c.JSON(http.StatusBadRequest, NewError(ErrCodeValueRequired, "email is a required field"))
+		return
+	}
+
+	if view.Password == "" {
+		c.JSON(http.StatusBadRequest, NewError(ErrCodeValueRequired, "password is a required field"))
+		return
+	}
+
+	// A challenge still proves the password was correct.
+	_, auth_err := auth.Authenticate(c.Request.Context(), email, view.Password, "")
+	if auth_err == ErrAccountLocked {
+		publishAccountLocked(c, email)
+	}
+
+	if auth_err != nil && auth_err != ErrMFARequired {
+		c.JSON(http.StatusUnauthorized, "")
+		return
+	}
+
+	newEmail := strings.ToLower(view.Email)
+
+	code, err := auth.RequestEmailChange(c.Request.Context(), id, newEmail)
+	if err == ErrEmailExists {
+		c.JSON(http.StatusBadRequest, NewError(ErrCodeAlreadyExists, "user email exists"))
+		return
+	}
+
+	if err == ErrConflict {
+		c.JSON(http.StatusConflict, NewError(ErrCodeConflict, "credentials were changed by another request"))
+		return
+	}
+
+	if err != nil {
+		fmt.Printf("ERROR: %v\n", err.Error())
+		c.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	go publisher.PublishMessage(NewEmailChangeRequestedEvent(id, email, newEmail, code, uuid.Nil))
+
+	c.JSON(http.StatusAccepted, "email change requested")
+	return
+}
+
+// Completes an email change with the code sent to the new address
+func ConfirmEmailChange(c *gin.Context) {
+	auth := c.MustGet("auth").(Authenticator)
+	publisher := c.MustGet("publisher").(Publisher)
+	id := GetIdParam(c.MustGet("userId").(string), c)
+	currentToken := c.MustGet("token").(string)
+
+	if id == uuid.Nil {
+		return
+	}
+
+	var view *EmailChangeConfirmationView
+	c.Bind(&view)
+
+	if view == nil || view.Code == "" {
+		c.JSON(http.StatusBadRequest, NewError(ErrCodeValueRequired, "code is a required field"))
+		return
+	}
+
+	token, oldEmail, err := auth.ConfirmEmailChange(c.Request.Context(), id, view.Code, tokenAmr(auth, currentToken))
+
+	if err == ErrInvalidEmailChange {
+		c.JSON(http.StatusBadRequest, NewError(ErrCodeInvalidToken, "verification code is invalid or has expired"))
+		return
+	}
+
+	if err == ErrEmailExists {
+		c.JSON(http.StatusBadRequest, NewError(ErrCodeAlreadyExists, "user email exists"))
+		return
+	}
+
+	if err == ErrConflict {
+		c.JSON(http.StatusConflict, NewError(ErrCodeConflict, "credentials were changed by another request"))
+		return
+	}
+
+	if err != nil {
+		fmt.Printf("ERROR: %v\n", err.Error())
+		c.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	email, _ := auth.GetTokenClaim(token, "email")
+
+	go publisher.PublishMessage(NewEmailChangedEvent(id, email.(string), oldEmail, uuid.Nil))
+
+	response := AuthResponse{
+		Id:    id,
+		Email: email.(string),
+		Token: token,
+	}
+
+	c.JSON(http.StatusOK, response)
+	return
+}
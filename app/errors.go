@@ -9,9 +9,25 @@ import (
 
 const (
 	// Error codes
-	ErrCodeNotExist      = 1
-	ErrCodeAlreadyExists = 2
-	ErrCodeValueRequired = 3
+	ErrCodeNotExist          = 1
+	ErrCodeAlreadyExists     = 2
+	ErrCodeValueRequired     = 3
+	ErrCodeInvalidToken      = 4
+	ErrCodeInvalidCredential = 5
+	ErrCodeRateLimited       = 6
+
+	// Password policy error codes, one for each rule broken
+	ErrCodePasswordTooShort     = 7
+	ErrCodePasswordTooLong      = 8
+	ErrCodePasswordTooSimple    = 9
+	ErrCodePasswordMatchesEmail = 10
+	ErrCodePasswordTooWeak      = 11
+	ErrCodePasswordBreached     = 12
+	ErrCodePasswordReused       = 13
+	ErrCodePasswordTooRecent    = 14
+
+	// The credentials were changed by another request
+	ErrCodeConflict = 15
 )
 
 // The serializable Error structure.
@@ -32,3 +48,35 @@ func NewError(code int, msg string) *Error {
 		Message: msg,
 	}
 }
+
+const (
+	// OAuth 2.0 error codes, see RFC 6749 section 5.2
+	OAuthErrInvalidRequest          = "invalid_request"
+	OAuthErrInvalidClient           = "invalid_client"
+	OAuthErrInvalidGrant            = "invalid_grant"
+	OAuthErrInvalidScope            = "invalid_scope"
+	OAuthErrUnauthorizedClient      = "unauthorized_client"
+	OAuthErrUnsupportedGrantType    = "unsupported_grant_type"
+	OAuthErrUnsupportedResponseType = "unsupported_response_type"
+	OAuthErrAccessDenied            = "access_denied"
+	OAuthErrServerError             = "server_error"
+)
+
+// OAuthError is an error reported through the OAuth endpoints, either as a
+// JSON body or as redirect query parameters.
+type OAuthError struct {
+	Code        string
+	Description string
+}
+
+func (e *OAuthError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Description)
+}
+
+// NewOAuthError creates an OAuth error with the specified code and description.
+func NewOAuthError(code string, description string) *OAuthError {
+	return &OAuthError{
+		Code:        code,
+		Description: description,
+	}
+}
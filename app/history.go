@@ -0,0 +1,81 @@
+// Copyright (c) Luke Atherton 2015
+
+package authenticator
+
+import (
+	"fmt"
+	"time"
+)
+
+// ReplacePassword sets a password chosen by the user in place of their
+// current one, keeping the old hash so it cannot be used again. A password
+// among the last DefaultPasswordPolicy.HistoryLength, the current one
+// included, is refused with a *PasswordPolicyError.
+func (credentials *Credentials) ReplacePassword(password string, now time.Time) error {
+	length := DefaultPasswordPolicy.HistoryLength
+
+	if length > 0 && credentials.usedPassword(password, length) {
+		return &PasswordPolicyError{Errors: []*Error{
+			NewError(ErrCodePasswordReused, fmt.Sprintf("password must not be one of the last %d used", length)),
+		}}
+	}
+
+	previous := credentials.PasswordHash
+	if previous == "" && len(credentials.Key) != 0 {
+		previous = encodePasswordKey(&PasswordKey{credentials.Salt, credentials.Key})
+	}
+
+	if err := credentials.SetPassword(password); err != nil {
+		return err
+	}
+
+	history := credentials.PasswordHistory
+	if previous != "" {
+		history = append([]string{previous}, history...)
+	}
+
+	// The current hash is not part of the history, so only length-1 old
+	// hashes are needed.
+	if keep := length - 1; len(history) > keep {
+		if keep < 0 {
+			keep = 0
+		}
+
+		history = history[:keep]
+	}
+
+	credentials.PasswordHistory = history
+	credentials.PasswordChangedDate = now
+
+	return nil
+}
+
+// usedPassword reports whether the password is the current one or one of
+// the length-1 before it. Each old hash is verified with its own salt and
+// parameters, so hashes made before a change of hasher still match.
+func (credentials *Credentials) usedPassword(password string, length int) bool {
+	if matched, _ := credentials.CheckPassword(password); matched {
+		return true
+	}
+
+	for i, encoded := range credentials.PasswordHistory {
+		if i >= length-1 {
+			break
+		}
+
+		if matched, _, _ := VerifyPassword(password, encoded); matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+// canChangePassword reports whether the password is older than
+// DefaultPasswordPolicy.MinAge, so cannot be cycled back to an old one by
+// changing it several times in a row.
+func (credentials *Credentials) canChangePassword(now time.Time) bool {
+	minAge := DefaultPasswordPolicy.MinAge
+
+	return minAge <= 0 || !now.Before(credentials.PasswordChangedDate.Add(minAge))
+}
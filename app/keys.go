@@ -0,0 +1,145 @@
+// Copyright (c) Luke Atherton 2015
+
+package authenticator
+
+import (
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// A SigningKey is an RSA key pair identified by its kid. Retired keys only
+// carry the public half and are kept so that tokens they signed still
+// validate until they expire.
+type SigningKey struct {
+	Id         string
+	privateKey *rsa.PrivateKey
+	publicKey  *rsa.PublicKey
+}
+
+// A KeyRing holds the active signing key along with any retired keys.
+type KeyRing struct {
+	active *SigningKey
+	keys   []*SigningKey
+}
+
+// NewKeyRing loads the active key pair and the public halves of any retired
+// keys from PEM files.
+func NewKeyRing(privateKeyPath string, publicKeyPath string, retiredPublicKeyPaths ...string) (*KeyRing, error) {
+	privatePem, err := readKeyFromFile(privateKeyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	privateKey, err := jwt.ParseRSAPrivateKeyFromPEM(privatePem)
+	if err != nil {
+		return nil, err
+	}
+
+	publicKey, err := readPublicKey(publicKeyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if publicKey.N.Cmp(privateKey.PublicKey.N) != 0 || publicKey.E != privateKey.PublicKey.E {
+		return nil, errors.New("public key does not match private key")
+	}
+
+	active := &SigningKey{
+		Id:         keyThumbprint(publicKey),
+		privateKey: privateKey,
+		publicKey:  publicKey,
+	}
+
+	ring := &KeyRing{
+		active: active,
+		keys:   []*SigningKey{active},
+	}
+
+	for _, path := range retiredPublicKeyPaths {
+		retiredKey, err := readPublicKey(path)
+		if err != nil {
+			return nil, err
+		}
+
+		ring.keys = append(ring.keys, &SigningKey{
+			Id:        keyThumbprint(retiredKey),
+			publicKey: retiredKey,
+		})
+	}
+
+	return ring, nil
+}
+
+func (ring *KeyRing) ActiveKey() *SigningKey {
+	return ring.active
+}
+
+// FindKey returns the key with the given kid. Tokens issued before key ids
+// were introduced have no kid and are checked against the active key.
+func (ring *KeyRing) FindKey(kid string) *SigningKey {
+	if kid == "" {
+		return ring.active
+	}
+
+	for _, key := range ring.keys {
+		if key.Id == kid {
+			return key
+		}
+	}
+
+	return nil
+}
+
+// JSONWebKeySet publishes the public half of every key in the ring.
+func (ring *KeyRing) JSONWebKeySet() *JSONWebKeySet {
+	keySet := &JSONWebKeySet{Keys: []*JSONWebKey{}}
+
+	for _, key := range ring.keys {
+		keySet.Keys = append(keySet.Keys, newJSONWebKey(key))
+	}
+
+	return keySet
+}
+
+func newJSONWebKey(key *SigningKey) *JSONWebKey {
+	return &JSONWebKey{
+		Kty: "RSA",
+		Use: "sig",
+		Alg: "RS256",
+		Kid: key.Id,
+		N:   encodeKeyParam(key.publicKey.N.Bytes()),
+		E:   encodeKeyParam(big.NewInt(int64(key.publicKey.E)).Bytes()),
+	}
+}
+
+func readPublicKey(path string) (*rsa.PublicKey, error) {
+	publicPem, err := readKeyFromFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return jwt.ParseRSAPublicKeyFromPEM(publicPem)
+}
+
+// keyThumbprint derives a stable kid from the public key as described in
+// RFC 7638, so no key ids need to be configured.
+func keyThumbprint(publicKey *rsa.PublicKey) string {
+	members, _ := json.Marshal(map[string]string{
+		"e":   encodeKeyParam(big.NewInt(int64(publicKey.E)).Bytes()),
+		"kty": "RSA",
+		"n":   encodeKeyParam(publicKey.N.Bytes()),
+	})
+
+	sum := sha256.Sum256(members)
+	return encodeKeyParam(sum[:])
+}
+
+func encodeKeyParam(value []byte) string {
+	return base64.RawURLEncoding.EncodeToString(value)
+}
@@ -0,0 +1,307 @@
+// Copyright (c) Luke Atherton 2015
+
+package authenticator
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	. "github.com/lukeatherton/domain-events"
+	"github.com/satori/go.uuid"
+)
+
+var (
+	LoginLinkLifetime = time.Minute * 15
+	LoginCodeDigits   = 6
+	// LoginCodeMaxAttempts is the number of wrong codes after which the
+	// outstanding link is discarded and a new one must be requested.
+	LoginCodeMaxAttempts = 5
+)
+
+var (
+	ErrInvalidLoginLink = errors.New("Authentication Failed: Invalid or expired login link.")
+)
+
+// RequestLoginLink issues a signed login link token and a login code for the
+// user with the given email. Either can be redeemed, but only once, and a new
+// request replaces any link already outstanding. An unknown email is not an
+// error; userId is uuid.Nil instead.
+func (auth *TokenAuthenticator) RequestLoginLink(ctx context.Context, email string) (uuid.UUID, string, string, error) {
+	userId, _ := auth.repo.FindEmail(ctx, email)
+	if userId == uuid.Nil {
+		return uuid.Nil, "", "", nil
+	}
+
+	code, err := generateLoginCode()
+	if err != nil {
+		return uuid.Nil, "", "", err
+	}
+
+	now := time.Now()
+	tokenId := uuid.NewV4().String()
+
+	token, err := auth.signToken(map[string]interface{}{
+		"jti":       tokenId,
+		"iss":       auth.issuer,
+		"sub":       userId.String(),
+		"id":        userId.String(),
+		"iat":       now.Unix(),
+		"exp":       now.Add(LoginLinkLifetime).Unix(),
+		"token_use": "login_link",
+	})
+	if err != nil {
+		return uuid.Nil, "", "", err
+	}
+
+	link := &LoginLink{
+		UserId:      userId,
+		TokenId:     tokenId,
+		CodeHash:    hashOpaqueToken(code),
+		CreatedDate: now,
+		ExpiryDate:  now.Add(LoginLinkLifetime),
+	}
+
+	if err := auth.repo.SaveLoginLink(ctx, link); err != nil {
+		return uuid.Nil, "", "", err
+	}
+
+	return userId, token, code, nil
+}
+
+// RedeemLoginLink logs the user in with the token from a login link. The
+// returned flag is set when this is the first time the email was verified.
+func (auth *TokenAuthenticator) RedeemLoginLink(ctx context.Context, linkToken string) (string, bool, error) {
+	token, err := auth.parseToken(linkToken)
+	if err != nil || token.Claims["token_use"] != "login_link" {
+		return "", false, ErrInvalidLoginLink
+	}
+
+	jti, _ := token.Claims["jti"].(string)
+	id, _ := token.Claims["id"].(string)
+	userId, _ := uuid.FromString(id)
+
+	link, err := auth.repo.ConsumeLoginLink(ctx, userId, jti)
+	if err != nil || link.TokenId == "" {
+		return "", false, ErrInvalidLoginLink
+	}
+
+	return auth.completeLoginLink(ctx, link)
+}
+
+// RedeemLoginCode logs the user in with the code sent alongside a login link.
+// Too many wrong codes discard the link.
+func (auth *TokenAuthenticator) RedeemLoginCode(ctx context.Context, email string, code string) (string, bool, error) {
+	userId, _ := auth.repo.FindEmail(ctx, email)
+	if userId == uuid.Nil {
+		return "", false, ErrInvalidLoginLink
+	}
+
+	link, err := auth.repo.GetLoginLink(ctx, userId)
+	if err != nil || link.TokenId == "" || time.Now().After(link.ExpiryDate) || link.FailedAttempts >= LoginCodeMaxAttempts {
+		return "", false, ErrInvalidLoginLink
+	}
+
+	if subtle.ConstantTimeCompare([]byte(hashOpaqueToken(code)), []byte(link.CodeHash)) != 1 {
+		// Counted in the repo rather than saved back, so racing wrong codes are
+		// all counted and a link requested meanwhile is left alone.
+		if err := auth.repo.RecordLoginCodeFailure(ctx, userId, link.TokenId, LoginCodeMaxAttempts); err != nil && err != ErrNotFound {
+			fmt.Printf("ERROR: %v\n", err.Error())
+		}
+
+		return "", false, ErrInvalidLoginLink
+	}
+
+	consumed, err := auth.repo.ConsumeLoginLink(ctx, userId, link.TokenId)
+	if err != nil || consumed.TokenId == "" {
+		return "", false, ErrInvalidLoginLink
+	}
+
+	return auth.completeLoginLink(ctx, consumed)
+}
+
+// completeLoginLink marks the email as verified, since the user has proven
+// they receive mail there, and issues a token. Users with a second factor get
+// a challenge instead, as with Authenticate.
+func (auth *TokenAuthenticator) completeLoginLink(ctx context.Context, link *LoginLink) (string, bool, error) {
+	if time.Now().After(link.ExpiryDate) {
+		return "", false, ErrInvalidLoginLink
+	}
+
+	credentials, err := auth.repo.GetCredentials(ctx, link.UserId)
+	if err != nil || credentials.Id == uuid.Nil {
+		return "", false, ErrInvalidLoginLink
+	}
+
+	verified := false
+
+	if !credentials.IsEmailVerified {
+		credentials, err = UpdateCredentials(ctx, auth.repo, credentials, func(credentials *Credentials) error {
+			verified = !credentials.IsEmailVerified
+			if verified {
+				credentials.confirmEmail(time.Now())
+			}
+
+			return nil
+		})
+
+		if err != nil {
+			return "", false, err
+		}
+	}
+
+	if credentials.IsTOTPEnabled {
+		challenge, err := auth.issueMFAChallenge(credentials, []string{AmrEmail})
+		if err != nil {
+			return "", verified, err
+		}
+
+		return challenge, verified, ErrMFARequired
+	}
+
+	token, err := auth.issueToken(credentials, []string{AmrEmail})
+
+	return token, verified, err
+}
+
+// generateLoginCode returns a random numeric code with LoginCodeDigits
+// digits.
+func generateLoginCode() (string, error) {
+	max := big.NewInt(1)
+	for i := 0; i < LoginCodeDigits; i++ {
+		max.Mul(max, big.NewInt(10))
+	}
+
+	value, err := rand.Int(rand.Reader, max)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%0*d", LoginCodeDigits, value), nil
+}
+
+// Sends a passwordless login link. The response is the same whether or not
+// the email is registered, the link and code only go out in the published
+// event.
+func RequestLoginLink(c *gin.Context) {
+	auth := c.MustGet("auth").(Authenticator)
+	publisher := c.MustGet("publisher").(Publisher)
+
+	c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
+
+	var view *LoginLinkRequestView
+	c.Bind(&view)
+
+	if view == nil || view.Email == "" {
+		c.JSON(http.StatusBadRequest, NewError(ErrCodeValueRequired, "email is a required field"))
+		return
+	}
+
+	email := strings.ToLower(view.Email)
+
+	userId, token, code, err := auth.RequestLoginLink(c.Request.Context(), email)
+	if err != nil {
+		fmt.Printf("ERROR: %v\n", err.Error())
+	}
+
+	if userId != uuid.Nil && token != "" {
+		go publisher.PublishMessage(NewLoginLinkRequestedEvent(userId, email, token, code, uuid.Nil))
+	}
+
+	c.JSON(http.StatusAccepted, "login link requested")
+	return
+}
+
+// Redeems a login link token, or an email and login code, for an Auth token
+func RedeemLoginLink(c *gin.Context) {
+	auth := c.MustGet("auth").(Authenticator)
+
+	c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
+
+	var view *LoginLinkRedemptionView
+	c.Bind(&view)
+
+	var token string
+	var verified bool
+	var link_err error
+
+	switch {
+	case view != nil && view.Token != "":
+		token, verified, link_err = auth.RedeemLoginLink(c.Request.Context(), view.Token)
+	case view != nil && view.Email != "" && view.Code != "":
+		token, verified, link_err = auth.RedeemLoginCode(c.Request.Context(), strings.ToLower(view.Email), view.Code)
+	default:
+		c.JSON(http.StatusBadRequest, NewError(ErrCodeValueRequired, "token, or email and code, are required fields"))
+		return
+	}
+
+	// Redeeming the link verified the email even when a second factor is
+	// still to come.
+	if verified && (link_err == nil || link_err == ErrMFARequired) {
+		publishEmailVerified(c, auth, token)
+	}
+
+	if link_err == ErrMFARequired {
+		c.JSON(http.StatusUnauthorized, newMFAChallengeResponse(token))
+		return
+	}
+
+	if link_err == ErrInvalidLoginLink {
+		c.JSON(http.StatusUnauthorized, NewError(ErrCodeInvalidToken, "login link or code is invalid"))
+		return
+	}
+
+	if link_err == ErrConflict {
+		c.JSON(http.StatusConflict, NewError(ErrCodeConflict, "credentials were changed by another request"))
+		return
+	}
+
+	if link_err != nil {
+		c.JSON(http.StatusInternalServerError, link_err.Error())
+		return
+	}
+
+	id, _ := auth.GetTokenClaim(token, "id")
+	email, _ := auth.GetTokenClaim(token, "email")
+	userId, _ := uuid.FromString(id.(string))
+
+	refreshToken, refresh_err := auth.IssueRefreshToken(c.Request.Context(), userId, tokenAmr(auth, token))
+	if refresh_err != nil {
+		c.JSON(http.StatusInternalServerError, refresh_err.Error())
+		return
+	}
+
+	response := AuthResponse{
+		Id:           userId,
+		Email:        email.(string),
+		Token:        token,
+		RefreshToken: refreshToken,
+	}
+
+	c.JSON(http.StatusOK, response)
+	return
+}
+
+// publishEmailVerified announces that the user the token was issued to has
+// verified their email. MFA challenges carry no email, so it is looked up.
+func publishEmailVerified(c *gin.Context, auth Authenticator, token string) {
+	repo := c.MustGet("repo").(Repo)
+	publisher := c.MustGet("publisher").(Publisher)
+
+	id, _ := auth.GetTokenClaim(token, "id")
+	userId, _ := uuid.FromString(fmt.Sprint(id))
+
+	credentials, err := repo.GetCredentials(c.Request.Context(), userId)
+	if err != nil {
+		return
+	}
+
+	go publisher.PublishMessage(NewEmailVerifiedEvent(userId, credentials.Email, uuid.Nil))
+}
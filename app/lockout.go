@@ -0,0 +1,334 @@
+// Copyright (c) Luke Atherton 2015
+
+package authenticator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	. "github.com/lukeatherton/domain-events"
+	"github.com/satori/go.uuid"
+)
+
+var (
+	// After LoginDelayThreshold consecutive failures each further attempt
+	// must wait, starting at LoginDelayBase and doubling up to LoginDelayMax.
+	LoginDelayThreshold = 3
+	LoginDelayBase      = time.Second
+	LoginDelayMax       = time.Minute
+
+	// LockoutThreshold consecutive failures lock the account for
+	// LockoutDuration, or until an admin unlocks it.
+	LockoutThreshold = 10
+	LockoutDuration  = time.Minute * 15
+
+	// Each client IP may fail LoginThrottleLimit logins per
+	// LoginThrottleWindow, across every account.
+	LoginThrottleLimit  = 100
+	LoginThrottleWindow = time.Minute * 15
+
+	// AdminScope must be granted to a client to unlock accounts.
+	AdminScope = "users:admin"
+)
+
+var (
+	ErrInvalidPassword = errors.New("Authentication Failed: Invalid password.")
+	// ErrAccountLocked is returned for the failure that locks the account so
+	// it can be reported. It must be shown to the client as
+	// ErrInvalidPassword.
+	ErrAccountLocked = errors.New("Authentication Failed: Account locked.")
+)
+
+// isLockedOut reports whether login attempts are currently refused, either
+// because the account is locked or the delay after the last failure has not
+// passed yet.
+func (credentials *Credentials) isLockedOut(now time.Time) bool {
+	if now.Before(credentials.LockedUntil) {
+		return true
+	}
+
+	if credentials.FailedLoginAttempts < LoginDelayThreshold {
+		return false
+	}
+
+	return now.Before(credentials.LastFailedLoginDate.Add(loginDelay(credentials.FailedLoginAttempts)))
+}
+
+func loginDelay(failedAttempts int) time.Duration {
+	delay := LoginDelayBase
+
+	for i := LoginDelayThreshold; i < failedAttempts && delay < LoginDelayMax; i++ {
+		delay *= 2
+	}
+
+	if delay > LoginDelayMax {
+		return LoginDelayMax
+	}
+
+	return delay
+}
+
+// recordLoginFailure counts a failed attempt, locking the account once there
+// have been too many. It reports whether this failure locked the account.
+// Failures racing each other are all counted.
+func (auth *TokenAuthenticator) recordLoginFailure(ctx context.Context, credentials *Credentials, now time.Time) (bool, error) {
+	var locked bool
+
+	_, err := UpdateCredentials(ctx, auth.repo, credentials, func(credentials *Credentials) error {
+		locked = credentials.addLoginFailure(now)
+
+		return nil
+	})
+
+	return locked, err
+}
+
+// addLoginFailure counts a failed attempt on the credentials, locking the
+// account once there have been too many. It reports whether this failure
+// locked the account.
+func (credentials *Credentials) addLoginFailure(now time.Time) bool {
+	credentials.FailedLoginAttempts++
+	credentials.LastFailedLoginDate = now
+
+	if credentials.FailedLoginAttempts < LockoutThreshold {
+		return false
+	}
+
+	credentials.FailedLoginAttempts = 0
+	credentials.LockedUntil = now.Add(LockoutDuration)
+
+	return true
+}
+
+// resetLoginFailures clears the failure count after a successful login, and
+// returns the credentials as saved. A password changed by a racing request
+// was not the one checked, so the login fails instead.
+func (auth *TokenAuthenticator) resetLoginFailures(ctx context.Context, credentials *Credentials) (*Credentials, error) {
+	if credentials.FailedLoginAttempts == 0 && credentials.LockedUntil.IsZero() {
+		return credentials, nil
+	}
+
+	changedDate := credentials.PasswordChangedDate
+
+	return UpdateCredentials(ctx, auth.repo, credentials, func(credentials *Credentials) error {
+		if !credentials.PasswordChangedDate.Equal(changedDate) {
+			return ErrInvalidPassword
+		}
+
+		return clearLoginFailures(credentials)
+	})
+}
+
+// UnlockAccount lifts a lockout and clears any failed login attempts.
+func (auth *TokenAuthenticator) UnlockAccount(ctx context.Context, userId uuid.UUID) error {
+	credentials, err := auth.repo.GetCredentials(ctx, userId)
+	if err != nil {
+		return err
+	}
+
+	_, err = UpdateCredentials(ctx, auth.repo, credentials, clearLoginFailures)
+
+	return err
+}
+
+func clearLoginFailures(credentials *Credentials) error {
+	credentials.FailedLoginAttempts = 0
+	credentials.LastFailedLoginDate = time.Time{}
+	credentials.LockedUntil = time.Time{}
+	credentials.MFAChallengeId = ""
+	credentials.FailedMFAAttempts = 0
+
+	return nil
+}
+
+//=====================================================================================
+
+// A LoginThrottle counts failed logins per client IP within a fixed window,
+// so one client cannot guess passwords across many accounts.
+type LoginThrottle struct {
+	sync.Mutex
+	limit    int
+	window   time.Duration
+	failures map[string]*loginFailures
+}
+
+type loginFailures struct {
+	count       int
+	windowStart time.Time
+}
+
+func NewLoginThrottle(limit int, window time.Duration) *LoginThrottle {
+	return &LoginThrottle{
+		limit:    limit,
+		window:   window,
+		failures: make(map[string]*loginFailures),
+	}
+}
+
+// IsThrottled reports whether the IP has used up its failed logins.
+func (throttle *LoginThrottle) IsThrottled(ip string) bool {
+	throttle.Lock()
+	defer throttle.Unlock()
+
+	failures, ok := throttle.failures[ip]
+	if !ok || time.Since(failures.windowStart) > throttle.window {
+		return false
+	}
+
+	return failures.count >= throttle.limit
+}
+
+// AddFailure counts a failed login from the IP.
+func (throttle *LoginThrottle) AddFailure(ip string) {
+	throttle.Lock()
+	defer throttle.Unlock()
+
+	now := time.Now()
+
+	failures, ok := throttle.failures[ip]
+	if !ok || now.Sub(failures.windowStart) > throttle.window {
+		throttle.sweep(now)
+
+		failures = &loginFailures{windowStart: now}
+		throttle.failures[ip] = failures
+	}
+
+	failures.count++
+}
+
+// sweep drops IPs whose window has passed, so the map does not grow without
+// bound.
+func (throttle *LoginThrottle) sweep(now time.Time) {
+	for ip, failures := range throttle.failures {
+		if now.Sub(failures.windowStart) > throttle.window {
+			delete(throttle.failures, ip)
+		}
+	}
+}
+
+func InitLoginThrottle(throttle *LoginThrottle) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set("loginThrottle", throttle)
+		c.Next()
+	}
+}
+
+// clientIP returns the address the request came from, without the port.
+func clientIP(c *gin.Context) string {
+	host, _, err := net.SplitHostPort(c.Request.RemoteAddr)
+	if err != nil {
+		return c.Request.RemoteAddr
+	}
+
+	return host
+}
+
+// publishAccountLocked announces that too many failed logins have locked the
+// account for the given email.
+func publishAccountLocked(c *gin.Context, email string) {
+	repo := c.MustGet("repo").(Repo)
+	publisher := c.MustGet("publisher").(Publisher)
+
+	userId, _ := repo.FindEmail(c.Request.Context(), email)
+	if userId == uuid.Nil {
+		return
+	}
+
+	credentials, err := repo.GetCredentials(c.Request.Context(), userId)
+	if err != nil {
+		return
+	}
+
+	go publisher.PublishMessage(NewAccountLockedEvent(userId, email, credentials.LockedUntil, uuid.Nil))
+}
+
+// publishUserLocked announces that too many failed logins have locked the
+// given user's account, for when only the user id is known.
+func publishUserLocked(c *gin.Context, userId uuid.UUID) {
+	repo := c.MustGet("repo").(Repo)
+	publisher := c.MustGet("publisher").(Publisher)
+
+	credentials, err := repo.GetCredentials(c.Request.Context(), userId)
+	if err != nil {
+		return
+	}
+
+	go publisher.PublishMessage(NewAccountLockedEvent(userId, credentials.Email, credentials.LockedUntil, uuid.Nil))
+}
+
+//=====================================================================================
+
+// ClientAuthorization only lets through client credentials tokens that have
+// been granted the given scope.
+func ClientAuthorization(auth Authenticator, scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		authorizationArray := strings.SplitN(c.Request.Header.Get("Authorization"), " ", 2)
+
+		if len(authorizationArray) != 2 || authorizationArray[0] != "Bearer" {
+			c.Writer.Header().Set("WWW-Authenticate", "Bearer realm=\"client\"")
+			c.JSON(http.StatusUnauthorized, http.StatusText(401))
+			c.Abort()
+			return
+		}
+
+		if !auth.ValidateToken(c.Request.Context(), authorizationArray[1]) {
+			c.JSON(http.StatusUnauthorized, "authorization failed")
+			c.Abort()
+			return
+		}
+
+		clientId, _ := auth.GetTokenClaim(authorizationArray[1], "client_id")
+		grantedScope, _ := auth.GetTokenClaim(authorizationArray[1], "scope")
+		granted, _ := grantedScope.(string)
+
+		if _, ok := clientId.(string); !ok || !hasScope(granted, scope) {
+			c.JSON(http.StatusForbidden, "insufficient scope")
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// Lifts a lockout on the account with the given email
+func UnlockAccount(c *gin.Context) {
+	auth := c.MustGet("auth").(Authenticator)
+	repo := c.MustGet("repo").(Repo)
+
+	var view *AccountUnlockView
+	c.Bind(&view)
+
+	if view == nil || view.Email == "" {
+		c.JSON(http.StatusBadRequest, NewError(ErrCodeValueRequired, "email is a required field"))
+		return
+	}
+
+	userId, _ := repo.FindEmail(c.Request.Context(), strings.ToLower(view.Email))
+	if userId == uuid.Nil {
+		c.JSON(http.StatusNotFound, NewError(ErrCodeNotExist, "account does not exist"))
+		return
+	}
+
+	err := auth.UnlockAccount(c.Request.Context(), userId)
+	if err == ErrConflict {
+		c.JSON(http.StatusConflict, NewError(ErrCodeConflict, "credentials were changed by another request"))
+		return
+	}
+
+	if err != nil {
+		fmt.Printf("ERROR: %v\n", err.Error())
+		c.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, "account unlocked")
+	return
+}
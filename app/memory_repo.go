@@ -0,0 +1,563 @@
+// Copyright (c) Luke Atherton 2015
+
+package authenticator
+
+import (
+	"context"
+	"sync"
+
+	"github.com/satori/go.uuid"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// A MemoryRepo keeps everything in memory, for tests and local development
+// without a database. Records are stored BSON encoded, as MongoDBRepo stores
+// them, so callers always get copies and see the same field handling. The
+// unique indexes of MongoDBRepo are enforced, and lookups that find nothing
+// return ErrNotFound like it does. Nothing here blocks for long, so contexts
+// are only checked before each operation starts.
+type MemoryRepo struct {
+	mutex sync.RWMutex
+
+	credentials         map[uuid.UUID][]byte
+	emails              map[string]uuid.UUID
+	webAuthnCredentials map[string]uuid.UUID
+
+	refreshTokens      map[uuid.UUID][]byte
+	refreshTokenHashes map[string]uuid.UUID
+
+	clients            map[string][]byte
+	authorizationCodes map[string][]byte
+
+	passwordResets      map[uuid.UUID][]byte
+	passwordResetHashes map[string]uuid.UUID
+
+	loginLinks map[uuid.UUID][]byte
+}
+
+func NewMemoryRepo() TestRepo {
+	repo := &MemoryRepo{}
+	repo.Cleanup()
+
+	return repo
+}
+
+// Cleanup removes everything from the repo.
+func (repo *MemoryRepo) Cleanup() {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+
+	repo.credentials = make(map[uuid.UUID][]byte)
+	repo.emails = make(map[string]uuid.UUID)
+	repo.webAuthnCredentials = make(map[string]uuid.UUID)
+	repo.refreshTokens = make(map[uuid.UUID][]byte)
+	repo.refreshTokenHashes = make(map[string]uuid.UUID)
+	repo.clients = make(map[string][]byte)
+	repo.authorizationCodes = make(map[string][]byte)
+	repo.passwordResets = make(map[uuid.UUID][]byte)
+	repo.passwordResetHashes = make(map[string]uuid.UUID)
+	repo.loginLinks = make(map[uuid.UUID][]byte)
+}
+
+// SaveCredentials inserts new credentials, or replaces saved ones whose
+// version still matches. Like the unique indexes on the credentials
+// collection, an email or WebAuthn credential may only belong to one user.
+func (repo *MemoryRepo) SaveCredentials(ctx context.Context, userId uuid.UUID, credentials *Credentials) (err error) {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	saved := *credentials
+	saved.Version++
+
+	data, err := bson.Marshal(&saved)
+	if err != nil {
+		return err
+	}
+
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+
+	old := &Credentials{}
+	previous, exists := repo.credentials[userId]
+	if exists {
+		bson.Unmarshal(previous, old)
+	}
+
+	if old.Version != credentials.Version {
+		return ErrConflict
+	}
+
+	if id, ok := repo.emails[credentials.Email]; ok && id != userId {
+		return ErrDuplicateEmail
+	}
+
+	for _, webAuthnCredential := range credentials.WebAuthnCredentials {
+		if id, ok := repo.webAuthnCredentials[string(webAuthnCredential.CredentialId)]; ok && id != userId {
+			return ErrDuplicateKey
+		}
+	}
+
+	if exists {
+		delete(repo.emails, old.Email)
+		for _, webAuthnCredential := range old.WebAuthnCredentials {
+			delete(repo.webAuthnCredentials, string(webAuthnCredential.CredentialId))
+		}
+	}
+
+	repo.credentials[userId] = data
+	repo.emails[credentials.Email] = userId
+	for _, webAuthnCredential := range credentials.WebAuthnCredentials {
+		repo.webAuthnCredentials[string(webAuthnCredential.CredentialId)] = userId
+	}
+
+	credentials.Version = saved.Version
+
+	return nil
+}
+
+func (repo *MemoryRepo) GetCredentials(ctx context.Context, userId uuid.UUID) (credentials *Credentials, err error) {
+	if err := ctx.Err(); err != nil {
+		return &Credentials{}, err
+	}
+
+	repo.mutex.RLock()
+	defer repo.mutex.RUnlock()
+
+	result := &Credentials{}
+
+	data, ok := repo.credentials[userId]
+	if !ok {
+		return result, ErrNotFound
+	}
+
+	return result, bson.Unmarshal(data, result)
+}
+
+func (repo *MemoryRepo) FindEmail(ctx context.Context, email string) (id uuid.UUID, err error) {
+	if err := ctx.Err(); err != nil {
+		return uuid.Nil, err
+	}
+
+	repo.mutex.RLock()
+	defer repo.mutex.RUnlock()
+
+	id, ok := repo.emails[email]
+	if !ok {
+		return uuid.Nil, ErrNotFound
+	}
+
+	return id, nil
+}
+
+func (repo *MemoryRepo) FindWebAuthnCredential(ctx context.Context, credentialId []byte) (id uuid.UUID, err error) {
+	if err := ctx.Err(); err != nil {
+		return uuid.Nil, err
+	}
+
+	repo.mutex.RLock()
+	defer repo.mutex.RUnlock()
+
+	id, ok := repo.webAuthnCredentials[string(credentialId)]
+	if !ok {
+		return uuid.Nil, ErrNotFound
+	}
+
+	return id, nil
+}
+
+func (repo *MemoryRepo) SaveRefreshToken(ctx context.Context, token *RefreshToken) (err error) {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	data, err := bson.Marshal(token)
+	if err != nil {
+		return err
+	}
+
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+
+	if id, ok := repo.refreshTokenHashes[token.TokenHash]; ok && id != token.Id {
+		return ErrDuplicateKey
+	}
+
+	if previous, ok := repo.refreshTokens[token.Id]; ok {
+		old := &RefreshToken{}
+		bson.Unmarshal(previous, old)
+		delete(repo.refreshTokenHashes, old.TokenHash)
+	}
+
+	repo.refreshTokens[token.Id] = data
+	repo.refreshTokenHashes[token.TokenHash] = token.Id
+
+	return nil
+}
+
+func (repo *MemoryRepo) GetRefreshToken(ctx context.Context, tokenHash string) (token *RefreshToken, err error) {
+	if err := ctx.Err(); err != nil {
+		return &RefreshToken{}, err
+	}
+
+	repo.mutex.RLock()
+	defer repo.mutex.RUnlock()
+
+	result := &RefreshToken{}
+
+	id, ok := repo.refreshTokenHashes[tokenHash]
+	if !ok {
+		return result, ErrNotFound
+	}
+
+	return result, bson.Unmarshal(repo.refreshTokens[id], result)
+}
+
+// ConsumeRefreshToken marks a refresh token as used and returns the token as
+// it was before the update, so callers can tell whether it had already been
+// used.
+func (repo *MemoryRepo) ConsumeRefreshToken(ctx context.Context, tokenHash string) (token *RefreshToken, err error) {
+	if err := ctx.Err(); err != nil {
+		return &RefreshToken{}, err
+	}
+
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+
+	result := &RefreshToken{}
+
+	id, ok := repo.refreshTokenHashes[tokenHash]
+	if !ok {
+		return result, ErrNotFound
+	}
+
+	if err := bson.Unmarshal(repo.refreshTokens[id], result); err != nil {
+		return result, err
+	}
+
+	used := *result
+	used.IsUsed = true
+
+	return result, repo.updateRefreshToken(&used)
+}
+
+func (repo *MemoryRepo) RevokeRefreshTokenFamily(ctx context.Context, familyId uuid.UUID) (err error) {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return repo.revokeRefreshTokens(func(token *RefreshToken) bool {
+		return token.FamilyId == familyId
+	})
+}
+
+func (repo *MemoryRepo) RevokeUserRefreshTokens(ctx context.Context, userId uuid.UUID) (err error) {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return repo.revokeRefreshTokens(func(token *RefreshToken) bool {
+		return token.UserId == userId
+	})
+}
+
+func (repo *MemoryRepo) revokeRefreshTokens(match func(token *RefreshToken) bool) error {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+
+	for _, data := range repo.refreshTokens {
+		token := &RefreshToken{}
+		if err := bson.Unmarshal(data, token); err != nil {
+			return err
+		}
+
+		if !match(token) {
+			continue
+		}
+
+		token.IsRevoked = true
+
+		if err := repo.updateRefreshToken(token); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// updateRefreshToken replaces a stored token. The mutex must be held.
+func (repo *MemoryRepo) updateRefreshToken(token *RefreshToken) error {
+	data, err := bson.Marshal(token)
+	if err != nil {
+		return err
+	}
+
+	repo.refreshTokens[token.Id] = data
+
+	return nil
+}
+
+func (repo *MemoryRepo) SaveClient(ctx context.Context, client *Client) (err error) {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	data, err := bson.Marshal(client)
+	if err != nil {
+		return err
+	}
+
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+
+	repo.clients[client.ClientId] = data
+
+	return nil
+}
+
+func (repo *MemoryRepo) GetClient(ctx context.Context, clientId string) (client *Client, err error) {
+	if err := ctx.Err(); err != nil {
+		return &Client{}, err
+	}
+
+	repo.mutex.RLock()
+	defer repo.mutex.RUnlock()
+
+	result := &Client{}
+
+	data, ok := repo.clients[clientId]
+	if !ok {
+		return result, ErrNotFound
+	}
+
+	return result, bson.Unmarshal(data, result)
+}
+
+func (repo *MemoryRepo) SaveAuthorizationCode(ctx context.Context, code *AuthorizationCode) (err error) {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	data, err := bson.Marshal(code)
+	if err != nil {
+		return err
+	}
+
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+
+	if _, ok := repo.authorizationCodes[code.CodeHash]; ok {
+		return ErrDuplicateKey
+	}
+
+	repo.authorizationCodes[code.CodeHash] = data
+
+	return nil
+}
+
+// ConsumeAuthorizationCode removes an authorization code and returns it, so
+// a code can only ever be redeemed once.
+func (repo *MemoryRepo) ConsumeAuthorizationCode(ctx context.Context, codeHash string) (code *AuthorizationCode, err error) {
+	if err := ctx.Err(); err != nil {
+		return &AuthorizationCode{}, err
+	}
+
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+
+	result := &AuthorizationCode{}
+
+	data, ok := repo.authorizationCodes[codeHash]
+	if !ok {
+		return result, ErrNotFound
+	}
+
+	delete(repo.authorizationCodes, codeHash)
+
+	return result, bson.Unmarshal(data, result)
+}
+
+// SavePasswordReset stores a reset, replacing any reset already outstanding
+// for the same user.
+func (repo *MemoryRepo) SavePasswordReset(ctx context.Context, reset *PasswordReset) (err error) {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	data, err := bson.Marshal(reset)
+	if err != nil {
+		return err
+	}
+
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+
+	if userId, ok := repo.passwordResetHashes[reset.TokenHash]; ok && userId != reset.UserId {
+		return ErrDuplicateKey
+	}
+
+	if previous, ok := repo.passwordResets[reset.UserId]; ok {
+		old := &PasswordReset{}
+		bson.Unmarshal(previous, old)
+		delete(repo.passwordResetHashes, old.TokenHash)
+	}
+
+	repo.passwordResets[reset.UserId] = data
+	repo.passwordResetHashes[reset.TokenHash] = reset.UserId
+
+	return nil
+}
+
+// ConsumePasswordReset removes a reset and returns it, so a reset token can
+// only ever be used once.
+func (repo *MemoryRepo) ConsumePasswordReset(ctx context.Context, tokenHash string) (reset *PasswordReset, err error) {
+	if err := ctx.Err(); err != nil {
+		return &PasswordReset{}, err
+	}
+
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+
+	result := &PasswordReset{}
+
+	userId, ok := repo.passwordResetHashes[tokenHash]
+	if !ok {
+		return result, ErrNotFound
+	}
+
+	data := repo.passwordResets[userId]
+	delete(repo.passwordResets, userId)
+	delete(repo.passwordResetHashes, tokenHash)
+
+	return result, bson.Unmarshal(data, result)
+}
+
+// RestorePasswordReset puts back a consumed reset, unless the user has
+// requested another one since.
+func (repo *MemoryRepo) RestorePasswordReset(ctx context.Context, reset *PasswordReset) (err error) {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	data, err := bson.Marshal(reset)
+	if err != nil {
+		return err
+	}
+
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+
+	if _, ok := repo.passwordResets[reset.UserId]; ok {
+		return nil
+	}
+
+	if _, ok := repo.passwordResetHashes[reset.TokenHash]; ok {
+		return ErrDuplicateKey
+	}
+
+	repo.passwordResets[reset.UserId] = data
+	repo.passwordResetHashes[reset.TokenHash] = reset.UserId
+
+	return nil
+}
+
+// SaveLoginLink stores a login link, replacing any link already outstanding
+// for the same user.
+func (repo *MemoryRepo) SaveLoginLink(ctx context.Context, link *LoginLink) (err error) {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	data, err := bson.Marshal(link)
+	if err != nil {
+		return err
+	}
+
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+
+	repo.loginLinks[link.UserId] = data
+
+	return nil
+}
+
+func (repo *MemoryRepo) GetLoginLink(ctx context.Context, userId uuid.UUID) (link *LoginLink, err error) {
+	if err := ctx.Err(); err != nil {
+		return &LoginLink{}, err
+	}
+
+	repo.mutex.RLock()
+	defer repo.mutex.RUnlock()
+
+	result := &LoginLink{}
+
+	data, ok := repo.loginLinks[userId]
+	if !ok {
+		return result, ErrNotFound
+	}
+
+	return result, bson.Unmarshal(data, result)
+}
+
+// ConsumeLoginLink removes a login link and returns it. The token id must
+// match, so a link that has been replaced can no longer be used.
+func (repo *MemoryRepo) ConsumeLoginLink(ctx context.Context, userId uuid.UUID, tokenId string) (link *LoginLink, err error) {
+	if err := ctx.Err(); err != nil {
+		return &LoginLink{}, err
+	}
+
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+
+	result := &LoginLink{}
+
+	data, ok := repo.loginLinks[userId]
+	if !ok {
+		return result, ErrNotFound
+	}
+
+	if err := bson.Unmarshal(data, result); err != nil || result.TokenId != tokenId {
+		return &LoginLink{}, ErrNotFound
+	}
+
+	delete(repo.loginLinks, userId)
+
+	return result, nil
+}
+
+// RecordLoginCodeFailure counts a wrong code against a login link, and
+// removes the link once it has had maxAttempts. The token id must match, so
+// failures against a link that has been replaced are not counted.
+func (repo *MemoryRepo) RecordLoginCodeFailure(ctx context.Context, userId uuid.UUID, tokenId string, maxAttempts int) (err error) {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+
+	data, ok := repo.loginLinks[userId]
+	if !ok {
+		return ErrNotFound
+	}
+
+	link := &LoginLink{}
+	if err := bson.Unmarshal(data, link); err != nil || link.TokenId != tokenId {
+		return ErrNotFound
+	}
+
+	link.FailedAttempts++
+	if link.FailedAttempts >= maxAttempts {
+		delete(repo.loginLinks, userId)
+		return nil
+	}
+
+	data, err = bson.Marshal(link)
+	if err != nil {
+		return err
+	}
+
+	repo.loginLinks[userId] = data
+
+	return nil
+}
@@ -3,6 +3,8 @@
 package authenticator
 
 import (
+	"time"
+
 	. "github.com/lukeatherton/domain-events"
 	"github.com/satori/go.uuid"
 )
@@ -78,3 +80,115 @@ func NewEmailVerifiedEvent(id uuid.UUID, email string, senderId uuid.UUID) Email
 		Email:         email,
 	}
 }
+
+//=====================================================================================
+
+type PasswordResetRequested struct {
+	*MessageHeader `json:"header" xml:"header"`
+	Id             uuid.UUID `json:"id" xml:"id"`
+	Email          string    `json:"email" xml:"email"`
+	ResetToken     string    `json:"reset_token" xml:"reset_token"`
+}
+
+func NewPasswordResetRequestedEvent(id uuid.UUID, email string, resetToken string, senderId uuid.UUID) PasswordResetRequested {
+	return PasswordResetRequested{
+		MessageHeader: BuildHeader("Password.Reset.Requested", &EventSource{Service: SERVICE_NAME, UserId: senderId}),
+		Id:            id,
+		Email:         email,
+		ResetToken:    resetToken,
+	}
+}
+
+//=====================================================================================
+
+type RecoveryCodeUsed struct {
+	*MessageHeader `json:"header" xml:"header"`
+	Id             uuid.UUID `json:"id" xml:"id"`
+	Email          string    `json:"email" xml:"email"`
+}
+
+func NewRecoveryCodeUsedEvent(id uuid.UUID, email string, senderId uuid.UUID) RecoveryCodeUsed {
+	return RecoveryCodeUsed{
+		MessageHeader: BuildHeader("Mfa.RecoveryCode.Used", &EventSource{Service: SERVICE_NAME, UserId: senderId}),
+		Id:            id,
+		Email:         email,
+	}
+}
+
+//=====================================================================================
+
+type LoginLinkRequested struct {
+	*MessageHeader `json:"header" xml:"header"`
+	Id             uuid.UUID `json:"id" xml:"id"`
+	Email          string    `json:"email" xml:"email"`
+	LoginToken     string    `json:"login_token" xml:"login_token"`
+	LoginCode      string    `json:"login_code" xml:"login_code"`
+}
+
+func NewLoginLinkRequestedEvent(id uuid.UUID, email string, loginToken string, loginCode string, senderId uuid.UUID) LoginLinkRequested {
+	return LoginLinkRequested{
+		MessageHeader: BuildHeader("Login.Link.Requested", &EventSource{Service: SERVICE_NAME, UserId: senderId}),
+		Id:            id,
+		Email:         email,
+		LoginToken:    loginToken,
+		LoginCode:     loginCode,
+	}
+}
+
+//=====================================================================================
+
+type AccountLocked struct {
+	*MessageHeader `json:"header" xml:"header"`
+	Id             uuid.UUID `json:"id" xml:"id"`
+	Email          string    `json:"email" xml:"email"`
+	LockedUntil    time.Time `json:"locked_until" xml:"locked_until"`
+}
+
+func NewAccountLockedEvent(id uuid.UUID, email string, lockedUntil time.Time, senderId uuid.UUID) AccountLocked {
+	return AccountLocked{
+		MessageHeader: BuildHeader("Account.Locked", &EventSource{Service: SERVICE_NAME, UserId: senderId}),
+		Id:            id,
+		Email:         email,
+		LockedUntil:   lockedUntil,
+	}
+}
+
+//=====================================================================================
+
+// EmailChangeRequested is sent to both addresses, so the owner of the old one
+// hears about the change. Only the new address should get the code.
+type EmailChangeRequested struct {
+	*MessageHeader   `json:"header" xml:"header"`
+	Id               uuid.UUID `json:"id" xml:"id"`
+	Email            string    `json:"email" xml:"email"`
+	NewEmail         string    `json:"new_email" xml:"new_email"`
+	VerificationCode string    `json:"verification_code" xml:"verification_code"`
+}
+
+func NewEmailChangeRequestedEvent(id uuid.UUID, email string, newEmail string, verificationCode string, senderId uuid.UUID) EmailChangeRequested {
+	return EmailChangeRequested{
+		MessageHeader:    BuildHeader("Email.Change.Requested", &EventSource{Service: SERVICE_NAME, UserId: senderId}),
+		Id:               id,
+		Email:            email,
+		NewEmail:         newEmail,
+		VerificationCode: verificationCode,
+	}
+}
+
+//=====================================================================================
+
+type EmailChanged struct {
+	*MessageHeader `json:"header" xml:"header"`
+	Id             uuid.UUID `json:"id" xml:"id"`
+	Email          string    `json:"email" xml:"email"`
+	OldEmail       string    `json:"old_email" xml:"old_email"`
+}
+
+func NewEmailChangedEvent(id uuid.UUID, email string, oldEmail string, senderId uuid.UUID) EmailChanged {
+	return EmailChanged{
+		MessageHeader: BuildHeader("Email.Changed", &EventSource{Service: SERVICE_NAME, UserId: senderId}),
+		Id:            id,
+		Email:         email,
+		OldEmail:      oldEmail,
+	}
+}
@@ -0,0 +1,405 @@
+// Copyright (c) Luke Atherton 2015
+
+package authenticator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	. "github.com/lukeatherton/domain-events"
+	"github.com/satori/go.uuid"
+)
+
+var (
+	MFAChallengeLifetime = time.Minute * 5
+	// MFACodeMaxAttempts is the number of wrong codes after which a challenge
+	// is revoked and the user must log in again.
+	MFACodeMaxAttempts = 5
+)
+
+// Authentication method references recorded in the amr claim, see RFC 8176.
+// RFC 8176 has no value for proving control of an email address, so AmrEmail
+// is our own.
+const (
+	AmrPassword = "pwd"
+	AmrOTP      = "otp"
+	AmrMFA      = "mfa"
+	AmrEmail    = "email"
+)
+
+var (
+	ErrMFARequired         = errors.New("Authentication Failed: Multi-factor authentication required.")
+	ErrInvalidMFAChallenge = errors.New("Authentication Failed: Invalid or expired MFA challenge.")
+	ErrInvalidMFACode      = errors.New("Authentication Failed: Invalid MFA code.")
+	ErrTOTPAlreadyEnabled  = errors.New("TOTP is already enabled.")
+	ErrTOTPNotEnrolled     = errors.New("TOTP enrollment has not been started.")
+)
+
+// EnrollTOTP generates a new TOTP secret for the user. The secret is not used
+// to authenticate until it has been confirmed with ConfirmTOTP.
+func (auth *TokenAuthenticator) EnrollTOTP(ctx context.Context, userId uuid.UUID) (string, string, error) {
+	credentials, err := auth.repo.GetCredentials(ctx, userId)
+	if err != nil {
+		return "", "", err
+	}
+
+	secret, err := generateTOTPSecret()
+	if err != nil {
+		return "", "", err
+	}
+
+	credentials, err = UpdateCredentials(ctx, auth.repo, credentials, func(credentials *Credentials) error {
+		if credentials.IsTOTPEnabled {
+			return ErrTOTPAlreadyEnabled
+		}
+
+		credentials.TOTPSecret = secret
+		credentials.LastTOTPCounter = 0
+
+		return nil
+	})
+
+	if err != nil {
+		return "", "", err
+	}
+
+	return secret, TOTPUri(auth.totpIssuer(), credentials.Email, secret), nil
+}
+
+// ConfirmTOTP enables TOTP once the user proves their app generates valid
+// codes for the enrolled secret, and returns a fresh set of recovery codes.
+func (auth *TokenAuthenticator) ConfirmTOTP(ctx context.Context, userId uuid.UUID, code string) ([]string, error) {
+	credentials, err := auth.repo.GetCredentials(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	var recoveryCodes []string
+
+	_, err = UpdateCredentials(ctx, auth.repo, credentials, func(credentials *Credentials) error {
+		if credentials.IsTOTPEnabled {
+			return ErrTOTPAlreadyEnabled
+		}
+
+		if credentials.TOTPSecret == "" {
+			return ErrTOTPNotEnrolled
+		}
+
+		counter, ok := verifyTOTPCode(credentials.TOTPSecret, code, time.Now(), credentials.LastTOTPCounter)
+		if !ok {
+			return ErrInvalidMFACode
+		}
+
+		var err error
+		recoveryCodes, err = generateRecoveryCodes(credentials)
+		if err != nil {
+			return err
+		}
+
+		credentials.IsTOTPEnabled = true
+		credentials.LastTOTPCounter = counter
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return recoveryCodes, nil
+}
+
+// CompleteMFA exchanges the challenge token returned with ErrMFARequired and
+// a second factor code for an access token. The code may be a TOTP code or
+// one of the user's recovery codes, which is then used up. Wrong codes count
+// towards the account lockout like wrong passwords, and revoke the challenge
+// after MFACodeMaxAttempts. ErrAccountLocked is returned for the wrong code
+// that locks the account, and must be shown to the client as
+// ErrInvalidMFACode.
+func (auth *TokenAuthenticator) CompleteMFA(ctx context.Context, challengeToken string, code string) (string, bool, error) {
+	token, err := auth.parseToken(challengeToken)
+	if err != nil || token.Claims["token_use"] != "mfa" {
+		return "", false, ErrInvalidMFAChallenge
+	}
+
+	jti, _ := token.Claims["jti"].(string)
+	id, _ := token.Claims["id"].(string)
+	exp, _ := token.Claims["exp"].(float64)
+	amr, _ := token.Claims["amr"].([]interface{})
+	userId, _ := uuid.FromString(id)
+
+	revoked, err := auth.revocations.IsRevoked(ctx, jti, userId, tokenIssuedDate(token.Claims))
+	if err != nil || revoked {
+		return "", false, ErrInvalidMFAChallenge
+	}
+
+	credentials, err := auth.repo.GetCredentials(ctx, userId)
+	if err != nil || credentials.Id == uuid.Nil {
+		return "", false, ErrInvalidMFAChallenge
+	}
+
+	var usedRecoveryCode, failed, locked, exhausted bool
+
+	// The code is checked again on every attempt, so a TOTP code or recovery
+	// code used by a racing request cannot be used twice, and racing wrong
+	// codes are all counted.
+	credentials, err = UpdateCredentials(ctx, auth.repo, credentials, func(credentials *Credentials) error {
+		now := time.Now()
+		usedRecoveryCode, failed, locked, exhausted = false, false, false, false
+
+		// A locked out account is refused in the same way as a wrong code.
+		if !credentials.IsTOTPEnabled || credentials.isLockedOut(now) {
+			return ErrInvalidMFACode
+		}
+
+		if counter, ok := verifyTOTPCode(credentials.TOTPSecret, code, now, credentials.LastTOTPCounter); ok {
+			credentials.LastTOTPCounter = counter
+		} else if consumeRecoveryCode(credentials, code) {
+			usedRecoveryCode = true
+		} else {
+			failed = true
+			locked = credentials.addLoginFailure(now)
+			exhausted = credentials.addMFAFailure(jti)
+
+			return nil
+		}
+
+		return clearLoginFailures(credentials)
+	})
+
+	if err != nil {
+		return "", false, err
+	}
+
+	// A challenge only completes one login, and is given up once too many
+	// wrong codes have been tried with it.
+	if !failed || locked || exhausted {
+		if err := auth.revocations.RevokeToken(ctx, jti, time.Unix(int64(exp), 0)); err != nil {
+			return "", false, err
+		}
+	}
+
+	if locked {
+		return "", false, ErrAccountLocked
+	}
+
+	if failed {
+		return "", false, ErrInvalidMFACode
+	}
+
+	// The first factor recorded in the challenge is kept alongside the second.
+	methods := []string{}
+	for _, value := range amr {
+		if method, ok := value.(string); ok && method != AmrOTP {
+			methods = append(methods, method)
+		}
+	}
+
+	accessToken, err := auth.issueToken(credentials, append(methods, AmrOTP, AmrMFA))
+
+	return accessToken, usedRecoveryCode, err
+}
+
+// addMFAFailure counts a wrong code against the challenge, starting the count
+// again for a new challenge. It reports whether the challenge has had
+// MFACodeMaxAttempts wrong codes.
+func (credentials *Credentials) addMFAFailure(jti string) bool {
+	if credentials.MFAChallengeId != jti {
+		credentials.MFAChallengeId = jti
+		credentials.FailedMFAAttempts = 0
+	}
+
+	credentials.FailedMFAAttempts++
+
+	return credentials.FailedMFAAttempts >= MFACodeMaxAttempts
+}
+
+// issueMFAChallenge returns a short lived token recording that the user has
+// passed the first factor, and how. It is signed like an access token but
+// marked with token_use so it is never accepted as one.
+func (auth *TokenAuthenticator) issueMFAChallenge(credentials *Credentials, amr []string) (string, error) {
+	now := time.Now()
+
+	return auth.signToken(map[string]interface{}{
+		"jti":       uuid.NewV4().String(),
+		"iss":       auth.issuer,
+		"sub":       credentials.Id.String(),
+		"id":        credentials.Id.String(),
+		"amr":       amr,
+		"iat":       now.Unix(),
+		"iat_ms":    unixMilli(now),
+		"exp":       now.Add(MFAChallengeLifetime).Unix(),
+		"token_use": "mfa",
+	})
+}
+
+// totpIssuer names this service in authenticator apps.
+func (auth *TokenAuthenticator) totpIssuer() string {
+	issuer, err := url.Parse(auth.issuer)
+	if err != nil || issuer.Host == "" {
+		return auth.issuer
+	}
+
+	return issuer.Host
+}
+
+func newMFAChallengeResponse(challenge string) MFAChallengeResponse {
+	return MFAChallengeResponse{
+		MfaRequired: true,
+		MfaToken:    challenge,
+		Methods:     []string{"totp", "recovery_code"},
+	}
+}
+
+// tokenAmr returns the authentication methods recorded in a token.
+func tokenAmr(auth Authenticator, token string) []string {
+	amr := []string{}
+
+	claim, _ := auth.GetTokenClaim(token, "amr")
+	values, _ := claim.([]interface{})
+
+	for _, value := range values {
+		if method, ok := value.(string); ok {
+			amr = append(amr, method)
+		}
+	}
+
+	return amr
+}
+
+// Completes a login that requires a second factor and returns an Auth token
+func CompleteMFA(c *gin.Context) {
+	auth := c.MustGet("auth").(Authenticator)
+	publisher := c.MustGet("publisher").(Publisher)
+
+	c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
+
+	var view *MFAView
+	c.Bind(&view)
+
+	if view == nil || view.MfaToken == "" || view.Code == "" {
+		c.JSON(http.StatusBadRequest, NewError(ErrCodeValueRequired, "mfa token and code are required fields"))
+		return
+	}
+
+	token, usedRecoveryCode, mfa_err := auth.CompleteMFA(c.Request.Context(), view.MfaToken, view.Code)
+	if mfa_err == ErrAccountLocked {
+		id, _ := auth.GetTokenClaim(view.MfaToken, "id")
+		userId, _ := uuid.FromString(fmt.Sprint(id))
+		publishUserLocked(c, userId)
+		mfa_err = ErrInvalidMFACode
+	}
+
+	if mfa_err == ErrInvalidMFAChallenge || mfa_err == ErrInvalidMFACode {
+		c.JSON(http.StatusUnauthorized, NewError(ErrCodeInvalidToken, "mfa token or code is invalid"))
+		return
+	}
+
+	if mfa_err == ErrConflict {
+		c.JSON(http.StatusConflict, NewError(ErrCodeConflict, "credentials were changed by another request"))
+		return
+	}
+
+	if mfa_err != nil {
+		c.JSON(http.StatusInternalServerError, mfa_err.Error())
+		return
+	}
+
+	id, _ := auth.GetTokenClaim(token, "id")
+	email, _ := auth.GetTokenClaim(token, "email")
+	userId, _ := uuid.FromString(id.(string))
+
+	if usedRecoveryCode {
+		go publisher.PublishMessage(NewRecoveryCodeUsedEvent(userId, email.(string), uuid.Nil))
+	}
+
+	refreshToken, refresh_err := auth.IssueRefreshToken(c.Request.Context(), userId, tokenAmr(auth, token))
+	if refresh_err != nil {
+		c.JSON(http.StatusInternalServerError, refresh_err.Error())
+		return
+	}
+
+	response := AuthResponse{
+		Id:           userId,
+		Email:        email.(string),
+		Token:        token,
+		RefreshToken: refreshToken,
+	}
+
+	c.JSON(http.StatusOK, response)
+	return
+}
+
+// Starts TOTP enrollment and returns the secret to load into an
+// authenticator app
+func EnrollTOTP(c *gin.Context) {
+	auth := c.MustGet("auth").(Authenticator)
+	id := GetIdParam(c.MustGet("userId").(string), c)
+
+	if id == uuid.Nil {
+		return
+	}
+
+	secret, uri, err := auth.EnrollTOTP(c.Request.Context(), id)
+
+	if err == ErrTOTPAlreadyEnabled {
+		c.JSON(http.StatusBadRequest, NewError(ErrCodeAlreadyExists, "totp is already enabled"))
+		return
+	}
+
+	if err == ErrConflict {
+		c.JSON(http.StatusConflict, NewError(ErrCodeConflict, "credentials were changed by another request"))
+		return
+	}
+
+	if err != nil {
+		fmt.Printf("ERROR: %v\n", err.Error())
+		c.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusCreated, TOTPEnrollmentResponse{Secret: secret, Uri: uri})
+	return
+}
+
+// Enables TOTP once the user has entered a code from their authenticator app,
+// returning the user's recovery codes
+func ConfirmTOTP(c *gin.Context) {
+	auth := c.MustGet("auth").(Authenticator)
+	id := GetIdParam(c.MustGet("userId").(string), c)
+
+	if id == uuid.Nil {
+		return
+	}
+
+	var view *TOTPConfirmationView
+	c.Bind(&view)
+
+	if view == nil || view.Code == "" {
+		c.JSON(http.StatusBadRequest, NewError(ErrCodeValueRequired, "code is a required field"))
+		return
+	}
+
+	recoveryCodes, err := auth.ConfirmTOTP(c.Request.Context(), id, view.Code)
+
+	switch err {
+	case nil:
+		c.JSON(http.StatusOK, RecoveryCodesResponse{RecoveryCodes: recoveryCodes})
+	case ErrTOTPAlreadyEnabled:
+		c.JSON(http.StatusBadRequest, NewError(ErrCodeAlreadyExists, "totp is already enabled"))
+	case ErrTOTPNotEnrolled:
+		c.JSON(http.StatusBadRequest, NewError(ErrCodeNotExist, "totp enrollment has not been started"))
+	case ErrInvalidMFACode:
+		c.JSON(http.StatusBadRequest, NewError(ErrCodeInvalidToken, "code is invalid"))
+	case ErrConflict:
+		c.JSON(http.StatusConflict, NewError(ErrCodeConflict, "credentials were changed by another request"))
+	default:
+		c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return
+}
@@ -0,0 +1,170 @@
+// Copyright (c) Luke Atherton 2015
+
+package authenticator
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// A migration moves the SQL schema from the previous version to Version.
+// Released migrations are never edited, schema changes go in a new one.
+// Statements use the column types TEXT, INTEGER, BOOLEAN, BLOB and
+// TIMESTAMP, which each dialect maps to its own.
+type migration struct {
+	Version     int
+	Description string
+	Statements  []string
+}
+
+var migrations = []migration{
+	{
+		Version:     1,
+		Description: "create repo and revocation tables",
+		Statements: []string{
+			// Credentials are kept as the BSON document MongoDBRepo stored, so
+			// only the columns that are looked up need migrating.
+			`CREATE TABLE credentials (
+				id TEXT PRIMARY KEY,
+				email TEXT NOT NULL,
+				data BLOB NOT NULL
+			)`,
+			`CREATE UNIQUE INDEX credentials_email ON credentials (lower(email))`,
+
+			`CREATE TABLE webauthn_credentials (
+				credential_id BLOB PRIMARY KEY,
+				user_id TEXT NOT NULL
+			)`,
+			`CREATE INDEX webauthn_credentials_user_id ON webauthn_credentials (user_id)`,
+
+			`CREATE TABLE refresh_tokens (
+				id TEXT PRIMARY KEY,
+				family_id TEXT NOT NULL,
+				user_id TEXT NOT NULL,
+				token_hash TEXT NOT NULL UNIQUE,
+				is_used BOOLEAN NOT NULL,
+				is_revoked BOOLEAN NOT NULL,
+				amr TEXT NOT NULL,
+				created_date TIMESTAMP NOT NULL,
+				expiry_date TIMESTAMP NOT NULL
+			)`,
+			`CREATE INDEX refresh_tokens_family_id ON refresh_tokens (family_id)`,
+			`CREATE INDEX refresh_tokens_user_id ON refresh_tokens (user_id)`,
+
+			`CREATE TABLE clients (
+				client_id TEXT PRIMARY KEY,
+				name TEXT NOT NULL,
+				redirect_uris TEXT NOT NULL,
+				secret_salt BLOB,
+				secret_key BLOB,
+				scopes TEXT NOT NULL,
+				created_date TIMESTAMP NOT NULL
+			)`,
+
+			`CREATE TABLE authorization_codes (
+				code_hash TEXT PRIMARY KEY,
+				client_id TEXT NOT NULL,
+				user_id TEXT NOT NULL,
+				redirect_uri TEXT NOT NULL,
+				scope TEXT NOT NULL,
+				nonce TEXT NOT NULL,
+				code_challenge TEXT NOT NULL,
+				code_challenge_method TEXT NOT NULL,
+				auth_time TIMESTAMP NOT NULL,
+				amr TEXT NOT NULL,
+				expiry_date TIMESTAMP NOT NULL
+			)`,
+
+			`CREATE TABLE password_resets (
+				user_id TEXT PRIMARY KEY,
+				token_hash TEXT NOT NULL UNIQUE,
+				created_date TIMESTAMP NOT NULL,
+				expiry_date TIMESTAMP NOT NULL
+			)`,
+
+			`CREATE TABLE login_links (
+				user_id TEXT PRIMARY KEY,
+				token_id TEXT NOT NULL,
+				code_hash TEXT NOT NULL,
+				failed_attempts INTEGER NOT NULL,
+				created_date TIMESTAMP NOT NULL,
+				expiry_date TIMESTAMP NOT NULL
+			)`,
+
+			`CREATE TABLE revoked_tokens (
+				jti TEXT PRIMARY KEY,
+				expiry_date TIMESTAMP NOT NULL
+			)`,
+
+			`CREATE TABLE revoked_users (
+				user_id TEXT PRIMARY KEY,
+				revoked_date TIMESTAMP NOT NULL
+			)`,
+		},
+	},
+	{
+		Version:     2,
+		Description: "version credentials",
+		Statements: []string{
+			// The version is also in the BSON document, but saves compare
+			// against the column.
+			`ALTER TABLE credentials ADD COLUMN version INTEGER NOT NULL DEFAULT 0`,
+		},
+	},
+}
+
+// migrateSQL applies the migrations newer than the version recorded in
+// schema_migrations, all in one transaction so a failed migration leaves the
+// schema as it was.
+func migrateSQL(db *sql.DB, dialect *sqlDialect) error {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		description TEXT NOT NULL,
+		applied_date ` + dialect.columnTypes.Replace("TIMESTAMP") + ` NOT NULL
+	)`)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Another instance starting at the same time waits here, then finds
+	// the migrations already applied.
+	if dialect.lockMigrations != "" {
+		if _, err := tx.Exec(dialect.lockMigrations); err != nil {
+			return err
+		}
+	}
+
+	var current int
+	if err := tx.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current); err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		if m.Version <= current {
+			continue
+		}
+
+		for _, statement := range m.Statements {
+			if _, err := tx.Exec(dialect.columnTypes.Replace(statement)); err != nil {
+				return fmt.Errorf("migration %d: %v", m.Version, err)
+			}
+		}
+
+		_, err := tx.Exec(dialect.rebind(`INSERT INTO schema_migrations (version, description, applied_date) VALUES (?, ?, ?)`),
+			m.Version, m.Description, time.Now().UTC())
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Applied migration %d: %s\n", m.Version, m.Description)
+	}
+
+	return tx.Commit()
+}
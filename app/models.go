@@ -10,23 +10,146 @@ import (
 )
 
 type Credentials struct {
-	XMLName               xml.Name  `json:"-" xml:"credentials" bson:"-"`
-	Id                    uuid.UUID `json:"id" xml:"id" bson:"id,omitempty"`
-	Email                 string    `json:"email" xml:"email" bson:"email"`
-	Salt                  []byte    `json:"salt" xml:"salt" bson:"salt"`
-	Key                   []byte    `json:"key" xml:"key" bson:"key"`
-	IsEmailVerified       bool      `json:"isEmailVerified" xml:"isEmailVerified" bson:"isEmailVerified"`
-	EmailVerificationCode string    `json:"emailVerificationCode" xml:"emailVerificationCode" bson:"emailVerificationCode"`
-	CreatedDate           time.Time `json:"createdDate" xml:"createdDate"  bson:"createdDate"`
-	LastModifiedDate      time.Time `json:"lastModifiedDate" xml:"lastModifiedDate"  bson:"lastModifiedDate"`
-	ConfirmedDate         time.Time `json:"confirmedDate" xml:"confirmedDate"  bson:"confirmedDate"`
+	XMLName              xml.Name              `json:"-" xml:"credentials" bson:"-"`
+	Id                   uuid.UUID             `json:"id" xml:"id" bson:"id,omitempty"`
+	Email                string                `json:"email" xml:"email" bson:"email"`
+	Salt                 []byte                `json:"salt" xml:"salt" bson:"salt"`
+	Key                  []byte                `json:"key" xml:"key" bson:"key"`
+	PasswordHash         string                `json:"-" xml:"-" bson:"passwordHash"`
+	PasswordHistory      []string              `json:"-" xml:"-" bson:"passwordHistory,omitempty"`
+	PasswordChangedDate  time.Time             `json:"-" xml:"-" bson:"passwordChangedDate"`
+	TOTPSecret           string                `json:"-" xml:"-" bson:"totpSecret"`
+	IsTOTPEnabled        bool                  `json:"isTotpEnabled" xml:"isTotpEnabled" bson:"isTotpEnabled"`
+	LastTOTPCounter      int64                 `json:"-" xml:"-" bson:"lastTotpCounter"`
+	RecoveryCodeHashes   []string              `json:"-" xml:"-" bson:"recoveryCodeHashes,omitempty"`
+	FailedLoginAttempts  int                   `json:"-" xml:"-" bson:"failedLoginAttempts"`
+	LastFailedLoginDate  time.Time             `json:"-" xml:"-" bson:"lastFailedLoginDate"`
+	LockedUntil          time.Time             `json:"-" xml:"-" bson:"lockedUntil"`
+	MFAChallengeId       string                `json:"-" xml:"-" bson:"mfaChallengeId,omitempty"`
+	FailedMFAAttempts    int                   `json:"-" xml:"-" bson:"failedMfaAttempts"`
+	WebAuthnCredentials  []*WebAuthnCredential `json:"-" xml:"-" bson:"webAuthnCredentials,omitempty"`
+	IsEmailVerified      bool                  `json:"isEmailVerified" xml:"isEmailVerified" bson:"isEmailVerified"`
+	VerificationCodeHash string                `json:"-" xml:"-" bson:"emailVerificationCodeHash"`
+	VerificationExpiry   time.Time             `json:"-" xml:"-" bson:"emailVerificationExpiry"`
+	LegacyVerification   string                `json:"-" xml:"-" bson:"emailVerificationCode,omitempty"`
+	PendingEmail         string                `json:"pendingEmail,omitempty" xml:"pendingEmail,omitempty" bson:"pendingEmail,omitempty"`
+	PendingEmailCodeHash string                `json:"-" xml:"-" bson:"pendingEmailCodeHash,omitempty"`
+	PendingEmailExpiry   time.Time             `json:"-" xml:"-" bson:"pendingEmailExpiry,omitempty"`
+	CreatedDate          time.Time             `json:"createdDate" xml:"createdDate"  bson:"createdDate"`
+	LastModifiedDate     time.Time             `json:"lastModifiedDate" xml:"lastModifiedDate"  bson:"lastModifiedDate"`
+	ConfirmedDate        time.Time             `json:"confirmedDate" xml:"confirmedDate"  bson:"confirmedDate"`
+	Version              int                   `json:"-" xml:"-" bson:"version"`
+}
+
+// A WebAuthnCredential is a passkey or security key registered by the user.
+// PublicKey holds the COSE encoded credential public key as returned by the
+// authenticator.
+type WebAuthnCredential struct {
+	CredentialId      []byte    `json:"credentialId" xml:"credentialId" bson:"credentialId"`
+	PublicKey         []byte    `json:"publicKey" xml:"publicKey" bson:"publicKey"`
+	SignCount         uint32    `json:"signCount" xml:"signCount" bson:"signCount"`
+	AAGUID            []byte    `json:"aaguid" xml:"aaguid" bson:"aaguid"`
+	AttestationFormat string    `json:"attestationFormat" xml:"attestationFormat" bson:"attestationFormat"`
+	Name              string    `json:"name" xml:"name" bson:"name"`
+	CreatedDate       time.Time `json:"createdDate" xml:"createdDate" bson:"createdDate"`
+	LastUsedDate      time.Time `json:"lastUsedDate" xml:"lastUsedDate" bson:"lastUsedDate"`
+}
+
+type RefreshToken struct {
+	XMLName     xml.Name  `json:"-" xml:"refresh_token" bson:"-"`
+	Id          uuid.UUID `json:"id" xml:"id" bson:"id,omitempty"`
+	FamilyId    uuid.UUID `json:"familyId" xml:"familyId" bson:"familyId"`
+	UserId      uuid.UUID `json:"userId" xml:"userId" bson:"userId"`
+	TokenHash   string    `json:"tokenHash" xml:"tokenHash" bson:"tokenHash"`
+	IsUsed      bool      `json:"isUsed" xml:"isUsed" bson:"isUsed"`
+	IsRevoked   bool      `json:"isRevoked" xml:"isRevoked" bson:"isRevoked"`
+	Amr         []string  `json:"amr" xml:"amr" bson:"amr"`
+	CreatedDate time.Time `json:"createdDate" xml:"createdDate" bson:"createdDate"`
+	ExpiryDate  time.Time `json:"expiryDate" xml:"expiryDate" bson:"expiryDate"`
+}
+
+// A Client is an application registered to obtain tokens through the OAuth
+// endpoints. Authorization codes are only ever delivered to one of its
+// RedirectUris. Confidential clients also hold a secret, hashed the same way
+// as user passwords, and may use the client credentials grant for the Scopes
+// they are allowed.
+type Client struct {
+	XMLName      xml.Name  `json:"-" xml:"client" bson:"-"`
+	ClientId     string    `json:"clientId" xml:"clientId" bson:"clientId"`
+	Name         string    `json:"name" xml:"name" bson:"name"`
+	RedirectUris []string  `json:"redirectUris" xml:"redirectUris" bson:"redirectUris"`
+	SecretSalt   []byte    `json:"-" xml:"-" bson:"secretSalt,omitempty"`
+	SecretKey    []byte    `json:"-" xml:"-" bson:"secretKey,omitempty"`
+	Scopes       []string  `json:"scopes" xml:"scopes" bson:"scopes"`
+	CreatedDate  time.Time `json:"createdDate" xml:"createdDate" bson:"createdDate"`
+}
+
+type AuthorizationCode struct {
+	XMLName             xml.Name  `json:"-" xml:"authorization_code" bson:"-"`
+	CodeHash            string    `json:"codeHash" xml:"codeHash" bson:"codeHash"`
+	ClientId            string    `json:"clientId" xml:"clientId" bson:"clientId"`
+	UserId              uuid.UUID `json:"userId" xml:"userId" bson:"userId"`
+	RedirectUri         string    `json:"redirectUri" xml:"redirectUri" bson:"redirectUri"`
+	Scope               string    `json:"scope" xml:"scope" bson:"scope"`
+	Nonce               string    `json:"nonce" xml:"nonce" bson:"nonce"`
+	CodeChallenge       string    `json:"codeChallenge" xml:"codeChallenge" bson:"codeChallenge"`
+	CodeChallengeMethod string    `json:"codeChallengeMethod" xml:"codeChallengeMethod" bson:"codeChallengeMethod"`
+	AuthTime            time.Time `json:"authTime" xml:"authTime" bson:"authTime"`
+	Amr                 []string  `json:"amr" xml:"amr" bson:"amr"`
+	ExpiryDate          time.Time `json:"expiryDate" xml:"expiryDate" bson:"expiryDate"`
+}
+
+// A PasswordReset lets the holder of its token set a new password without
+// knowing the old one. Users have at most one outstanding reset.
+type PasswordReset struct {
+	XMLName     xml.Name  `json:"-" xml:"password_reset" bson:"-"`
+	UserId      uuid.UUID `json:"userId" xml:"userId" bson:"userId"`
+	TokenHash   string    `json:"tokenHash" xml:"tokenHash" bson:"tokenHash"`
+	CreatedDate time.Time `json:"createdDate" xml:"createdDate" bson:"createdDate"`
+	ExpiryDate  time.Time `json:"expiryDate" xml:"expiryDate" bson:"expiryDate"`
+}
+
+// A LoginLink is an outstanding passwordless login. The link token is a
+// signed JWT, only its id is stored, while the code is stored hashed.
+type LoginLink struct {
+	XMLName        xml.Name  `json:"-" xml:"login_link" bson:"-"`
+	UserId         uuid.UUID `json:"userId" xml:"userId" bson:"userId"`
+	TokenId        string    `json:"tokenId" xml:"tokenId" bson:"tokenId"`
+	CodeHash       string    `json:"codeHash" xml:"codeHash" bson:"codeHash"`
+	FailedAttempts int       `json:"failedAttempts" xml:"failedAttempts" bson:"failedAttempts"`
+	CreatedDate    time.Time `json:"createdDate" xml:"createdDate" bson:"createdDate"`
+	ExpiryDate     time.Time `json:"expiryDate" xml:"expiryDate" bson:"expiryDate"`
 }
 
 type AuthResponse struct {
-	XMLName xml.Name  `json:"-" xml:"auth_response" bson:"-"`
-	Id      uuid.UUID `json:"id" xml:"id" bson:"id"`
-	Email   string    `json:"email" xml:"email" bson:"email"`
-	Token   string    `json:"token" xml:"token" bson:"token"`
+	XMLName      xml.Name  `json:"-" xml:"auth_response" bson:"-"`
+	Id           uuid.UUID `json:"id" xml:"id" bson:"id"`
+	Email        string    `json:"email" xml:"email" bson:"email"`
+	Token        string    `json:"token" xml:"token" bson:"token"`
+	RefreshToken string    `json:"refreshToken,omitempty" xml:"refreshToken,omitempty" bson:"refreshToken,omitempty"`
+	IdToken      string    `json:"idToken,omitempty" xml:"idToken,omitempty" bson:"idToken,omitempty"`
+}
+
+// MFAChallengeResponse is returned in place of an AuthResponse when the user
+// must also present a second factor.
+type MFAChallengeResponse struct {
+	XMLName     xml.Name `json:"-" xml:"mfa_challenge"`
+	MfaRequired bool     `json:"mfaRequired" xml:"mfaRequired"`
+	MfaToken    string   `json:"mfaToken" xml:"mfaToken"`
+	Methods     []string `json:"methods" xml:"methods"`
+}
+
+// RecoveryCodesResponse carries newly generated recovery codes. They are only
+// ever shown once.
+type RecoveryCodesResponse struct {
+	XMLName       xml.Name `json:"-" xml:"recovery_codes"`
+	RecoveryCodes []string `json:"recoveryCodes" xml:"recoveryCodes"`
+}
+
+type TOTPEnrollmentResponse struct {
+	XMLName xml.Name `json:"-" xml:"totp_enrollment"`
+	Secret  string   `json:"secret" xml:"secret"`
+	Uri     string   `json:"uri" xml:"uri"`
 }
 
 type UserRegistrationView struct {
@@ -39,6 +162,8 @@ type LoginView struct {
 	XMLName  xml.Name `json:"-" xml:"login"`
 	Email    string   `json:"email" xml:"email"`
 	Password string   `json:"password" xml:"password"`
+	ClientId string   `json:"clientId" xml:"clientId"`
+	Nonce    string   `json:"nonce" xml:"nonce"`
 }
 
 type ChangePasswordView struct {
@@ -47,6 +172,213 @@ type ChangePasswordView struct {
 	NewPassword string   `json:"newPassword" xml:"newPassword"`
 }
 
+type PasswordResetRequestView struct {
+	XMLName xml.Name `json:"-" xml:"password_reset_request"`
+	Email   string   `json:"email" xml:"email"`
+}
+
+type PasswordResetView struct {
+	XMLName     xml.Name `json:"-" xml:"password_reset"`
+	Token       string   `json:"token" xml:"token"`
+	NewPassword string   `json:"newPassword" xml:"newPassword"`
+}
+
+type AccountUnlockView struct {
+	XMLName xml.Name `json:"-" xml:"account_unlock"`
+	Email   string   `json:"email" xml:"email"`
+}
+
+type LoginLinkRequestView struct {
+	XMLName xml.Name `json:"-" xml:"login_link_request"`
+	Email   string   `json:"email" xml:"email"`
+}
+
+type VerificationResendView struct {
+	XMLName xml.Name `json:"-" xml:"verification_resend"`
+	Email   string   `json:"email" xml:"email"`
+}
+
+type EmailChangeRequestView struct {
+	XMLName  xml.Name `json:"-" xml:"email_change_request"`
+	Email    string   `json:"email" xml:"email"`
+	Password string   `json:"password" xml:"password"`
+}
+
+type EmailChangeConfirmationView struct {
+	XMLName xml.Name `json:"-" xml:"email_change_confirmation"`
+	Code    string   `json:"code" xml:"code"`
+}
+
+type LoginLinkRedemptionView struct {
+	XMLName xml.Name `json:"-" xml:"login_link_redemption"`
+	Token   string   `json:"token" xml:"token"`
+	Email   string   `json:"email" xml:"email"`
+	Code    string   `json:"code" xml:"code"`
+}
+
+type MFAView struct {
+	XMLName  xml.Name `json:"-" xml:"mfa"`
+	MfaToken string   `json:"mfaToken" xml:"mfaToken"`
+	Code     string   `json:"code" xml:"code"`
+}
+
+type TOTPConfirmationView struct {
+	XMLName xml.Name `json:"-" xml:"totp_confirmation"`
+	Code    string   `json:"code" xml:"code"`
+}
+
+// WebAuthn options and responses use the JSON serialization of
+// PublicKeyCredential, with binary values base64url encoded.
+
+type WebAuthnRelyingParty struct {
+	Id   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type WebAuthnUser struct {
+	Id          string `json:"id"`
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+}
+
+type WebAuthnCredentialParameter struct {
+	Type string `json:"type"`
+	Alg  int64  `json:"alg"`
+}
+
+type WebAuthnCredentialDescriptor struct {
+	Type string `json:"type"`
+	Id   string `json:"id"`
+}
+
+type WebAuthnAuthenticatorSelection struct {
+	ResidentKey      string `json:"residentKey"`
+	UserVerification string `json:"userVerification"`
+}
+
+type WebAuthnCreationOptions struct {
+	Challenge              string                         `json:"challenge"`
+	RelyingParty           WebAuthnRelyingParty           `json:"rp"`
+	User                   WebAuthnUser                   `json:"user"`
+	PubKeyCredParams       []WebAuthnCredentialParameter  `json:"pubKeyCredParams"`
+	Timeout                int64                          `json:"timeout"`
+	Attestation            string                         `json:"attestation"`
+	ExcludeCredentials     []WebAuthnCredentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection WebAuthnAuthenticatorSelection `json:"authenticatorSelection"`
+}
+
+type WebAuthnRequestOptions struct {
+	Challenge        string                         `json:"challenge"`
+	RelyingPartyId   string                         `json:"rpId"`
+	Timeout          int64                          `json:"timeout"`
+	AllowCredentials []WebAuthnCredentialDescriptor `json:"allowCredentials"`
+	UserVerification string                         `json:"userVerification"`
+}
+
+// WebAuthnCreationResponse and WebAuthnRequestResponse carry a session token
+// which must be sent back with the authenticator's response.
+type WebAuthnCreationResponse struct {
+	SessionToken string                   `json:"sessionToken"`
+	PublicKey    *WebAuthnCreationOptions `json:"publicKey"`
+}
+
+type WebAuthnRequestResponse struct {
+	SessionToken string                  `json:"sessionToken"`
+	PublicKey    *WebAuthnRequestOptions `json:"publicKey"`
+}
+
+type WebAuthnAuthenticatorResponse struct {
+	ClientDataJSON    string `json:"clientDataJSON"`
+	AttestationObject string `json:"attestationObject,omitempty"`
+	AuthenticatorData string `json:"authenticatorData,omitempty"`
+	Signature         string `json:"signature,omitempty"`
+	UserHandle        string `json:"userHandle,omitempty"`
+}
+
+type WebAuthnPublicKeyCredential struct {
+	Id       string                        `json:"id"`
+	RawId    string                        `json:"rawId"`
+	Type     string                        `json:"type"`
+	Response WebAuthnAuthenticatorResponse `json:"response"`
+}
+
+type WebAuthnRegistrationView struct {
+	SessionToken string                      `json:"sessionToken"`
+	Name         string                      `json:"name"`
+	Credential   WebAuthnPublicKeyCredential `json:"credential"`
+}
+
+type WebAuthnLoginRequestView struct {
+	Email string `json:"email"`
+}
+
+type WebAuthnLoginView struct {
+	SessionToken string                      `json:"sessionToken"`
+	Credential   WebAuthnPublicKeyCredential `json:"credential"`
+}
+
+type RefreshTokenView struct {
+	XMLName      xml.Name `json:"-" xml:"refresh_token_request"`
+	RefreshToken string   `json:"refreshToken" xml:"refreshToken"`
+}
+
+type RevokeTokenView struct {
+	XMLName xml.Name `json:"-" xml:"revoke_token_request"`
+	Token   string   `json:"token" xml:"token"`
+}
+
+type JSONWebKeySet struct {
+	Keys []*JSONWebKey `json:"keys"`
+}
+
+type JSONWebKey struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+type OpenIDConfiguration struct {
+	Issuer                           string   `json:"issuer"`
+	AuthorizationEndpoint            string   `json:"authorization_endpoint"`
+	TokenEndpoint                    string   `json:"token_endpoint"`
+	JwksUri                          string   `json:"jwks_uri"`
+	UserInfoEndpoint                 string   `json:"userinfo_endpoint"`
+	IntrospectionEndpoint            string   `json:"introspection_endpoint"`
+	ResponseTypesSupported           []string `json:"response_types_supported"`
+	GrantTypesSupported              []string `json:"grant_types_supported"`
+	CodeChallengeMethodsSupported    []string `json:"code_challenge_methods_supported"`
+	TokenEndpointAuthMethods         []string `json:"token_endpoint_auth_methods_supported"`
+	SubjectTypesSupported            []string `json:"subject_types_supported"`
+	IdTokenSigningAlgValuesSupported []string `json:"id_token_signing_alg_values_supported"`
+	ScopesSupported                  []string `json:"scopes_supported"`
+	ClaimsSupported                  []string `json:"claims_supported"`
+}
+
+type UserInfoResponse struct {
+	Sub           string `json:"sub"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+}
+
+// TokenResponse is the RFC 6749 access token response returned by /token.
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	IdToken      string `json:"id_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+}
+
+// OAuthErrorResponse is the RFC 6749 error response returned by /token.
+type OAuthErrorResponse struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
+
 type ErrorResponse struct {
 	XMLName xml.Name `json:"-" xml:"error_response" bson:"-"`
 	Errors  []*Error `json:"errors" xml:"errors" bson:"errors"`
@@ -0,0 +1,586 @@
+// Copyright (c) Luke Atherton 2015
+
+package authenticator
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	. "github.com/lukeatherton/domain-events"
+	"github.com/satori/go.uuid"
+)
+
+var (
+	AuthorizationCodeLifetime = time.Minute * 10
+	AuthorizationCodeLength   = 32
+	ClientTokenLifetime       = time.Hour
+)
+
+// AuthorizationRequest holds the parameters of an OAuth 2.0 authorization
+// request, see RFC 6749 section 4.1.1 and RFC 7636 section 4.3.
+type AuthorizationRequest struct {
+	ResponseType        string
+	ClientId            string
+	RedirectUri         string
+	Scope               string
+	State               string
+	Nonce               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+}
+
+func parseAuthorizationRequest(values url.Values) *AuthorizationRequest {
+	return &AuthorizationRequest{
+		ResponseType:        values.Get("response_type"),
+		ClientId:            values.Get("client_id"),
+		RedirectUri:         values.Get("redirect_uri"),
+		Scope:               values.Get("scope"),
+		State:               values.Get("state"),
+		Nonce:               values.Get("nonce"),
+		CodeChallenge:       values.Get("code_challenge"),
+		CodeChallengeMethod: values.Get("code_challenge_method"),
+	}
+}
+
+// validate checks the request against the registered client. Errors with an
+// unknown client or redirect uri must not be redirected, so isRedirectable
+// reports whether the error can safely be sent back to RedirectUri.
+func (request *AuthorizationRequest) validate(ctx context.Context, repo Repo) (isRedirectable bool, err *OAuthError) {
+	if request.ClientId == "" {
+		return false, NewOAuthError(OAuthErrInvalidRequest, "client_id is required")
+	}
+
+	client, clientErr := repo.GetClient(ctx, request.ClientId)
+	if clientErr != nil || client.ClientId == "" {
+		return false, NewOAuthError(OAuthErrInvalidClient, "unknown client")
+	}
+
+	if !client.HasRedirectUri(request.RedirectUri) {
+		return false, NewOAuthError(OAuthErrInvalidRequest, "redirect_uri is not registered for this client")
+	}
+
+	if request.ResponseType != "code" {
+		return true, NewOAuthError(OAuthErrUnsupportedResponseType, "only the code response type is supported")
+	}
+
+	if request.CodeChallenge == "" {
+		return true, NewOAuthError(OAuthErrInvalidRequest, "code_challenge is required")
+	}
+
+	if request.CodeChallengeMethod != "S256" {
+		return true, NewOAuthError(OAuthErrInvalidRequest, "code_challenge_method must be S256")
+	}
+
+	return true, nil
+}
+
+func (request *AuthorizationRequest) redirect(c *gin.Context, params url.Values) {
+	redirectUri, _ := url.Parse(request.RedirectUri)
+
+	query := redirectUri.Query()
+	for key := range params {
+		query.Set(key, params.Get(key))
+	}
+
+	if request.State != "" {
+		query.Set("state", request.State)
+	}
+
+	redirectUri.RawQuery = query.Encode()
+
+	c.Redirect(http.StatusFound, redirectUri.String())
+}
+
+func (request *AuthorizationRequest) redirectError(c *gin.Context, err *OAuthError) {
+	request.redirect(c, url.Values{
+		"error":             {err.Code},
+		"error_description": {err.Description},
+	})
+}
+
+// HasRedirectUri reports whether redirectUri exactly matches one of the
+// client's registered redirect uris.
+func (client *Client) HasRedirectUri(redirectUri string) bool {
+	if redirectUri == "" {
+		return false
+	}
+
+	for _, registered := range client.RedirectUris {
+		if registered == redirectUri {
+			return true
+		}
+	}
+
+	return false
+}
+
+// SetSecret hashes the secret with DeriveKey and makes the client
+// confidential.
+func (client *Client) SetSecret(secret string) {
+	secretKey := DeriveKey(secret)
+
+	client.SecretSalt = secretKey.Salt
+	client.SecretKey = secretKey.Key
+}
+
+func (client *Client) IsConfidential() bool {
+	return len(client.SecretKey) > 0
+}
+
+// AuthenticateClient checks the secret of a confidential client.
+func (auth *TokenAuthenticator) AuthenticateClient(ctx context.Context, clientId string, clientSecret string) (*Client, error) {
+	client, err := auth.repo.GetClient(ctx, clientId)
+	if err != nil || client.ClientId == "" || !client.IsConfidential() {
+		return nil, NewOAuthError(OAuthErrInvalidClient, "client authentication failed")
+	}
+
+	if !MatchPassword(clientSecret, &PasswordKey{client.SecretSalt, client.SecretKey}) {
+		return nil, NewOAuthError(OAuthErrInvalidClient, "client authentication failed")
+	}
+
+	return client, nil
+}
+
+// IssueClientToken mints an access token for a service acting on its own
+// behalf. The token identifies the client and its granted scopes instead of
+// a user.
+func (auth *TokenAuthenticator) IssueClientToken(client *Client, scope string) (*TokenResponse, error) {
+	grantedScope, err := grantScope(client.Scopes, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+
+	token, err := auth.signToken(map[string]interface{}{
+		"jti":       uuid.NewV4().String(),
+		"iss":       auth.issuer,
+		"sub":       client.ClientId,
+		"client_id": client.ClientId,
+		"scope":     grantedScope,
+		"iat":       now.Unix(),
+		"exp":       now.Add(ClientTokenLifetime).Unix(),
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenResponse{
+		AccessToken: token,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(ClientTokenLifetime / time.Second),
+		Scope:       grantedScope,
+	}, nil
+}
+
+// grantScope checks the requested scopes against those the client is
+// allowed. An empty request is granted every allowed scope.
+func grantScope(allowed []string, requested string) (string, error) {
+	if strings.TrimSpace(requested) == "" {
+		return strings.Join(allowed, " "), nil
+	}
+
+	for _, scope := range strings.Fields(requested) {
+		if !hasScope(strings.Join(allowed, " "), scope) {
+			return "", NewOAuthError(OAuthErrInvalidScope, fmt.Sprintf("scope %s is not allowed for this client", scope))
+		}
+	}
+
+	return strings.Join(strings.Fields(requested), " "), nil
+}
+
+// IssueAuthorizationCode stores a single-use authorization code for the
+// request and returns the code to hand to the client.
+func (auth *TokenAuthenticator) IssueAuthorizationCode(ctx context.Context, userId uuid.UUID, request *AuthorizationRequest, authTime time.Time, amr []string) (string, error) {
+	code, err := generateOpaqueToken(AuthorizationCodeLength)
+	if err != nil {
+		fmt.Printf("ERROR: %v\n", err.Error())
+		return "", err
+	}
+
+	err = auth.repo.SaveAuthorizationCode(ctx, &AuthorizationCode{
+		CodeHash:            hashOpaqueToken(code),
+		ClientId:            request.ClientId,
+		UserId:              userId,
+		RedirectUri:         request.RedirectUri,
+		Scope:               request.Scope,
+		Nonce:               request.Nonce,
+		CodeChallenge:       request.CodeChallenge,
+		CodeChallengeMethod: request.CodeChallengeMethod,
+		AuthTime:            authTime,
+		Amr:                 amr,
+		ExpiryDate:          time.Now().Add(AuthorizationCodeLifetime),
+	})
+
+	if err != nil {
+		fmt.Printf("ERROR: %v\n", err.Error())
+		return "", err
+	}
+
+	return code, nil
+}
+
+// ExchangeAuthorizationCode redeems an authorization code for the same
+// tokens Authenticate issues, plus an ID token when the openid scope was
+// requested.
+func (auth *TokenAuthenticator) ExchangeAuthorizationCode(ctx context.Context, code string, clientId string, clientSecret string, redirectUri string, codeVerifier string) (*TokenResponse, error) {
+	client, err := auth.repo.GetClient(ctx, clientId)
+	if err != nil || client.ClientId == "" {
+		return nil, NewOAuthError(OAuthErrInvalidClient, "unknown client")
+	}
+
+	if client.IsConfidential() {
+		if _, err := auth.AuthenticateClient(ctx, clientId, clientSecret); err != nil {
+			return nil, err
+		}
+	}
+
+	authorizationCode, err := auth.repo.ConsumeAuthorizationCode(ctx, hashOpaqueToken(code))
+	if err != nil || authorizationCode.CodeHash == "" {
+		return nil, NewOAuthError(OAuthErrInvalidGrant, "authorization code is invalid")
+	}
+
+	if time.Now().After(authorizationCode.ExpiryDate) {
+		return nil, NewOAuthError(OAuthErrInvalidGrant, "authorization code has expired")
+	}
+
+	if authorizationCode.ClientId != clientId || authorizationCode.RedirectUri != redirectUri {
+		return nil, NewOAuthError(OAuthErrInvalidGrant, "authorization code was issued to another client")
+	}
+
+	if !verifyCodeChallenge(codeVerifier, authorizationCode.CodeChallenge) {
+		return nil, NewOAuthError(OAuthErrInvalidGrant, "code_verifier does not match code_challenge")
+	}
+
+	credentials, err := auth.repo.GetCredentials(ctx, authorizationCode.UserId)
+	if err != nil || credentials.Id == uuid.Nil {
+		return nil, NewOAuthError(OAuthErrInvalidGrant, "user no longer exists")
+	}
+
+	token, err := auth.issueToken(credentials, authorizationCode.Amr)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, err := auth.IssueRefreshToken(ctx, credentials.Id, authorizationCode.Amr)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &TokenResponse{
+		AccessToken:  token,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(AccessTokenLifetime / time.Second),
+		RefreshToken: refreshToken,
+		Scope:        authorizationCode.Scope,
+	}
+
+	if hasScope(authorizationCode.Scope, "openid") {
+		response.IdToken, err = auth.IssueIdToken(ctx, credentials.Id, clientId, authorizationCode.Nonce, authorizationCode.AuthTime)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return response, nil
+}
+
+// verifyCodeChallenge checks a PKCE code verifier against an S256 code
+// challenge, see RFC 7636 section 4.6.
+func verifyCodeChallenge(codeVerifier string, codeChallenge string) bool {
+	if len(codeVerifier) < 43 || len(codeVerifier) > 128 {
+		return false
+	}
+
+	sum := sha256.Sum256([]byte(codeVerifier))
+	computed := base64.RawURLEncoding.EncodeToString(sum[:])
+
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(codeChallenge)) == 1
+}
+
+func hasScope(scope string, wanted string) bool {
+	for _, s := range strings.Fields(scope) {
+		if s == wanted {
+			return true
+		}
+	}
+
+	return false
+}
+
+//=====================================================================================
+
+var loginTemplate = template.Must(template.New("login").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Sign in</title></head>
+<body>
+<form method="POST" action="authorize">
+{{if .Error}}<p>{{.Error}}</p>{{end}}
+<input type="hidden" name="response_type" value="{{.Request.ResponseType}}">
+<input type="hidden" name="client_id" value="{{.Request.ClientId}}">
+<input type="hidden" name="redirect_uri" value="{{.Request.RedirectUri}}">
+<input type="hidden" name="scope" value="{{.Request.Scope}}">
+<input type="hidden" name="state" value="{{.Request.State}}">
+<input type="hidden" name="nonce" value="{{.Request.Nonce}}">
+<input type="hidden" name="code_challenge" value="{{.Request.CodeChallenge}}">
+<input type="hidden" name="code_challenge_method" value="{{.Request.CodeChallengeMethod}}">
+{{if .MfaToken}}<input type="hidden" name="mfa_token" value="{{.MfaToken}}">
+<label>Authentication code <input type="text" name="code" inputmode="numeric" autocomplete="one-time-code" autofocus></label>
+<button type="submit">Verify</button>
+{{else}}<label>Email <input type="email" name="email" value="{{.Email}}" autofocus></label>
+<label>Password <input type="password" name="password"></label>
+<button type="submit">Sign in</button>
+{{end}}
+</form>
+</body>
+</html>
+`))
+
+// renderLogin shows the login form, or the second factor form when mfaToken
+// holds a challenge from the first step.
+func renderLogin(c *gin.Context, code int, request *AuthorizationRequest, email string, mfaToken string, message string) {
+	var buf bytes.Buffer
+	loginTemplate.Execute(&buf, map[string]interface{}{
+		"Request":  request,
+		"Email":    email,
+		"MfaToken": mfaToken,
+		"Error":    message,
+	})
+
+	// The login page must never be framed by another site.
+	c.Writer.Header().Set("X-Frame-Options", "DENY")
+	c.Writer.Header().Set("Cache-Control", "no-store")
+	c.Data(code, "text/html; charset=utf-8", buf.Bytes())
+}
+
+// Starts the authorization code flow by showing the login page
+func Authorize(c *gin.Context) {
+	repo := c.MustGet("repo").(Repo)
+
+	request := parseAuthorizationRequest(c.Request.URL.Query())
+
+	isRedirectable, err := request.validate(c.Request.Context(), repo)
+	if err != nil {
+		if isRedirectable {
+			request.redirectError(c, err)
+			return
+		}
+
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	renderLogin(c, http.StatusOK, request, "", "", "")
+	return
+}
+
+// Authenticates the user from the login page and redirects back to the
+// client with an authorization code
+func AuthorizeLogin(c *gin.Context) {
+	auth := c.MustGet("auth").(Authenticator)
+	repo := c.MustGet("repo").(Repo)
+
+	c.Request.ParseForm()
+	request := parseAuthorizationRequest(c.Request.PostForm)
+
+	isRedirectable, err := request.validate(c.Request.Context(), repo)
+	if err != nil {
+		if isRedirectable {
+			request.redirectError(c, err)
+			return
+		}
+
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var token string
+	var usedRecoveryCode bool
+	var auth_err error
+
+	if mfaToken := c.Request.PostForm.Get("mfa_token"); mfaToken != "" {
+		token, usedRecoveryCode, auth_err = auth.CompleteMFA(c.Request.Context(), mfaToken, c.Request.PostForm.Get("code"))
+		if auth_err == ErrAccountLocked {
+			id, _ := auth.GetTokenClaim(mfaToken, "id")
+			userId, _ := uuid.FromString(fmt.Sprint(id))
+			publishUserLocked(c, userId)
+		}
+
+		if auth_err != nil {
+			renderLogin(c, http.StatusUnauthorized, request, "", mfaToken, "Invalid authentication code.")
+			return
+		}
+	} else {
+		throttle := c.MustGet("loginThrottle").(*LoginThrottle)
+		ip := clientIP(c)
+
+		email := strings.ToLower(c.Request.PostForm.Get("email"))
+		password := c.Request.PostForm.Get("password")
+
+		if throttle.IsThrottled(ip) {
+			renderLogin(c, http.StatusUnauthorized, request, email, "", "Invalid email or password.")
+			return
+		}
+
+		token, auth_err = auth.Authenticate(c.Request.Context(), email, password, "")
+		if auth_err == ErrMFARequired {
+			renderLogin(c, http.StatusOK, request, "", token, "")
+			return
+		}
+
+		if auth_err == ErrAccountLocked {
+			publishAccountLocked(c, email)
+		}
+
+		if auth_err != nil {
+			throttle.AddFailure(ip)
+			renderLogin(c, http.StatusUnauthorized, request, email, "", "Invalid email or password.")
+			return
+		}
+	}
+
+	id, _ := auth.GetTokenClaim(token, "id")
+	userId, _ := uuid.FromString(id.(string))
+
+	if usedRecoveryCode {
+		publisher := c.MustGet("publisher").(Publisher)
+		email, _ := auth.GetTokenClaim(token, "email")
+
+		go publisher.PublishMessage(NewRecoveryCodeUsedEvent(userId, email.(string), uuid.Nil))
+	}
+
+	code, code_err := auth.IssueAuthorizationCode(c.Request.Context(), userId, request, time.Now(), tokenAmr(auth, token))
+	if code_err != nil {
+		request.redirectError(c, NewOAuthError(OAuthErrServerError, "unable to issue authorization code"))
+		return
+	}
+
+	request.redirect(c, url.Values{"code": {code}})
+	return
+}
+
+// Issues tokens for an OAuth 2.0 grant
+func Token(c *gin.Context) {
+	auth := c.MustGet("auth").(Authenticator)
+
+	c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
+	c.Writer.Header().Set("Cache-Control", "no-store")
+	c.Writer.Header().Set("Pragma", "no-cache")
+
+	c.Request.ParseForm()
+	form := c.Request.PostForm
+
+	clientId, clientSecret := clientCredentials(c)
+
+	var response *TokenResponse
+	var err error
+
+	switch form.Get("grant_type") {
+	case "authorization_code":
+		response, err = auth.ExchangeAuthorizationCode(c.Request.Context(), form.Get("code"), clientId, clientSecret, form.Get("redirect_uri"), form.Get("code_verifier"))
+	case "client_credentials":
+		var client *Client
+		client, err = auth.AuthenticateClient(c.Request.Context(), clientId, clientSecret)
+		if err == nil {
+			response, err = auth.IssueClientToken(client, form.Get("scope"))
+		}
+	default:
+		err = NewOAuthError(OAuthErrUnsupportedGrantType, "grant_type is not supported")
+	}
+
+	if err != nil {
+		sendOAuthError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+	return
+}
+
+// Reports whether a token is active along with its claims, see RFC 7662.
+// Only confidential clients may introspect tokens.
+func IntrospectToken(c *gin.Context) {
+	auth := c.MustGet("auth").(Authenticator)
+
+	c.Writer.Header().Set("Cache-Control", "no-store")
+
+	c.Request.ParseForm()
+
+	clientId, clientSecret := clientCredentials(c)
+	if _, err := auth.AuthenticateClient(c.Request.Context(), clientId, clientSecret); err != nil {
+		sendOAuthError(c, err)
+		return
+	}
+
+	token := c.Request.PostForm.Get("token")
+	if token == "" {
+		sendOAuthError(c, NewOAuthError(OAuthErrInvalidRequest, "token is required"))
+		return
+	}
+
+	if !auth.ValidateToken(c.Request.Context(), token) {
+		c.JSON(http.StatusOK, gin.H{"active": false})
+		return
+	}
+
+	claims, err := auth.GetTokenClaims(token)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"active": false})
+		return
+	}
+
+	response := gin.H{}
+	for claim, value := range claims {
+		response[claim] = value
+	}
+
+	response["active"] = true
+	response["token_type"] = "Bearer"
+
+	if email, ok := claims["email"]; ok {
+		response["username"] = email
+	}
+
+	c.JSON(http.StatusOK, response)
+	return
+}
+
+// clientCredentials reads the client id and secret from HTTP Basic
+// authentication, falling back to the request body.
+func clientCredentials(c *gin.Context) (clientId string, clientSecret string) {
+	if username, password, ok := c.Request.BasicAuth(); ok {
+		clientId, _ = url.QueryUnescape(username)
+		clientSecret, _ = url.QueryUnescape(password)
+		return clientId, clientSecret
+	}
+
+	return c.Request.PostForm.Get("client_id"), c.Request.PostForm.Get("client_secret")
+}
+
+func sendOAuthError(c *gin.Context, err error) {
+	oauthErr, ok := err.(*OAuthError)
+	if !ok {
+		fmt.Printf("ERROR: %v\n", err.Error())
+		c.JSON(http.StatusInternalServerError, OAuthErrorResponse{Error: OAuthErrServerError})
+		return
+	}
+
+	code := http.StatusBadRequest
+	if oauthErr.Code == OAuthErrInvalidClient {
+		code = http.StatusUnauthorized
+		c.Writer.Header().Set("WWW-Authenticate", "Basic realm=\"client\"")
+	}
+
+	c.JSON(code, OAuthErrorResponse{Error: oauthErr.Code, ErrorDescription: oauthErr.Description})
+}
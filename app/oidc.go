@@ -0,0 +1,104 @@
+// Copyright (c) Luke Atherton 2015
+
+package authenticator
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/satori/go.uuid"
+)
+
+var (
+	IdTokenLifetime = time.Hour
+)
+
+func (auth *TokenAuthenticator) GetIssuer() string {
+	return auth.issuer
+}
+
+// IssueIdToken mints an OpenID Connect ID token for the user, addressed to
+// the client identified by audience.
+func (auth *TokenAuthenticator) IssueIdToken(ctx context.Context, userId uuid.UUID, audience string, nonce string, authTime time.Time) (string, error) {
+	credentials, err := auth.repo.GetCredentials(ctx, userId)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+
+	claims := map[string]interface{}{
+		"iss":            auth.issuer,
+		"sub":            userId.String(),
+		"aud":            audience,
+		"email":          credentials.Email,
+		"email_verified": credentials.IsEmailVerified,
+		"auth_time":      authTime.Unix(),
+		"iat":            now.Unix(),
+		"exp":            now.Add(IdTokenLifetime).Unix(),
+		"token_use":      "id",
+	}
+
+	if nonce != "" {
+		claims["nonce"] = nonce
+	}
+
+	return auth.signToken(claims)
+}
+
+// Serves the OpenID Connect discovery document
+func GetOpenIDConfiguration(c *gin.Context) {
+	auth := c.MustGet("auth").(Authenticator)
+	issuer := auth.GetIssuer()
+
+	c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
+	c.Writer.Header().Set("Cache-Control", "public, max-age=3600")
+
+	configuration := OpenIDConfiguration{
+		Issuer:                           issuer,
+		AuthorizationEndpoint:            issuer + "/authorize",
+		TokenEndpoint:                    issuer + "/token",
+		JwksUri:                          issuer + "/.well-known/jwks.json",
+		UserInfoEndpoint:                 issuer + "/userinfo",
+		IntrospectionEndpoint:            issuer + "/api/tokens/introspect",
+		ResponseTypesSupported:           []string{"code"},
+		GrantTypesSupported:              []string{"authorization_code", "client_credentials"},
+		CodeChallengeMethodsSupported:    []string{"S256"},
+		TokenEndpointAuthMethods:         []string{"client_secret_basic", "client_secret_post", "none"},
+		SubjectTypesSupported:            []string{"public"},
+		IdTokenSigningAlgValuesSupported: []string{"RS256"},
+		ScopesSupported:                  []string{"openid", "email"},
+		ClaimsSupported:                  []string{"iss", "sub", "aud", "exp", "iat", "auth_time", "nonce", "email", "email_verified"},
+	}
+
+	c.JSON(http.StatusOK, configuration)
+	return
+}
+
+// Returns the claims about the user identified by the bearer token
+func GetUserInfo(c *gin.Context) {
+	repo := c.MustGet("repo").(Repo)
+	id := GetIdParam(c.MustGet("userId").(string), c)
+
+	if id == uuid.Nil {
+		return
+	}
+
+	credentials, err := repo.GetCredentials(c.Request.Context(), id)
+	if err != nil {
+		c.Writer.Header().Set("WWW-Authenticate", "Bearer error=\"invalid_token\"")
+		c.JSON(http.StatusUnauthorized, http.StatusText(401))
+		return
+	}
+
+	response := UserInfoResponse{
+		Sub:           credentials.Id.String(),
+		Email:         credentials.Email,
+		EmailVerified: credentials.IsEmailVerified,
+	}
+
+	c.JSON(http.StatusOK, response)
+	return
+}
@@ -0,0 +1,309 @@
+// Copyright (c) Luke Atherton 2015
+
+package authenticator
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/scrypt"
+)
+
+// A PasswordHasher hashes passwords into self-describing strings in the PHC
+// string format, e.g. $argon2id$v=19$m=65536,t=3,p=2$<salt>$<hash>, so the
+// algorithm and parameters used are stored alongside every hash.
+type PasswordHasher interface {
+	// Id is the algorithm identifier used in encoded hashes.
+	Id() string
+	Hash(password string) (encoded string, err error)
+	Verify(password string, encoded string) (matched bool, err error)
+	// NeedsRehash reports whether an encoded hash produced by this hasher
+	// used weaker parameters than the hasher is configured with.
+	NeedsRehash(encoded string) bool
+}
+
+var (
+	ErrUnknownPasswordHasher = errors.New("unknown password hash algorithm")
+	ErrInvalidPasswordHash   = errors.New("invalid password hash")
+)
+
+var PasswordHashers = map[string]PasswordHasher{}
+
+// DefaultPasswordHasher is used for every new hash. Hashes made by any other
+// hasher, or with weaker parameters, are replaced on the user's next login.
+var DefaultPasswordHasher PasswordHasher
+
+func init() {
+	RegisterPasswordHasher(&PBKDF2Hasher{Iterations: IterationCount, SaltLength: SaltLength, KeyLength: KeySize})
+	RegisterPasswordHasher(&BcryptHasher{Cost: 12})
+	RegisterPasswordHasher(&ScryptHasher{LogN: 15, R: 8, P: 1, SaltLength: 16, KeyLength: 32})
+	RegisterPasswordHasher(&Argon2idHasher{Time: 3, Memory: 64 * 1024, Threads: 2, SaltLength: 16, KeyLength: 32})
+
+	DefaultPasswordHasher = PasswordHashers["argon2id"]
+}
+
+func RegisterPasswordHasher(hasher PasswordHasher) {
+	PasswordHashers[hasher.Id()] = hasher
+}
+
+// SetDefaultPasswordHasher selects the hasher used for new hashes by its id.
+func SetDefaultPasswordHasher(id string) error {
+	hasher, ok := PasswordHashers[id]
+	if !ok {
+		return ErrUnknownPasswordHasher
+	}
+
+	DefaultPasswordHasher = hasher
+	return nil
+}
+
+// HashPassword hashes the password with the default hasher.
+func HashPassword(password string) (string, error) {
+	return DefaultPasswordHasher.Hash(password)
+}
+
+// VerifyPassword checks the password against an encoded hash made by any
+// registered hasher. needsRehash is set when the hash should be replaced with
+// one from the default hasher.
+func VerifyPassword(password string, encoded string) (matched bool, needsRehash bool, err error) {
+	hasher, ok := PasswordHashers[hashAlgorithm(encoded)]
+	if !ok {
+		return false, false, ErrUnknownPasswordHasher
+	}
+
+	matched, err = hasher.Verify(password, encoded)
+	if err != nil || !matched {
+		return false, false, err
+	}
+
+	needsRehash = hasher.Id() != DefaultPasswordHasher.Id() || hasher.NeedsRehash(encoded)
+
+	return true, needsRehash, nil
+}
+
+// SetPassword replaces the user's password hash, clearing any hash stored in
+// the legacy Salt and Key fields.
+func (credentials *Credentials) SetPassword(password string) error {
+	encoded, err := HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	credentials.PasswordHash = encoded
+	credentials.Salt = nil
+	credentials.Key = nil
+
+	return nil
+}
+
+// CheckPassword checks the password against the user's hash. Credentials
+// saved before PasswordHash existed are checked with MatchPassword and always
+// need rehashing.
+func (credentials *Credentials) CheckPassword(password string) (matched bool, needsRehash bool) {
+	if credentials.PasswordHash == "" {
+		if len(credentials.Key) == 0 {
+			return false, false
+		}
+
+		return MatchPassword(password, &PasswordKey{credentials.Salt, credentials.Key}), true
+	}
+
+	matched, needsRehash, err := VerifyPassword(password, credentials.PasswordHash)
+	if err != nil {
+		fmt.Printf("ERROR: %v\n", err.Error())
+		return false, false
+	}
+
+	return matched, needsRehash
+}
+
+// hashAlgorithm returns the identifier between the first two '$' of an
+// encoded hash.
+func hashAlgorithm(encoded string) string {
+	fields := strings.Split(encoded, "$")
+	if len(fields) < 3 || fields[0] != "" {
+		return ""
+	}
+
+	return fields[1]
+}
+
+// parsePHC splits a PHC string into its parameters, salt and hash.
+func parsePHC(encoded string, id string) (params map[string]int, salt []byte, hash []byte, err error) {
+	fields := strings.Split(encoded, "$")
+	if len(fields) < 5 || fields[1] != id {
+		return nil, nil, nil, ErrInvalidPasswordHash
+	}
+
+	// The optional version field, e.g. v=19, precedes the parameters.
+	paramField := fields[len(fields)-3]
+	if len(fields) == 6 {
+		paramField = fields[2] + "," + fields[3]
+	}
+
+	params = map[string]int{}
+	for _, param := range strings.Split(paramField, ",") {
+		var name string
+		var value int
+		if _, err := fmt.Sscanf(strings.Replace(param, "=", " ", 1), "%s %d", &name, &value); err != nil {
+			return nil, nil, nil, ErrInvalidPasswordHash
+		}
+		params[name] = value
+	}
+
+	if salt, err = decodePHC(fields[len(fields)-2]); err != nil {
+		return nil, nil, nil, ErrInvalidPasswordHash
+	}
+
+	if hash, err = decodePHC(fields[len(fields)-1]); err != nil {
+		return nil, nil, nil, ErrInvalidPasswordHash
+	}
+
+	return params, salt, hash, nil
+}
+
+func encodePHC(value []byte) string {
+	return base64.RawStdEncoding.EncodeToString(value)
+}
+
+func decodePHC(value string) ([]byte, error) {
+	return base64.RawStdEncoding.DecodeString(value)
+}
+
+//=====================================================================================
+
+// Argon2idHasher is the recommended hasher, see RFC 9106.
+type Argon2idHasher struct {
+	Time       uint32
+	Memory     uint32
+	Threads    uint8
+	SaltLength int
+	KeyLength  uint32
+}
+
+func (hasher *Argon2idHasher) Id() string {
+	return "argon2id"
+}
+
+func (hasher *Argon2idHasher) Hash(password string) (string, error) {
+	salt, err := generateSalt(hasher.SaltLength)
+	if err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, hasher.Time, hasher.Memory, hasher.Threads, hasher.KeyLength)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, hasher.Memory, hasher.Time, hasher.Threads, encodePHC(salt), encodePHC(key)), nil
+}
+
+func (hasher *Argon2idHasher) Verify(password string, encoded string) (bool, error) {
+	params, salt, key, err := parsePHC(encoded, hasher.Id())
+	if err != nil {
+		return false, err
+	}
+
+	if params["v"] != argon2.Version {
+		return false, ErrInvalidPasswordHash
+	}
+
+	candidate := argon2.IDKey([]byte(password), salt, uint32(params["t"]), uint32(params["m"]), uint8(params["p"]), uint32(len(key)))
+
+	return subtle.ConstantTimeCompare(candidate, key) == 1, nil
+}
+
+func (hasher *Argon2idHasher) NeedsRehash(encoded string) bool {
+	params, _, key, err := parsePHC(encoded, hasher.Id())
+	if err != nil {
+		return true
+	}
+
+	return uint32(params["t"]) < hasher.Time || uint32(params["m"]) < hasher.Memory || uint8(params["p"]) < hasher.Threads || uint32(len(key)) < hasher.KeyLength
+}
+
+//=====================================================================================
+
+// BcryptHasher stores hashes in bcrypt's own modular crypt format, which is
+// already PHC compatible.
+type BcryptHasher struct {
+	Cost int
+}
+
+func (hasher *BcryptHasher) Id() string {
+	return "2a"
+}
+
+func (hasher *BcryptHasher) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), hasher.Cost)
+	return string(hash), err
+}
+
+func (hasher *BcryptHasher) Verify(password string, encoded string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+
+	if err == bcrypt.ErrMismatchedHashAndPassword {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+func (hasher *BcryptHasher) NeedsRehash(encoded string) bool {
+	cost, err := bcrypt.Cost([]byte(encoded))
+	return err != nil || cost < hasher.Cost
+}
+
+//=====================================================================================
+
+type ScryptHasher struct {
+	LogN       int
+	R          int
+	P          int
+	SaltLength int
+	KeyLength  int
+}
+
+func (hasher *ScryptHasher) Id() string {
+	return "scrypt"
+}
+
+func (hasher *ScryptHasher) Hash(password string) (string, error) {
+	salt, err := generateSalt(hasher.SaltLength)
+	if err != nil {
+		return "", err
+	}
+
+	key, err := scrypt.Key([]byte(password), salt, 1<<uint(hasher.LogN), hasher.R, hasher.P, hasher.KeyLength)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("$scrypt$ln=%d,r=%d,p=%d$%s$%s", hasher.LogN, hasher.R, hasher.P, encodePHC(salt), encodePHC(key)), nil
+}
+
+func (hasher *ScryptHasher) Verify(password string, encoded string) (bool, error) {
+	params, salt, key, err := parsePHC(encoded, hasher.Id())
+	if err != nil {
+		return false, err
+	}
+
+	candidate, err := scrypt.Key([]byte(password), salt, 1<<uint(params["ln"]), params["r"], params["p"], len(key))
+	if err != nil {
+		return false, err
+	}
+
+	return subtle.ConstantTimeCompare(candidate, key) == 1, nil
+}
+
+func (hasher *ScryptHasher) NeedsRehash(encoded string) bool {
+	params, _, key, err := parsePHC(encoded, hasher.Id())
+	if err != nil {
+		return true
+	}
+
+	return params["ln"] < hasher.LogN || params["r"] < hasher.R || params["p"] < hasher.P || len(key) < hasher.KeyLength
+}
@@ -6,6 +6,7 @@ import (
 	"crypto/rand"
 	"crypto/sha512"
 	"crypto/subtle"
+	"fmt"
 	"io"
 
 	"golang.org/x/crypto/pbkdf2"
@@ -65,3 +66,54 @@ func MatchPassword(password string, pk *PasswordKey) bool {
 	}
 	return passed
 }
+
+// encodePasswordKey encodes a key from DeriveKey in the PHC format, so hashes
+// saved before PasswordHash existed can be verified by PBKDF2Hasher.
+func encodePasswordKey(pk *PasswordKey) string {
+	return fmt.Sprintf("$pbkdf2-sha512$i=%d,l=%d$%s$%s", IterationCount, len(pk.Key), encodePHC(pk.Salt), encodePHC(pk.Key))
+}
+
+//=====================================================================================
+
+// PBKDF2Hasher encodes the same PBKDF2-SHA512 keys as DeriveKey in the PHC
+// string format.
+type PBKDF2Hasher struct {
+	Iterations int
+	SaltLength int
+	KeyLength  int
+}
+
+func (hasher *PBKDF2Hasher) Id() string {
+	return "pbkdf2-sha512"
+}
+
+func (hasher *PBKDF2Hasher) Hash(password string) (string, error) {
+	salt, err := generateSalt(hasher.SaltLength)
+	if err != nil {
+		return "", err
+	}
+
+	key := pbkdf2.Key([]byte(password), salt, hasher.Iterations, hasher.KeyLength, sha512.New)
+
+	return fmt.Sprintf("$pbkdf2-sha512$i=%d,l=%d$%s$%s", hasher.Iterations, hasher.KeyLength, encodePHC(salt), encodePHC(key)), nil
+}
+
+func (hasher *PBKDF2Hasher) Verify(password string, encoded string) (bool, error) {
+	params, salt, key, err := parsePHC(encoded, hasher.Id())
+	if err != nil {
+		return false, err
+	}
+
+	candidate := pbkdf2.Key([]byte(password), salt, params["i"], len(key), sha512.New)
+
+	return subtle.ConstantTimeCompare(candidate, key) == 1, nil
+}
+
+func (hasher *PBKDF2Hasher) NeedsRehash(encoded string) bool {
+	params, _, key, err := parsePHC(encoded, hasher.Id())
+	if err != nil {
+		return true
+	}
+
+	return params["i"] < hasher.Iterations || len(key) < hasher.KeyLength
+}
@@ -0,0 +1,240 @@
+// Copyright (c) Luke Atherton 2015
+
+package authenticator
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// A PasswordPolicy sets the rules new passwords must follow. A zero value
+// for any limit turns that rule off.
+type PasswordPolicy struct {
+	MinLength int
+	MaxLength int
+	// MinCharacterClasses is how many of lowercase, uppercase, digits and
+	// symbols must appear.
+	MinCharacterClasses int
+	DisallowEmail       bool
+	// MinStrength is the lowest acceptable score from 0 (trivially guessed)
+	// to 4 (very hard to guess), on the same scale as zxcvbn.
+	MinStrength int
+	// Passwords seen in BreachCorpus at least MinBreachCount times are
+	// refused. A nil corpus turns the check off.
+	BreachCorpus   *BreachCorpus
+	MinBreachCount int
+	// HistoryLength is how many recent passwords, the current one included,
+	// cannot be chosen again. MinAge is how long a password must be kept
+	// before the user may change it.
+	HistoryLength int
+	MinAge        time.Duration
+}
+
+var (
+	DefaultPasswordPolicy = PasswordPolicy{
+		MinLength:           8,
+		MaxLength:           128,
+		MinCharacterClasses: 0,
+		DisallowEmail:       true,
+		MinStrength:         2,
+		MinBreachCount:      1,
+		HistoryLength:       5,
+	}
+)
+
+// A PasswordPolicyError lists the rules a new password broke.
+type PasswordPolicyError struct {
+	Errors []*Error
+}
+
+func (e *PasswordPolicyError) Error() string {
+	messages := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		messages[i] = err.Error()
+	}
+
+	return "Password Policy Failed: " + strings.Join(messages, ", ")
+}
+
+// Validate checks the password against every rule in the policy, returning
+// an error for each one it breaks.
+func (policy PasswordPolicy) Validate(password string, email string) []*Error {
+	errs := []*Error{}
+	length := utf8.RuneCountInString(password)
+
+	if policy.MinLength > 0 && length < policy.MinLength {
+		errs = append(errs, NewError(ErrCodePasswordTooShort, fmt.Sprintf("password must be at least %d characters", policy.MinLength)))
+	}
+
+	if policy.MaxLength > 0 && length > policy.MaxLength {
+		errs = append(errs, NewError(ErrCodePasswordTooLong, fmt.Sprintf("password must be at most %d characters", policy.MaxLength)))
+	}
+
+	if policy.MinCharacterClasses > 0 && characterClasses(password) < policy.MinCharacterClasses {
+		errs = append(errs, NewError(ErrCodePasswordTooSimple, fmt.Sprintf("password must use at least %d of lowercase letters, uppercase letters, digits and symbols", policy.MinCharacterClasses)))
+	}
+
+	if policy.DisallowEmail && email != "" && strings.EqualFold(password, email) {
+		errs = append(errs, NewError(ErrCodePasswordMatchesEmail, "password must not be the same as the email"))
+	}
+
+	if policy.MinStrength > 0 && PasswordStrength(password, email) < policy.MinStrength {
+		errs = append(errs, NewError(ErrCodePasswordTooWeak, "password is too easy to guess"))
+	}
+
+	if policy.BreachCorpus != nil && policy.MinBreachCount > 0 && policy.BreachCorpus.Count(password) >= policy.MinBreachCount {
+		errs = append(errs, NewError(ErrCodePasswordBreached, "password has appeared in a data breach"))
+	}
+
+	return errs
+}
+
+const (
+	classLower = 1 << iota
+	classUpper
+	classDigit
+	classSymbol
+)
+
+func characterClassSet(password string) int {
+	classes := 0
+
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			classes |= classLower
+		case unicode.IsUpper(r):
+			classes |= classUpper
+		case unicode.IsDigit(r):
+			classes |= classDigit
+		default:
+			classes |= classSymbol
+		}
+	}
+
+	return classes
+}
+
+func characterClasses(password string) int {
+	count := 0
+
+	for classes := characterClassSet(password); classes != 0; classes &= classes - 1 {
+		count++
+	}
+
+	return count
+}
+
+// PasswordStrength estimates how hard the password is to guess, scored from
+// 0 to 4 like zxcvbn. Guesses are estimated by brute force over the character
+// classes used, with common passwords, parts of the user's email, repeated
+// characters, sequences and keyboard runs counting for very little.
+func PasswordStrength(password string, userInputs ...string) int {
+	lower := strings.ToLower(password)
+
+	for _, common := range commonPasswords {
+		if lower == common {
+			return 0
+		}
+	}
+
+	// Dictionary words are guessed as a whole, so each costs about as much as
+	// one random character no matter how long it is.
+	words := []string{}
+	for _, input := range userInputs {
+		input = strings.ToLower(input)
+		words = append(words, input)
+		words = append(words, strings.FieldsFunc(input, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})...)
+	}
+	words = append(words, commonPasswords...)
+
+	for _, word := range words {
+		if utf8.RuneCountInString(word) >= 4 {
+			lower = strings.Replace(lower, word, "\x00\x00", -1)
+		}
+	}
+
+	charset := 0
+	classes := characterClassSet(password)
+	if classes&classLower != 0 {
+		charset += 26
+	}
+	if classes&classUpper != 0 {
+		charset += 26
+	}
+	if classes&classDigit != 0 {
+		charset += 10
+	}
+	if classes&classSymbol != 0 {
+		charset += 33
+	}
+
+	if charset == 0 {
+		return 0
+	}
+
+	bitsPerChar := math.Log2(float64(charset))
+	bits := 0.0
+	var previous rune
+
+	for i, r := range []rune(lower) {
+		switch {
+		case r == 0:
+			bits += bitsPerChar / 2
+		case i > 0 && (r == previous || r == previous+1 || r == previous-1 || keyboardAdjacent(previous, r)):
+			bits += bitsPerChar / 4
+		default:
+			bits += bitsPerChar
+		}
+
+		previous = r
+	}
+
+	logGuesses := bits * math.Log10(2)
+
+	switch {
+	case logGuesses < 3:
+		return 0
+	case logGuesses < 6:
+		return 1
+	case logGuesses < 8:
+		return 2
+	case logGuesses < 10:
+		return 3
+	}
+
+	return 4
+}
+
+var keyboardRows = []string{"1234567890", "qwertyuiop", "asdfghjkl", "zxcvbnm"}
+
+func keyboardAdjacent(a rune, b rune) bool {
+	for _, row := range keyboardRows {
+		i := strings.IndexRune(row, a)
+		j := strings.IndexRune(row, b)
+
+		if i >= 0 && j >= 0 && (i-j == 1 || j-i == 1) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// commonPasswords are among the most used passwords, so are guessed first.
+// Longer entries come before any they contain.
+var commonPasswords = []string{
+	"1234567890", "123456789", "12345678", "123456", "qwertyuiop", "qwerty",
+	"password1", "password", "passw0rd", "abc123", "111111", "123123",
+	"letmein", "welcome", "monkey", "dragon", "master", "login", "admin",
+	"secret", "iloveyou", "sunshine", "princess", "football", "baseball",
+	"shadow", "superman", "batman", "trustno1", "starwars", "whatever",
+	"freedom", "hello", "charlie", "michael", "mustang", "access", "qazwsx",
+	"zaq12wsx", "changeme",
+}
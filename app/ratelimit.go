@@ -0,0 +1,197 @@
+// Copyright (c) Luke Atherton 2015
+
+package authenticator
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// A RateLimitPolicy is a token bucket applied per key. Each key may make
+// Burst requests at once, and gets one more every Interval.
+type RateLimitPolicy struct {
+	Name     string
+	Burst    int
+	Interval time.Duration
+	Key      RateLimitKey
+}
+
+// A RateLimitKey picks what a policy limits by. An empty key is not limited.
+type RateLimitKey func(c *gin.Context) string
+
+var (
+	LoginIPRateLimit            = RateLimitPolicy{Name: "login-ip", Burst: 30, Interval: time.Second * 2, Key: KeyByIP}
+	LoginEmailRateLimit         = RateLimitPolicy{Name: "login-email", Burst: 20, Interval: time.Second * 3, Key: KeyByEmail}
+	MFARateLimit                = RateLimitPolicy{Name: "mfa", Burst: 10, Interval: time.Second * 6, Key: KeyByIP}
+	LoginCodeRateLimit          = RateLimitPolicy{Name: "login-code", Burst: 10, Interval: time.Second * 6, Key: KeyByIP}
+	PasswordResetRateLimit      = RateLimitPolicy{Name: "password-reset", Burst: 10, Interval: time.Second * 6, Key: KeyByIP}
+	RegistrationRateLimit       = RateLimitPolicy{Name: "registration", Burst: 5, Interval: time.Minute, Key: KeyByIP}
+	EmailCheckRateLimit         = RateLimitPolicy{Name: "email-check", Burst: 10, Interval: time.Second * 6, Key: KeyByIP}
+	VerificationRateLimit       = RateLimitPolicy{Name: "verification", Burst: 10, Interval: time.Second * 6, Key: KeyByIP}
+	EmailMessageIPRateLimit     = RateLimitPolicy{Name: "email-message-ip", Burst: 10, Interval: time.Minute, Key: KeyByIP}
+	EmailMessageRateLimit       = RateLimitPolicy{Name: "email-message", Burst: 3, Interval: time.Minute * 5, Key: KeyByEmail}
+	TokenRateLimit              = RateLimitPolicy{Name: "token", Burst: 30, Interval: time.Second * 2, Key: KeyByIP}
+	PasswordChangeRateLimit     = RateLimitPolicy{Name: "password-change", Burst: 5, Interval: time.Minute, Key: KeyByUser}
+	MFAEnrollmentRateLimit      = RateLimitPolicy{Name: "mfa-enrollment", Burst: 5, Interval: time.Minute, Key: KeyByUser}
+	EmailChangeRateLimit        = RateLimitPolicy{Name: "email-change", Burst: 5, Interval: time.Minute, Key: KeyByUser}
+	VerificationResendRateLimit = RateLimitPolicy{Name: "verification-resend", Burst: 3, Interval: time.Minute * 10, Key: KeyByEmail}
+)
+
+// A RateLimitStore holds the token buckets. Take removes a token from the
+// bucket for the key, reporting how long until one is available if it is
+// empty. Buckets should be shared between every instance of the service, so
+// a store backed by a shared database can be used in place of the in-memory
+// one.
+type RateLimitStore interface {
+	Take(key string, burst int, interval time.Duration) (allowed bool, retryAfter time.Duration, err error)
+}
+
+// RateLimit refuses requests once any of the policies has run out, with a
+// 429 and a Retry-After header. Errors from the store let the request
+// through, so an outage does not take logins down with it.
+func RateLimit(store RateLimitStore, policies ...RateLimitPolicy) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		for _, policy := range policies {
+			key := policy.Key(c)
+			if key == "" {
+				continue
+			}
+
+			allowed, retryAfter, err := store.Take(policy.Name+":"+key, policy.Burst, policy.Interval)
+			if err != nil {
+				fmt.Printf("ERROR: %v\n", err.Error())
+				continue
+			}
+
+			if !allowed {
+				c.Writer.Header().Set("Retry-After", fmt.Sprintf("%d", int(math.Ceil(retryAfter.Seconds()))))
+				c.JSON(http.StatusTooManyRequests, NewError(ErrCodeRateLimited, "too many requests"))
+				c.Abort()
+				return
+			}
+		}
+
+		c.Next()
+	}
+}
+
+// KeyByIP limits each client address.
+func KeyByIP(c *gin.Context) string {
+	return clientIP(c)
+}
+
+// KeyByEmail limits each email address, read from the email query parameter
+// or the email field of a JSON body. The body is put back for the handler.
+func KeyByEmail(c *gin.Context) string {
+	if email := c.Request.URL.Query().Get("email"); email != "" {
+		return strings.ToLower(email)
+	}
+
+	if c.Request.Body == nil || !strings.HasPrefix(c.Request.Header.Get("Content-Type"), "application/json") {
+		return ""
+	}
+
+	body, err := ioutil.ReadAll(c.Request.Body)
+	c.Request.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	if err != nil {
+		return ""
+	}
+
+	var view struct {
+		Email string `json:"email"`
+	}
+	json.Unmarshal(body, &view)
+
+	return strings.ToLower(view.Email)
+}
+
+// KeyByUser limits each authenticated user, so it must come after
+// Authorization.
+func KeyByUser(c *gin.Context) string {
+	userId, err := c.Get("userId")
+	if err != nil {
+		return ""
+	}
+
+	id, _ := userId.(string)
+
+	return id
+}
+
+//=====================================================================================
+
+// A MemoryRateLimitStore keeps buckets in memory, for a single instance.
+type MemoryRateLimitStore struct {
+	sync.Mutex
+	buckets   map[string]*rateLimitBucket
+	lastSweep time.Time
+}
+
+type rateLimitBucket struct {
+	tokens   float64
+	updated  time.Time
+	burst    int
+	interval time.Duration
+}
+
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{
+		buckets:   make(map[string]*rateLimitBucket),
+		lastSweep: time.Now(),
+	}
+}
+
+func (store *MemoryRateLimitStore) Take(key string, burst int, interval time.Duration) (bool, time.Duration, error) {
+	store.Lock()
+	defer store.Unlock()
+
+	now := time.Now()
+
+	bucket, ok := store.buckets[key]
+	if !ok {
+		store.sweep(now)
+
+		bucket = &rateLimitBucket{tokens: float64(burst), updated: now, burst: burst, interval: interval}
+		store.buckets[key] = bucket
+	}
+
+	bucket.refill(now)
+
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		return true, 0, nil
+	}
+
+	return false, time.Duration((1 - bucket.tokens) * float64(interval)), nil
+}
+
+func (bucket *rateLimitBucket) refill(now time.Time) {
+	bucket.tokens = math.Min(float64(bucket.burst), bucket.tokens+float64(now.Sub(bucket.updated))/float64(bucket.interval))
+	bucket.updated = now
+}
+
+// sweep drops buckets that have filled back up, since a new bucket is the
+// same as a full one. It runs at most once a minute.
+func (store *MemoryRateLimitStore) sweep(now time.Time) {
+	if now.Sub(store.lastSweep) < time.Minute {
+		return
+	}
+
+	store.lastSweep = now
+
+	for key, bucket := range store.buckets {
+		if now.Sub(bucket.updated) >= time.Duration(bucket.burst)*bucket.interval {
+			delete(store.buckets, key)
+		}
+	}
+}
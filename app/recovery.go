@@ -0,0 +1,148 @@
+// Copyright (c) Luke Atherton 2015
+
+package authenticator
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/satori/go.uuid"
+)
+
+var (
+	RecoveryCodeCount = 10
+	// RecoveryCodeLength is the number of random bytes in each code, which is
+	// shown to the user as base32 in groups of four characters.
+	RecoveryCodeLength = 10
+)
+
+var (
+	ErrMFANotEnabled = errors.New("Multi-factor authentication is not enabled.")
+)
+
+// RegenerateRecoveryCodes replaces the user's recovery codes with a new set,
+// so any codes issued before can no longer be used.
+func (auth *TokenAuthenticator) RegenerateRecoveryCodes(ctx context.Context, userId uuid.UUID) ([]string, error) {
+	credentials, err := auth.repo.GetCredentials(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	var codes []string
+
+	_, err = UpdateCredentials(ctx, auth.repo, credentials, func(credentials *Credentials) error {
+		if !credentials.IsTOTPEnabled {
+			return ErrMFANotEnabled
+		}
+
+		var err error
+		codes, err = generateRecoveryCodes(credentials)
+
+		return err
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// generateRecoveryCodes replaces the recovery codes on the credentials and
+// returns the new codes. Only their hashes are kept.
+func generateRecoveryCodes(credentials *Credentials) ([]string, error) {
+	codes := make([]string, RecoveryCodeCount)
+	hashes := make([]string, RecoveryCodeCount)
+
+	for i := range codes {
+		secret, err := generateSalt(RecoveryCodeLength)
+		if err != nil {
+			return nil, err
+		}
+
+		code := formatRecoveryCode(strings.ToLower(totpEncoding.EncodeToString(secret)))
+
+		codes[i] = code
+		hashes[i] = hashOpaqueToken(normalizeRecoveryCode(code))
+	}
+
+	credentials.RecoveryCodeHashes = hashes
+
+	return codes, nil
+}
+
+// consumeRecoveryCode removes the matching recovery code from the
+// credentials, reporting whether there was one. Every hash is compared so the
+// time taken does not reveal which code matched.
+func consumeRecoveryCode(credentials *Credentials, code string) bool {
+	hash := []byte(hashOpaqueToken(normalizeRecoveryCode(code)))
+	match := -1
+
+	for i, stored := range credentials.RecoveryCodeHashes {
+		if subtle.ConstantTimeCompare([]byte(stored), hash) == 1 {
+			match = i
+		}
+	}
+
+	if match < 0 {
+		return false
+	}
+
+	remaining := append([]string{}, credentials.RecoveryCodeHashes[:match]...)
+	credentials.RecoveryCodeHashes = append(remaining, credentials.RecoveryCodeHashes[match+1:]...)
+
+	return true
+}
+
+func formatRecoveryCode(code string) string {
+	groups := []string{}
+
+	for len(code) > 4 {
+		groups = append(groups, code[:4])
+		code = code[4:]
+	}
+
+	return strings.Join(append(groups, code), "-")
+}
+
+// normalizeRecoveryCode ignores case and the separators users may or may
+// not type.
+func normalizeRecoveryCode(code string) string {
+	return strings.NewReplacer("-", "", " ", "").Replace(strings.ToLower(code))
+}
+
+// Replaces the authenticated user's recovery codes with a new set
+func RegenerateRecoveryCodes(c *gin.Context) {
+	auth := c.MustGet("auth").(Authenticator)
+	id := GetIdParam(c.MustGet("userId").(string), c)
+
+	if id == uuid.Nil {
+		return
+	}
+
+	codes, err := auth.RegenerateRecoveryCodes(c.Request.Context(), id)
+
+	if err == ErrMFANotEnabled {
+		c.JSON(http.StatusBadRequest, NewError(ErrCodeNotExist, "multi-factor authentication is not enabled"))
+		return
+	}
+
+	if err == ErrConflict {
+		c.JSON(http.StatusConflict, NewError(ErrCodeConflict, "credentials were changed by another request"))
+		return
+	}
+
+	if err != nil {
+		fmt.Printf("ERROR: %v\n", err.Error())
+		c.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusCreated, RecoveryCodesResponse{RecoveryCodes: codes})
+	return
+}
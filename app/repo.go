@@ -3,8 +3,11 @@
 package authenticator
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
+	"strings"
 	"time"
 
 	"github.com/satori/go.uuid"
@@ -12,11 +15,87 @@ import (
 	"gopkg.in/mgo.v2/bson"
 )
 
+var (
+	ErrNotFound       = errors.New("Repo Failed: Not found.")
+	ErrDuplicateEmail = errors.New("Save Failed: Email already exists.")
+	ErrDuplicateKey   = errors.New("Save Failed: Duplicate key.")
+	ErrConflict       = errors.New("Save Failed: Credentials were changed by another request.")
+)
+
+var (
+	// How many times UpdateCredentials reads and saves the credentials
+	// before giving up with ErrConflict.
+	CredentialsUpdateAttempts = 3
+)
+
+// A Repo stores credentials and the tokens issued for them. Every method
+// gives up once its context is done. Lookups that find nothing return
+// ErrNotFound, and saves that would break a unique constraint return
+// ErrDuplicateEmail for the email, or ErrDuplicateKey for anything else.
+//
+// Credentials are versioned. SaveCredentials only replaces saved credentials
+// whose version matches the one being saved, returning ErrConflict if
+// another save got there first, and increments the version on success.
 type Repo interface {
-	SaveCredentials(userId uuid.UUID, credentials *Credentials) (err error)
-	GetCredentials(userId uuid.UUID) (credentials *Credentials, err error)
+	SaveCredentials(ctx context.Context, userId uuid.UUID, credentials *Credentials) (err error)
+	GetCredentials(ctx context.Context, userId uuid.UUID) (credentials *Credentials, err error)
+
+	FindEmail(ctx context.Context, email string) (id uuid.UUID, err error)
+	FindWebAuthnCredential(ctx context.Context, credentialId []byte) (id uuid.UUID, err error)
+
+	SaveRefreshToken(ctx context.Context, token *RefreshToken) (err error)
+	GetRefreshToken(ctx context.Context, tokenHash string) (token *RefreshToken, err error)
+	ConsumeRefreshToken(ctx context.Context, tokenHash string) (token *RefreshToken, err error)
+	RevokeRefreshTokenFamily(ctx context.Context, familyId uuid.UUID) (err error)
+	RevokeUserRefreshTokens(ctx context.Context, userId uuid.UUID) (err error)
+
+	SaveClient(ctx context.Context, client *Client) (err error)
+	GetClient(ctx context.Context, clientId string) (client *Client, err error)
+
+	SaveAuthorizationCode(ctx context.Context, code *AuthorizationCode) (err error)
+	ConsumeAuthorizationCode(ctx context.Context, codeHash string) (code *AuthorizationCode, err error)
+
+	SavePasswordReset(ctx context.Context, reset *PasswordReset) (err error)
+	ConsumePasswordReset(ctx context.Context, tokenHash string) (reset *PasswordReset, err error)
+	RestorePasswordReset(ctx context.Context, reset *PasswordReset) (err error)
+
+	SaveLoginLink(ctx context.Context, link *LoginLink) (err error)
+	GetLoginLink(ctx context.Context, userId uuid.UUID) (link *LoginLink, err error)
+	ConsumeLoginLink(ctx context.Context, userId uuid.UUID, tokenId string) (link *LoginLink, err error)
+	RecordLoginCodeFailure(ctx context.Context, userId uuid.UUID, tokenId string, maxAttempts int) (err error)
+}
+
+// UpdateCredentials applies update to the credentials and saves them. When
+// another request has saved in between, the credentials are read again and
+// update is applied to the fresh copy, so update must check whatever it
+// relies on rather than trusting what the caller checked earlier. An error
+// from update stops without saving. ErrConflict is returned once every
+// attempt has lost the race.
+func UpdateCredentials(ctx context.Context, repo Repo, credentials *Credentials, update func(credentials *Credentials) error) (*Credentials, error) {
+	userId := credentials.Id
+
+	for attempt := 1; ; attempt++ {
+		if err := update(credentials); err != nil {
+			return credentials, err
+		}
+
+		err := repo.SaveCredentials(ctx, userId, credentials)
+		if err != ErrConflict || attempt >= CredentialsUpdateAttempts {
+			return credentials, err
+		}
+
+		credentials, err = repo.GetCredentials(ctx, userId)
+		if err != nil {
+			return credentials, err
+		}
+	}
+}
+
+// A TestRepo can also be emptied between tests. Only the test constructors
+// return one, so production code has no way to clear its repo.
+type TestRepo interface {
+	Repo
 
-	FindEmail(email string) (id uuid.UUID, err error)
 	Cleanup()
 }
 
@@ -29,11 +108,54 @@ const (
 	TestDatabase = "authentication-test"
 )
 
+// MongoCollections names the collections MongoDBRepo and
+// MongoRevocationStore keep their documents in.
+type MongoCollections struct {
+	Credentials        string
+	RefreshTokens      string
+	Clients            string
+	AuthorizationCodes string
+	PasswordResets     string
+	LoginLinks         string
+	RevokedTokens      string
+	RevokedUsers       string
+}
+
+var DefaultMongoCollections = MongoCollections{
+	Credentials:        "credentials",
+	RefreshTokens:      "refreshtokens",
+	Clients:            "clients",
+	AuthorizationCodes: "authorizationcodes",
+	PasswordResets:     "passwordresets",
+	LoginLinks:         "loginlinks",
+	RevokedTokens:      "revokedtokens",
+	RevokedUsers:       "revokedusers",
+}
+
 type MongoDBRepo struct {
-	db *mgo.Session
+	db          *mgo.Session
+	dbName      string
+	collections MongoCollections
+	isTest      bool
+}
+
+func NewMongoRepo(dbHosts []string, authDb string, dbUsername string, dbPassword string, dbName string, collections MongoCollections) Repo {
+	mongoSession := dialMongo(dbHosts, authDb, dbUsername, dbPassword)
+
+	repo := &MongoDBRepo{
+		db:          mongoSession,
+		dbName:      dbName,
+		collections: collections,
+	}
+
+	repo.ensureIndexes()
+
+	fmt.Println("Init app db done")
+
+	return repo
 }
 
-func NewMongoRepo(dbHosts []string, authDb string, dbUsername string, dbPassword string) Repo {
+func dialMongo(dbHosts []string, authDb string, dbUsername string, dbPassword string) *mgo.Session {
 
 	fmt.Printf("Connecting to MongoDB cluster: %s\n", dbHosts)
 
@@ -65,7 +187,89 @@ func NewMongoRepo(dbHosts []string, authDb string, dbUsername string, dbPassword
 	// http://godoc.org/labix.org/v2/mgo#Session.SetMode
 	mongoSession.SetMode(mgo.Monotonic, true)
 
-	credentialsCollection := mongoSession.DB(AppDatabase).C("credentials")
+	return mongoSession
+}
+
+// NewMongoTestRepo connects to MongoDB on localhost and starts with an empty
+// TestDatabase.
+func NewMongoTestRepo(dbHosts []string, authDb string, dbUsername string, dbPassword string) TestRepo {
+	// Create a session which maintains a pool of socket connections
+	// to our MongoDB.
+	mongoSession, err := mgo.Dial("localhost")
+	if err != nil {
+		log.Fatalf("CreateSession: %s\n", err)
+	}
+
+	// Reads may not be entirely up-to-date, but they will always see the
+	// history of changes moving forward, the data read will be consistent
+	// across sequential queries in the same session, and modifications made
+	// within the session will be observed in following queries (read-your-writes).
+	// http://godoc.org/labix.org/v2/mgo#Session.SetMode
+	mongoSession.SetMode(mgo.Monotonic, true)
+
+	repo := &MongoDBRepo{
+		db:          mongoSession,
+		dbName:      TestDatabase,
+		collections: DefaultMongoCollections,
+		isTest:      true,
+	}
+
+	err = mongoSession.DB(repo.dbName).DropDatabase()
+	if err != nil {
+		panic(err)
+	}
+
+	repo.ensureIndexes()
+
+	fmt.Println("Init test db done")
+
+	return repo
+}
+
+// copySession requests a socket connection from the session for one
+// operation, with a socket timeout matching the context's deadline. mgo
+// cannot abandon an operation once it has started, so cancelling the context
+// only stops new ones. Close the copy to put the connection back into the
+// pool.
+func copySession(ctx context.Context, session *mgo.Session) (*mgo.Session, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	socketConnection := session.Copy()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		socketConnection.SetSocketTimeout(time.Until(deadline))
+	}
+
+	return socketConnection, nil
+}
+
+// mongoError maps mgo errors to the errors the Repo interface promises.
+func mongoError(err error) error {
+	if err == mgo.ErrNotFound {
+		return ErrNotFound
+	}
+
+	if mgo.IsDup(err) {
+		if strings.Contains(err.Error(), "email_1 dup key") {
+			return ErrDuplicateEmail
+		}
+
+		return ErrDuplicateKey
+	}
+
+	return err
+}
+
+// collection returns the named collection of the repo's database, using the
+// given socket connection.
+func (repo *MongoDBRepo) collection(session *mgo.Session, name string) *mgo.Collection {
+	return session.DB(repo.dbName).C(name)
+}
+
+func (repo *MongoDBRepo) ensureIndexes() {
+	credentialsCollection := repo.collection(repo.db, repo.collections.Credentials)
 
 	// Index
 	idx_email := mgo.Index{
@@ -76,70 +280,183 @@ func NewMongoRepo(dbHosts []string, authDb string, dbUsername string, dbPassword
 		Sparse:     true,
 	}
 
-	err = credentialsCollection.EnsureIndex(idx_email)
+	err := credentialsCollection.EnsureIndex(idx_email)
 	if err != nil {
 		panic(err)
 	}
 
-	repo := &MongoDBRepo{
-		db: mongoSession,
+	// SaveCredentials relies on this to refuse inserting a second copy of
+	// credentials whose version has moved on.
+	idx_id := mgo.Index{
+		Key:        []string{"id"},
+		Unique:     true,
+		Background: true,
 	}
 
-	fmt.Println("Init app db done")
+	err = credentialsCollection.EnsureIndex(idx_id)
+	if err != nil {
+		panic(err)
+	}
 
-	return repo
+	ensureWebAuthnIndexes(credentialsCollection)
+	ensureRefreshTokenIndexes(repo.collection(repo.db, repo.collections.RefreshTokens))
+	ensureOAuthIndexes(repo.collection(repo.db, repo.collections.Clients), repo.collection(repo.db, repo.collections.AuthorizationCodes))
+	ensurePasswordResetIndexes(repo.collection(repo.db, repo.collections.PasswordResets))
+	ensureLoginLinkIndexes(repo.collection(repo.db, repo.collections.LoginLinks))
 }
 
-func NewMongoTestRepo(dbHosts []string, authDb string, dbUsername string, dbPassword string) Repo {
-	// Create a session which maintains a pool of socket connections
-	// to our MongoDB.
-	mongoSession, err := mgo.Dial("localhost")
+// A WebAuthn credential may only be registered to one user.
+func ensureWebAuthnIndexes(credentialsCollection *mgo.Collection) {
+	idx_credential := mgo.Index{
+		Key:        []string{"webAuthnCredentials.credentialId"},
+		Unique:     true,
+		Background: true,
+		Sparse:     true,
+	}
+
+	err := credentialsCollection.EnsureIndex(idx_credential)
 	if err != nil {
-		log.Fatalf("CreateSession: %s\n", err)
+		panic(err)
 	}
+}
 
-	// Reads may not be entirely up-to-date, but they will always see the
-	// history of changes moving forward, the data read will be consistent
-	// across sequential queries in the same session, and modifications made
-	// within the session will be observed in following queries (read-your-writes).
-	// http://godoc.org/labix.org/v2/mgo#Session.SetMode
-	mongoSession.SetMode(mgo.Monotonic, true)
+func ensureRefreshTokenIndexes(collection *mgo.Collection) {
+	idx_token := mgo.Index{
+		Key:        []string{"tokenHash"},
+		Unique:     true,
+		DropDups:   true,
+		Background: true,
+	}
 
-	err = mongoSession.DB(TestDatabase).DropDatabase()
+	err := collection.EnsureIndex(idx_token)
 	if err != nil {
 		panic(err)
 	}
 
-	credentialsCollection := mongoSession.DB(TestDatabase).C("credentials")
+	idx_family := mgo.Index{
+		Key:        []string{"familyId"},
+		Background: true,
+	}
+
+	err = collection.EnsureIndex(idx_family)
+	if err != nil {
+		panic(err)
+	}
+}
 
-	// Index
-	index := mgo.Index{
-		Key:        []string{"email"},
+func ensureOAuthIndexes(clients *mgo.Collection, authorizationCodes *mgo.Collection) {
+	idx_client := mgo.Index{
+		Key:        []string{"clientId"},
 		Unique:     true,
 		DropDups:   true,
 		Background: true,
-		Sparse:     true,
 	}
 
-	err = credentialsCollection.EnsureIndex(index)
+	err := clients.EnsureIndex(idx_client)
 	if err != nil {
 		panic(err)
 	}
 
-	repo := &MongoDBRepo{
-		db: mongoSession,
+	idx_code := mgo.Index{
+		Key:        []string{"codeHash"},
+		Unique:     true,
+		DropDups:   true,
+		Background: true,
 	}
 
-	fmt.Println("Init test db done")
+	err = authorizationCodes.EnsureIndex(idx_code)
+	if err != nil {
+		panic(err)
+	}
 
-	return repo
+	// Unredeemed codes are removed by the server once they expire.
+	idx_expiry := mgo.Index{
+		Key:         []string{"expiryDate"},
+		Background:  true,
+		ExpireAfter: time.Second,
+	}
+
+	err = authorizationCodes.EnsureIndex(idx_expiry)
+	if err != nil {
+		panic(err)
+	}
+}
+
+func ensurePasswordResetIndexes(collection *mgo.Collection) {
+	idx_user := mgo.Index{
+		Key:        []string{"userId"},
+		Unique:     true,
+		DropDups:   true,
+		Background: true,
+	}
+
+	err := collection.EnsureIndex(idx_user)
+	if err != nil {
+		panic(err)
+	}
+
+	idx_token := mgo.Index{
+		Key:        []string{"tokenHash"},
+		Unique:     true,
+		DropDups:   true,
+		Background: true,
+	}
+
+	err = collection.EnsureIndex(idx_token)
+	if err != nil {
+		panic(err)
+	}
+
+	// Unused resets are removed by the server once they expire.
+	idx_expiry := mgo.Index{
+		Key:         []string{"expiryDate"},
+		Background:  true,
+		ExpireAfter: time.Second,
+	}
+
+	err = collection.EnsureIndex(idx_expiry)
+	if err != nil {
+		panic(err)
+	}
 }
 
+func ensureLoginLinkIndexes(collection *mgo.Collection) {
+	idx_user := mgo.Index{
+		Key:        []string{"userId"},
+		Unique:     true,
+		DropDups:   true,
+		Background: true,
+	}
+
+	err := collection.EnsureIndex(idx_user)
+	if err != nil {
+		panic(err)
+	}
+
+	// Unused links are removed by the server once they expire.
+	idx_expiry := mgo.Index{
+		Key:         []string{"expiryDate"},
+		Background:  true,
+		ExpireAfter: time.Second,
+	}
+
+	err = collection.EnsureIndex(idx_expiry)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// Cleanup drops the test database. Any other repo panics instead, so a
+// production database can never be dropped.
 func (repo *MongoDBRepo) Cleanup() {
+	if !repo.isTest {
+		panic("Cleanup is only allowed on test repos")
+	}
+
 	socketConnection := repo.db.Copy()
 	defer socketConnection.Close()
 
-	err := socketConnection.DB(TestDatabase).DropDatabase()
+	err := socketConnection.DB(repo.dbName).DropDatabase()
 
 	if err != nil {
 		panic(err)
@@ -148,51 +465,360 @@ func (repo *MongoDBRepo) Cleanup() {
 	fmt.Println("Database Cleared")
 }
 
-func (repo *MongoDBRepo) SaveCredentials(userId uuid.UUID, credentials *Credentials) (err error) {
-
-	// Request a socket connection from the session to process our query.
-	// Close the session when the goroutine exits and put the connection back
-	// into the pool.
-	socketConnection := repo.db.Copy()
+// SaveCredentials inserts new credentials, or replaces saved ones whose
+// version still matches. Credentials saved before they were versioned count
+// as version 0.
+func (repo *MongoDBRepo) SaveCredentials(ctx context.Context, userId uuid.UUID, credentials *Credentials) (err error) {
+	socketConnection, err := copySession(ctx, repo.db)
+	if err != nil {
+		return err
+	}
 	defer socketConnection.Close()
 
-	// Get a collection to execute the query against.
-	collection := socketConnection.DB(TestDatabase).C("credentials")
+	collection := repo.collection(socketConnection, repo.collections.Credentials)
 
-	_, err = collection.Upsert(bson.M{"id": userId}, credentials)
+	saved := *credentials
+	saved.Version++
 
-	return err
+	if credentials.Version == 0 {
+		// When the user exists at a later version, the upsert tries to insert
+		// and the unique id index refuses it.
+		_, err = collection.Upsert(bson.M{"id": userId, "version": bson.M{"$in": []interface{}{0, nil}}}, &saved)
+	} else {
+		err = collection.Update(bson.M{"id": userId, "version": credentials.Version}, &saved)
+	}
+
+	if err == mgo.ErrNotFound || (mgo.IsDup(err) && isIdDuplicate(err)) {
+		return ErrConflict
+	}
+
+	if err != nil {
+		return mongoError(err)
+	}
+
+	credentials.Version = saved.Version
+
+	return nil
 }
 
-func (repo *MongoDBRepo) GetCredentials(userId uuid.UUID) (credentials *Credentials, err error) {
+// isIdDuplicate reports whether a duplicate key error came from the id index,
+// in either of the formats MongoDB servers report it.
+func isIdDuplicate(err error) bool {
+	return strings.Contains(err.Error(), "$id_1 dup key") || strings.Contains(err.Error(), " id_1 dup key")
+}
 
-	// Request a socket connection from the session to process our query.
-	// Close the session when the goroutine exits and put the connection back
-	// into the pool.
-	socketConnection := repo.db.Copy()
+func (repo *MongoDBRepo) GetCredentials(ctx context.Context, userId uuid.UUID) (credentials *Credentials, err error) {
+	socketConnection, err := copySession(ctx, repo.db)
+	if err != nil {
+		return &Credentials{}, err
+	}
 	defer socketConnection.Close()
 
-	// Get a collection to execute the query against.
-	collection := socketConnection.DB(TestDatabase).C("credentials")
+	collection := repo.collection(socketConnection, repo.collections.Credentials)
 
 	result := &Credentials{}
 	err = collection.Find(bson.M{"id": userId}).One(&result)
 
-	return result, err
+	return result, mongoError(err)
 }
 
-func (repo *MongoDBRepo) FindEmail(email string) (id uuid.UUID, err error) {
-	// Request a socket connection from the session to process our query.
-	// Close the session when the goroutine exits and put the connection back
-	// into the pool.
-	socketConnection := repo.db.Copy()
+func (repo *MongoDBRepo) FindEmail(ctx context.Context, email string) (id uuid.UUID, err error) {
+	socketConnection, err := copySession(ctx, repo.db)
+	if err != nil {
+		return uuid.Nil, err
+	}
 	defer socketConnection.Close()
 
-	// Get a collection to execute the query against.
-	collection := socketConnection.DB(TestDatabase).C("credentials")
+	collection := repo.collection(socketConnection, repo.collections.Credentials)
 
 	result := Credentials{}
 	err = collection.Find(bson.M{"email": email}).One(&result)
 
-	return result.Id, err
+	return result.Id, mongoError(err)
+}
+
+// FindWebAuthnCredential returns the id of the user a WebAuthn credential is
+// registered to.
+func (repo *MongoDBRepo) FindWebAuthnCredential(ctx context.Context, credentialId []byte) (id uuid.UUID, err error) {
+	socketConnection, err := copySession(ctx, repo.db)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	defer socketConnection.Close()
+
+	collection := repo.collection(socketConnection, repo.collections.Credentials)
+
+	result := Credentials{}
+	err = collection.Find(bson.M{"webAuthnCredentials.credentialId": credentialId}).One(&result)
+
+	return result.Id, mongoError(err)
+}
+
+func (repo *MongoDBRepo) SaveRefreshToken(ctx context.Context, token *RefreshToken) (err error) {
+	socketConnection, err := copySession(ctx, repo.db)
+	if err != nil {
+		return err
+	}
+	defer socketConnection.Close()
+
+	collection := repo.collection(socketConnection, repo.collections.RefreshTokens)
+
+	_, err = collection.Upsert(bson.M{"id": token.Id}, token)
+
+	return mongoError(err)
+}
+
+func (repo *MongoDBRepo) GetRefreshToken(ctx context.Context, tokenHash string) (token *RefreshToken, err error) {
+	socketConnection, err := copySession(ctx, repo.db)
+	if err != nil {
+		return &RefreshToken{}, err
+	}
+	defer socketConnection.Close()
+
+	collection := repo.collection(socketConnection, repo.collections.RefreshTokens)
+
+	result := &RefreshToken{}
+	err = collection.Find(bson.M{"tokenHash": tokenHash}).One(result)
+
+	return result, mongoError(err)
+}
+
+// ConsumeRefreshToken atomically marks a refresh token as used and returns
+// the token as it was before the update, so callers can tell whether it had
+// already been used.
+func (repo *MongoDBRepo) ConsumeRefreshToken(ctx context.Context, tokenHash string) (token *RefreshToken, err error) {
+	socketConnection, err := copySession(ctx, repo.db)
+	if err != nil {
+		return &RefreshToken{}, err
+	}
+	defer socketConnection.Close()
+
+	collection := repo.collection(socketConnection, repo.collections.RefreshTokens)
+
+	change := mgo.Change{
+		Update:    bson.M{"$set": bson.M{"isUsed": true}},
+		ReturnNew: false,
+	}
+
+	result := &RefreshToken{}
+	_, err = collection.Find(bson.M{"tokenHash": tokenHash}).Apply(change, result)
+
+	return result, mongoError(err)
+}
+
+func (repo *MongoDBRepo) RevokeRefreshTokenFamily(ctx context.Context, familyId uuid.UUID) (err error) {
+	socketConnection, err := copySession(ctx, repo.db)
+	if err != nil {
+		return err
+	}
+	defer socketConnection.Close()
+
+	collection := repo.collection(socketConnection, repo.collections.RefreshTokens)
+
+	_, err = collection.UpdateAll(bson.M{"familyId": familyId}, bson.M{"$set": bson.M{"isRevoked": true}})
+
+	return mongoError(err)
+}
+
+func (repo *MongoDBRepo) RevokeUserRefreshTokens(ctx context.Context, userId uuid.UUID) (err error) {
+	socketConnection, err := copySession(ctx, repo.db)
+	if err != nil {
+		return err
+	}
+	defer socketConnection.Close()
+
+	collection := repo.collection(socketConnection, repo.collections.RefreshTokens)
+
+	_, err = collection.UpdateAll(bson.M{"userId": userId}, bson.M{"$set": bson.M{"isRevoked": true}})
+
+	return mongoError(err)
+}
+
+func (repo *MongoDBRepo) SaveClient(ctx context.Context, client *Client) (err error) {
+	socketConnection, err := copySession(ctx, repo.db)
+	if err != nil {
+		return err
+	}
+	defer socketConnection.Close()
+
+	collection := repo.collection(socketConnection, repo.collections.Clients)
+
+	_, err = collection.Upsert(bson.M{"clientId": client.ClientId}, client)
+
+	return mongoError(err)
+}
+
+func (repo *MongoDBRepo) GetClient(ctx context.Context, clientId string) (client *Client, err error) {
+	socketConnection, err := copySession(ctx, repo.db)
+	if err != nil {
+		return &Client{}, err
+	}
+	defer socketConnection.Close()
+
+	collection := repo.collection(socketConnection, repo.collections.Clients)
+
+	result := &Client{}
+	err = collection.Find(bson.M{"clientId": clientId}).One(result)
+
+	return result, mongoError(err)
+}
+
+func (repo *MongoDBRepo) SaveAuthorizationCode(ctx context.Context, code *AuthorizationCode) (err error) {
+	socketConnection, err := copySession(ctx, repo.db)
+	if err != nil {
+		return err
+	}
+	defer socketConnection.Close()
+
+	collection := repo.collection(socketConnection, repo.collections.AuthorizationCodes)
+
+	return mongoError(collection.Insert(code))
+}
+
+// ConsumeAuthorizationCode atomically removes an authorization code and
+// returns it, so a code can only ever be redeemed once.
+func (repo *MongoDBRepo) ConsumeAuthorizationCode(ctx context.Context, codeHash string) (code *AuthorizationCode, err error) {
+	socketConnection, err := copySession(ctx, repo.db)
+	if err != nil {
+		return &AuthorizationCode{}, err
+	}
+	defer socketConnection.Close()
+
+	collection := repo.collection(socketConnection, repo.collections.AuthorizationCodes)
+
+	result := &AuthorizationCode{}
+	_, err = collection.Find(bson.M{"codeHash": codeHash}).Apply(mgo.Change{Remove: true}, result)
+
+	return result, mongoError(err)
+}
+
+// SavePasswordReset stores a reset, replacing any reset already outstanding
+// for the same user.
+func (repo *MongoDBRepo) SavePasswordReset(ctx context.Context, reset *PasswordReset) (err error) {
+	socketConnection, err := copySession(ctx, repo.db)
+	if err != nil {
+		return err
+	}
+	defer socketConnection.Close()
+
+	collection := repo.collection(socketConnection, repo.collections.PasswordResets)
+
+	_, err = collection.Upsert(bson.M{"userId": reset.UserId}, reset)
+
+	return mongoError(err)
+}
+
+// ConsumePasswordReset atomically removes a reset and returns it, so a reset
+// token can only ever be used once.
+func (repo *MongoDBRepo) ConsumePasswordReset(ctx context.Context, tokenHash string) (reset *PasswordReset, err error) {
+	socketConnection, err := copySession(ctx, repo.db)
+	if err != nil {
+		return &PasswordReset{}, err
+	}
+	defer socketConnection.Close()
+
+	collection := repo.collection(socketConnection, repo.collections.PasswordResets)
+
+	result := &PasswordReset{}
+	_, err = collection.Find(bson.M{"tokenHash": tokenHash}).Apply(mgo.Change{Remove: true}, result)
+
+	return result, mongoError(err)
+}
+
+// RestorePasswordReset puts back a consumed reset, unless the user has
+// requested another one since. The unique userId index refuses the insert
+// then, and the newer reset is kept.
+func (repo *MongoDBRepo) RestorePasswordReset(ctx context.Context, reset *PasswordReset) (err error) {
+	socketConnection, err := copySession(ctx, repo.db)
+	if err != nil {
+		return err
+	}
+	defer socketConnection.Close()
+
+	collection := repo.collection(socketConnection, repo.collections.PasswordResets)
+
+	err = collection.Insert(reset)
+	if mgo.IsDup(err) {
+		return nil
+	}
+
+	return mongoError(err)
+}
+
+// SaveLoginLink stores a login link, replacing any link already outstanding
+// for the same user.
+func (repo *MongoDBRepo) SaveLoginLink(ctx context.Context, link *LoginLink) (err error) {
+	socketConnection, err := copySession(ctx, repo.db)
+	if err != nil {
+		return err
+	}
+	defer socketConnection.Close()
+
+	collection := repo.collection(socketConnection, repo.collections.LoginLinks)
+
+	_, err = collection.Upsert(bson.M{"userId": link.UserId}, link)
+
+	return mongoError(err)
+}
+
+func (repo *MongoDBRepo) GetLoginLink(ctx context.Context, userId uuid.UUID) (link *LoginLink, err error) {
+	socketConnection, err := copySession(ctx, repo.db)
+	if err != nil {
+		return &LoginLink{}, err
+	}
+	defer socketConnection.Close()
+
+	collection := repo.collection(socketConnection, repo.collections.LoginLinks)
+
+	result := &LoginLink{}
+	err = collection.Find(bson.M{"userId": userId}).One(result)
+
+	return result, mongoError(err)
+}
+
+// ConsumeLoginLink atomically removes a login link and returns it. The token
+// id must match, so a link that has been replaced can no longer be used.
+func (repo *MongoDBRepo) ConsumeLoginLink(ctx context.Context, userId uuid.UUID, tokenId string) (link *LoginLink, err error) {
+	socketConnection, err := copySession(ctx, repo.db)
+	if err != nil {
+		return &LoginLink{}, err
+	}
+	defer socketConnection.Close()
+
+	collection := repo.collection(socketConnection, repo.collections.LoginLinks)
+
+	result := &LoginLink{}
+	_, err = collection.Find(bson.M{"userId": userId, "tokenId": tokenId}).Apply(mgo.Change{Remove: true}, result)
+
+	return result, mongoError(err)
+}
+
+// RecordLoginCodeFailure atomically counts a wrong code against a login link,
+// and removes the link once it has had maxAttempts. The token id must match,
+// so failures against a link that has been replaced are not counted.
+func (repo *MongoDBRepo) RecordLoginCodeFailure(ctx context.Context, userId uuid.UUID, tokenId string, maxAttempts int) (err error) {
+	socketConnection, err := copySession(ctx, repo.db)
+	if err != nil {
+		return err
+	}
+	defer socketConnection.Close()
+
+	collection := repo.collection(socketConnection, repo.collections.LoginLinks)
+
+	result := &LoginLink{}
+	_, err = collection.Find(bson.M{"userId": userId, "tokenId": tokenId}).Apply(mgo.Change{
+		Update:    bson.M{"$inc": bson.M{"failedAttempts": 1}},
+		ReturnNew: true,
+	}, result)
+	if err != nil {
+		return mongoError(err)
+	}
+
+	if result.FailedAttempts < maxAttempts {
+		return nil
+	}
+
+	_, err = collection.RemoveAll(bson.M{"userId": userId, "tokenId": tokenId})
+
+	return mongoError(err)
 }
@@ -0,0 +1,703 @@
+// Copyright (c) Luke Atherton 2015
+
+package authenticator_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	. "github.com/lukeatherton/authenticator/app"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/satori/go.uuid"
+)
+
+// testMongoDB is set to run the specs against MongoDB on localhost as well.
+var testMongoDB = os.Getenv("AUTHENTICATOR_TEST_MONGODB") != ""
+
+// testPostgres is a connection string to run the specs against PostgreSQL.
+var testPostgres = os.Getenv("AUTHENTICATOR_TEST_POSTGRES")
+
+func newTestRepo() TestRepo {
+	if testMongoDB {
+		//dbHosts []string, authDb string, dbUsername string, dbPassword string
+		return NewMongoTestRepo([]string{"127.0.0.1"}, "admin", "", "")
+	}
+
+	return NewMemoryRepo()
+}
+
+/*
+Repo contract, every Repo implementation must pass these.
+*/
+var _ = Describe("MemoryRepo", func() {
+	itBehavesLikeARepo(func() TestRepo {
+		return NewMemoryRepo()
+	})
+})
+
+var _ = Describe("MongoDBRepo", func() {
+	BeforeEach(func() {
+		if !testMongoDB {
+			Skip("AUTHENTICATOR_TEST_MONGODB is not set")
+		}
+	})
+
+	itBehavesLikeARepo(newTestRepo)
+})
+
+var _ = Describe("SQLRepo with SQLite", func() {
+	itBehavesLikeARepo(func() TestRepo {
+		return NewSQLTestRepo("sqlite3", ":memory:")
+	})
+
+	itBehavesLikeASQLRepo(func(dataSource string) TestRepo {
+		return NewSQLTestRepo("sqlite3", dataSource)
+	})
+
+	It("refuses to clean up a repo that is not for tests", func() {
+		repo := NewSQLRepo("sqlite3", ":memory:").(interface {
+			Cleanup()
+		})
+
+		Expect(func() { repo.Cleanup() }).To(Panic())
+	})
+
+	It("shares a database with the revocation store", func() {
+		db := OpenSQL("sqlite3", ":memory:")
+		repo := NewSQLRepoFromDB(db)
+		store := NewSQLRevocationStoreFromDB(db)
+
+		credentials := &Credentials{Id: uuid.NewV4(), Email: "latherton@example.com"}
+		Expect(repo.SaveCredentials(context.Background(), credentials.Id, credentials)).To(BeNil())
+		Expect(store.RevokeToken(context.Background(), "jti", time.Now().Add(time.Hour))).To(BeNil())
+
+		id, err := repo.FindEmail(context.Background(), "latherton@example.com")
+		Expect(err).To(BeNil())
+		Expect(id).To(Equal(credentials.Id))
+
+		revoked, err := store.IsRevoked(context.Background(), "jti", credentials.Id, time.Now())
+		Expect(err).To(BeNil())
+		Expect(revoked).To(BeTrue())
+	})
+
+	Describe("Migrations", func() {
+		It("keeps the schema and data when reopened", func() {
+			dir, _ := ioutil.TempDir("", "authenticator")
+			defer os.RemoveAll(dir)
+			path := filepath.Join(dir, "authenticator.db")
+
+			credentials := &Credentials{Id: uuid.NewV4(), Email: "latherton@example.com"}
+			Expect(NewSQLRepo("sqlite3", path).SaveCredentials(context.Background(), credentials.Id, credentials)).To(BeNil())
+
+			id, err := NewSQLRepo("sqlite3", path).FindEmail(context.Background(), "latherton@example.com")
+			Expect(err).To(BeNil())
+			Expect(id).To(Equal(credentials.Id))
+		})
+	})
+})
+
+var _ = Describe("SQLRepo with PostgreSQL", func() {
+	BeforeEach(func() {
+		if testPostgres == "" {
+			Skip("AUTHENTICATOR_TEST_POSTGRES is not set")
+		}
+	})
+
+	itBehavesLikeARepo(func() TestRepo {
+		return NewSQLTestRepo("postgres", testPostgres)
+	})
+
+	itBehavesLikeASQLRepo(func(string) TestRepo {
+		return NewSQLTestRepo("postgres", testPostgres)
+	})
+})
+
+var _ = Describe("SQLRevocationStore", func() {
+	var store RevocationStore
+
+	BeforeEach(func() {
+		store = NewSQLRevocationStore("sqlite3", ":memory:")
+	})
+
+	It("revokes tokens by jti", func() {
+		Expect(store.RevokeToken(context.Background(), "jti", time.Now().Add(time.Hour))).To(BeNil())
+
+		revoked, err := store.IsRevoked(context.Background(), "jti", uuid.NewV4(), time.Now())
+		Expect(err).To(BeNil())
+		Expect(revoked).To(BeTrue())
+
+		revoked, _ = store.IsRevoked(context.Background(), "other", uuid.NewV4(), time.Now())
+		Expect(revoked).To(BeFalse())
+	})
+
+	It("revokes tokens issued to a user before the revocation", func() {
+		userId := uuid.NewV4()
+		Expect(store.RevokeUserTokens(context.Background(), userId, time.Now())).To(BeNil())
+
+		revoked, err := store.IsRevoked(context.Background(), "jti", userId, time.Now().Add(-time.Minute))
+		Expect(err).To(BeNil())
+		Expect(revoked).To(BeTrue())
+
+		revoked, _ = store.IsRevoked(context.Background(), "jti", userId, time.Now().Add(time.Minute))
+		Expect(revoked).To(BeFalse())
+	})
+
+	It("revokes tokens issued in the same millisecond as the revocation", func() {
+		userId := uuid.NewV4()
+		revokedDate := time.Now().Truncate(time.Millisecond)
+		Expect(store.RevokeUserTokens(context.Background(), userId, revokedDate)).To(BeNil())
+
+		revoked, err := store.IsRevoked(context.Background(), "jti", userId, revokedDate.Add(time.Microsecond*500))
+		Expect(err).To(BeNil())
+		Expect(revoked).To(BeTrue())
+
+		revoked, _ = store.IsRevoked(context.Background(), "jti", userId, revokedDate.Add(time.Millisecond))
+		Expect(revoked).To(BeFalse())
+	})
+})
+
+// itBehavesLikeASQLRepo covers what SQL repos do beyond the Repo contract.
+// newRepo is given an SQLite data source, which other databases ignore.
+func itBehavesLikeASQLRepo(newRepo func(dataSource string) TestRepo) {
+	var repo TestRepo
+
+	BeforeEach(func() {
+		repo = newRepo(":memory:")
+	})
+
+	AfterEach(func() {
+		if repo != nil {
+			repo.Cleanup()
+		}
+	})
+
+	It("treats emails differing only in case as the same", func() {
+		credentials := &Credentials{Id: uuid.NewV4(), Email: "latherton@example.com"}
+		repo.SaveCredentials(context.Background(), credentials.Id, credentials)
+
+		id, err := repo.FindEmail(context.Background(), "LAtherton@Example.com")
+		Expect(err).To(BeNil())
+		Expect(id).To(Equal(credentials.Id))
+
+		other := &Credentials{Id: uuid.NewV4(), Email: "LATHERTON@example.com"}
+		Expect(repo.SaveCredentials(context.Background(), other.Id, other)).To(Equal(ErrDuplicateEmail))
+	})
+}
+
+func itBehavesLikeARepo(newRepo func() TestRepo) {
+	var repo TestRepo
+
+	BeforeEach(func() {
+		repo = newRepo()
+	})
+
+	AfterEach(func() {
+		if repo != nil {
+			repo.Cleanup()
+		}
+	})
+
+	newCredentials := func(email string) *Credentials {
+		return &Credentials{
+			Id:          uuid.NewV4(),
+			Email:       email,
+			CreatedDate: time.Now().UTC().Truncate(time.Millisecond),
+		}
+	}
+
+	Describe("Credentials", func() {
+		It("returns saved credentials", func() {
+			credentials := newCredentials("latherton@example.com")
+			Expect(repo.SaveCredentials(context.Background(), credentials.Id, credentials)).To(BeNil())
+
+			saved, err := repo.GetCredentials(context.Background(), credentials.Id)
+			Expect(err).To(BeNil())
+			Expect(saved.Id).To(Equal(credentials.Id))
+			Expect(saved.Email).To(Equal("latherton@example.com"))
+			Expect(saved.CreatedDate.Equal(credentials.CreatedDate)).To(BeTrue())
+		})
+
+		It("returns not found for unknown users", func() {
+			_, err := repo.GetCredentials(context.Background(), uuid.NewV4())
+			Expect(err).To(Equal(ErrNotFound))
+		})
+
+		It("returns copies", func() {
+			credentials := newCredentials("latherton@example.com")
+			repo.SaveCredentials(context.Background(), credentials.Id, credentials)
+
+			credentials.Email = "changed@example.com"
+			saved, _ := repo.GetCredentials(context.Background(), credentials.Id)
+			saved.PendingEmail = "pending@example.com"
+
+			saved, _ = repo.GetCredentials(context.Background(), credentials.Id)
+			Expect(saved.Email).To(Equal("latherton@example.com"))
+			Expect(saved.PendingEmail).To(Equal(""))
+		})
+
+		It("replaces credentials saved again", func() {
+			credentials := newCredentials("latherton@example.com")
+			repo.SaveCredentials(context.Background(), credentials.Id, credentials)
+
+			credentials.IsEmailVerified = true
+			Expect(repo.SaveCredentials(context.Background(), credentials.Id, credentials)).To(BeNil())
+
+			saved, _ := repo.GetCredentials(context.Background(), credentials.Id)
+			Expect(saved.IsEmailVerified).To(BeTrue())
+		})
+
+		It("finds users by email", func() {
+			credentials := newCredentials("latherton@example.com")
+			repo.SaveCredentials(context.Background(), credentials.Id, credentials)
+
+			id, err := repo.FindEmail(context.Background(), "latherton@example.com")
+			Expect(err).To(BeNil())
+			Expect(id).To(Equal(credentials.Id))
+
+			_, err = repo.FindEmail(context.Background(), "someone@example.com")
+			Expect(err).To(Equal(ErrNotFound))
+		})
+
+		It("refuses an email belonging to another user", func() {
+			credentials := newCredentials("latherton@example.com")
+			repo.SaveCredentials(context.Background(), credentials.Id, credentials)
+
+			other := newCredentials("latherton@example.com")
+			Expect(repo.SaveCredentials(context.Background(), other.Id, other)).To(Equal(ErrDuplicateEmail))
+
+			id, _ := repo.FindEmail(context.Background(), "latherton@example.com")
+			Expect(id).To(Equal(credentials.Id))
+
+			_, err := repo.GetCredentials(context.Background(), other.Id)
+			Expect(err).To(Equal(ErrNotFound))
+		})
+
+		It("frees the old email when it changes", func() {
+			credentials := newCredentials("latherton@example.com")
+			repo.SaveCredentials(context.Background(), credentials.Id, credentials)
+
+			credentials.Email = "changed@example.com"
+			Expect(repo.SaveCredentials(context.Background(), credentials.Id, credentials)).To(BeNil())
+
+			id, _ := repo.FindEmail(context.Background(), "changed@example.com")
+			Expect(id).To(Equal(credentials.Id))
+
+			other := newCredentials("latherton@example.com")
+			Expect(repo.SaveCredentials(context.Background(), other.Id, other)).To(BeNil())
+		})
+
+		It("finds users by WebAuthn credential", func() {
+			credentials := newCredentials("latherton@example.com")
+			credentials.WebAuthnCredentials = []*WebAuthnCredential{{CredentialId: []byte{1, 2, 3}}}
+			repo.SaveCredentials(context.Background(), credentials.Id, credentials)
+
+			id, err := repo.FindWebAuthnCredential(context.Background(), []byte{1, 2, 3})
+			Expect(err).To(BeNil())
+			Expect(id).To(Equal(credentials.Id))
+
+			_, err = repo.FindWebAuthnCredential(context.Background(), []byte{4, 5, 6})
+			Expect(err).To(Equal(ErrNotFound))
+		})
+
+		It("refuses a WebAuthn credential belonging to another user", func() {
+			credentials := newCredentials("latherton@example.com")
+			credentials.WebAuthnCredentials = []*WebAuthnCredential{{CredentialId: []byte{1, 2, 3}}}
+			repo.SaveCredentials(context.Background(), credentials.Id, credentials)
+
+			other := newCredentials("other@example.com")
+			other.WebAuthnCredentials = []*WebAuthnCredential{{CredentialId: []byte{1, 2, 3}}}
+			Expect(repo.SaveCredentials(context.Background(), other.Id, other)).To(Equal(ErrDuplicateKey))
+		})
+
+		It("is safe for concurrent use", func() {
+			var wg sync.WaitGroup
+			errs := make([]error, 20)
+
+			for i := range errs {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					credentials := newCredentials("latherton@example.com")
+					errs[i] = repo.SaveCredentials(context.Background(), credentials.Id, credentials)
+				}(i)
+			}
+
+			wg.Wait()
+
+			saved := 0
+			for _, err := range errs {
+				if err == nil {
+					saved++
+				}
+			}
+
+			Expect(saved).To(Equal(1))
+		})
+	})
+
+	Describe("Versions", func() {
+		It("numbers each save", func() {
+			credentials := newCredentials("latherton@example.com")
+			Expect(repo.SaveCredentials(context.Background(), credentials.Id, credentials)).To(BeNil())
+			Expect(credentials.Version).To(Equal(1))
+
+			Expect(repo.SaveCredentials(context.Background(), credentials.Id, credentials)).To(BeNil())
+			Expect(credentials.Version).To(Equal(2))
+
+			saved, _ := repo.GetCredentials(context.Background(), credentials.Id)
+			Expect(saved.Version).To(Equal(2))
+		})
+
+		It("refuses to save over a change it has not seen", func() {
+			credentials := newCredentials("latherton@example.com")
+			repo.SaveCredentials(context.Background(), credentials.Id, credentials)
+
+			first, _ := repo.GetCredentials(context.Background(), credentials.Id)
+			second, _ := repo.GetCredentials(context.Background(), credentials.Id)
+
+			first.IsEmailVerified = true
+			Expect(repo.SaveCredentials(context.Background(), first.Id, first)).To(BeNil())
+
+			second.PasswordHash = "changed"
+			Expect(repo.SaveCredentials(context.Background(), second.Id, second)).To(Equal(ErrConflict))
+			Expect(second.Version).To(Equal(1))
+
+			saved, _ := repo.GetCredentials(context.Background(), credentials.Id)
+			Expect(saved.IsEmailVerified).To(BeTrue())
+			Expect(saved.PasswordHash).To(BeEmpty())
+		})
+
+		It("refuses to create credentials that already exist", func() {
+			credentials := newCredentials("latherton@example.com")
+			repo.SaveCredentials(context.Background(), credentials.Id, credentials)
+
+			again := newCredentials("other@example.com")
+			again.Id = credentials.Id
+			Expect(repo.SaveCredentials(context.Background(), again.Id, again)).To(Equal(ErrConflict))
+
+			saved, _ := repo.GetCredentials(context.Background(), credentials.Id)
+			Expect(saved.Email).To(Equal("latherton@example.com"))
+		})
+
+		It("refuses to recreate deleted credentials", func() {
+			credentials := newCredentials("latherton@example.com")
+			credentials.Version = 3
+			Expect(repo.SaveCredentials(context.Background(), credentials.Id, credentials)).To(Equal(ErrConflict))
+
+			_, err := repo.GetCredentials(context.Background(), credentials.Id)
+			Expect(err).To(Equal(ErrNotFound))
+		})
+
+		It("retries updates against the latest credentials", func() {
+			credentials := newCredentials("latherton@example.com")
+			repo.SaveCredentials(context.Background(), credentials.Id, credentials)
+
+			stale, _ := repo.GetCredentials(context.Background(), credentials.Id)
+
+			credentials.IsEmailVerified = true
+			repo.SaveCredentials(context.Background(), credentials.Id, credentials)
+
+			attempts := 0
+			updated, err := UpdateCredentials(context.Background(), repo, stale, func(credentials *Credentials) error {
+				attempts++
+				credentials.FailedLoginAttempts++
+				return nil
+			})
+
+			Expect(err).To(BeNil())
+			Expect(attempts).To(Equal(2))
+			Expect(updated.Version).To(Equal(3))
+
+			saved, _ := repo.GetCredentials(context.Background(), credentials.Id)
+			Expect(saved.IsEmailVerified).To(BeTrue())
+			Expect(saved.FailedLoginAttempts).To(Equal(1))
+		})
+
+		It("keeps every concurrent update", func() {
+			credentials := newCredentials("latherton@example.com")
+			repo.SaveCredentials(context.Background(), credentials.Id, credentials)
+
+			attempts := CredentialsUpdateAttempts
+			CredentialsUpdateAttempts = 100
+			defer func() { CredentialsUpdateAttempts = attempts }()
+
+			var wg sync.WaitGroup
+			errs := make([]error, 10)
+
+			for i := range errs {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					current, _ := repo.GetCredentials(context.Background(), credentials.Id)
+					_, errs[i] = UpdateCredentials(context.Background(), repo, current, func(credentials *Credentials) error {
+						credentials.FailedLoginAttempts++
+						return nil
+					})
+				}(i)
+			}
+
+			wg.Wait()
+
+			for _, err := range errs {
+				Expect(err).To(BeNil())
+			}
+
+			saved, _ := repo.GetCredentials(context.Background(), credentials.Id)
+			Expect(saved.FailedLoginAttempts).To(Equal(10))
+		})
+	})
+
+	Describe("Refresh tokens", func() {
+		var token *RefreshToken
+
+		BeforeEach(func() {
+			token = &RefreshToken{
+				Id:         uuid.NewV4(),
+				FamilyId:   uuid.NewV4(),
+				UserId:     uuid.NewV4(),
+				TokenHash:  "tokenhash",
+				Amr:        []string{"pwd"},
+				ExpiryDate: time.Now().Add(time.Hour),
+			}
+			repo.SaveRefreshToken(context.Background(), token)
+		})
+
+		It("returns saved tokens by hash", func() {
+			saved, err := repo.GetRefreshToken(context.Background(), "tokenhash")
+			Expect(err).To(BeNil())
+			Expect(saved.Id).To(Equal(token.Id))
+			Expect(saved.Amr).To(Equal([]string{"pwd"}))
+
+			_, err = repo.GetRefreshToken(context.Background(), "unknown")
+			Expect(err).To(Equal(ErrNotFound))
+		})
+
+		It("refuses a token hash belonging to another token", func() {
+			other := &RefreshToken{Id: uuid.NewV4(), TokenHash: "tokenhash"}
+			Expect(repo.SaveRefreshToken(context.Background(), other)).To(Equal(ErrDuplicateKey))
+		})
+
+		It("returns the token as it was before consuming it", func() {
+			consumed, err := repo.ConsumeRefreshToken(context.Background(), "tokenhash")
+			Expect(err).To(BeNil())
+			Expect(consumed.IsUsed).To(BeFalse())
+
+			consumed, err = repo.ConsumeRefreshToken(context.Background(), "tokenhash")
+			Expect(err).To(BeNil())
+			Expect(consumed.IsUsed).To(BeTrue())
+		})
+
+		It("revokes token families", func() {
+			other := &RefreshToken{Id: uuid.NewV4(), FamilyId: uuid.NewV4(), UserId: token.UserId, TokenHash: "otherhash"}
+			repo.SaveRefreshToken(context.Background(), other)
+
+			Expect(repo.RevokeRefreshTokenFamily(context.Background(), token.FamilyId)).To(BeNil())
+
+			saved, _ := repo.GetRefreshToken(context.Background(), "tokenhash")
+			Expect(saved.IsRevoked).To(BeTrue())
+			saved, _ = repo.GetRefreshToken(context.Background(), "otherhash")
+			Expect(saved.IsRevoked).To(BeFalse())
+		})
+
+		It("revokes a user's tokens", func() {
+			other := &RefreshToken{Id: uuid.NewV4(), FamilyId: uuid.NewV4(), UserId: uuid.NewV4(), TokenHash: "otherhash"}
+			repo.SaveRefreshToken(context.Background(), other)
+
+			Expect(repo.RevokeUserRefreshTokens(context.Background(), token.UserId)).To(BeNil())
+
+			saved, _ := repo.GetRefreshToken(context.Background(), "tokenhash")
+			Expect(saved.IsRevoked).To(BeTrue())
+			saved, _ = repo.GetRefreshToken(context.Background(), "otherhash")
+			Expect(saved.IsRevoked).To(BeFalse())
+		})
+	})
+
+	Describe("Clients", func() {
+		It("returns saved clients", func() {
+			client := &Client{ClientId: "client", Name: "Client", RedirectUris: []string{"https://client.example.com/callback"}}
+			Expect(repo.SaveClient(context.Background(), client)).To(BeNil())
+
+			client.Name = "Renamed"
+			Expect(repo.SaveClient(context.Background(), client)).To(BeNil())
+
+			saved, err := repo.GetClient(context.Background(), "client")
+			Expect(err).To(BeNil())
+			Expect(saved.Name).To(Equal("Renamed"))
+			Expect(saved.RedirectUris).To(Equal(client.RedirectUris))
+
+			_, err = repo.GetClient(context.Background(), "unknown")
+			Expect(err).To(Equal(ErrNotFound))
+		})
+	})
+
+	Describe("Authorization codes", func() {
+		It("consumes codes once", func() {
+			code := &AuthorizationCode{CodeHash: "codehash", ClientId: "client", UserId: uuid.NewV4(), ExpiryDate: time.Now().Add(time.Minute)}
+			Expect(repo.SaveAuthorizationCode(context.Background(), code)).To(BeNil())
+			Expect(repo.SaveAuthorizationCode(context.Background(), code)).To(Equal(ErrDuplicateKey))
+
+			consumed, err := repo.ConsumeAuthorizationCode(context.Background(), "codehash")
+			Expect(err).To(BeNil())
+			Expect(consumed.UserId).To(Equal(code.UserId))
+
+			_, err = repo.ConsumeAuthorizationCode(context.Background(), "codehash")
+			Expect(err).To(Equal(ErrNotFound))
+		})
+	})
+
+	Describe("Password resets", func() {
+		It("keeps one reset per user and consumes it once", func() {
+			userId := uuid.NewV4()
+			expiryDate := time.Now().Add(time.Hour)
+			repo.SavePasswordReset(context.Background(), &PasswordReset{UserId: userId, TokenHash: "first", ExpiryDate: expiryDate})
+			Expect(repo.SavePasswordReset(context.Background(), &PasswordReset{UserId: userId, TokenHash: "second", ExpiryDate: expiryDate})).To(BeNil())
+
+			_, err := repo.ConsumePasswordReset(context.Background(), "first")
+			Expect(err).To(Equal(ErrNotFound))
+
+			consumed, err := repo.ConsumePasswordReset(context.Background(), "second")
+			Expect(err).To(BeNil())
+			Expect(consumed.UserId).To(Equal(userId))
+
+			_, err = repo.ConsumePasswordReset(context.Background(), "second")
+			Expect(err).To(Equal(ErrNotFound))
+		})
+
+		It("restores a consumed reset", func() {
+			userId := uuid.NewV4()
+			expiryDate := time.Now().Add(time.Hour)
+			repo.SavePasswordReset(context.Background(), &PasswordReset{UserId: userId, TokenHash: "first", ExpiryDate: expiryDate})
+
+			consumed, _ := repo.ConsumePasswordReset(context.Background(), "first")
+			Expect(repo.RestorePasswordReset(context.Background(), consumed)).To(BeNil())
+
+			restored, err := repo.ConsumePasswordReset(context.Background(), "first")
+			Expect(err).To(BeNil())
+			Expect(restored.UserId).To(Equal(userId))
+		})
+
+		It("keeps a newer reset over a restored one", func() {
+			userId := uuid.NewV4()
+			expiryDate := time.Now().Add(time.Hour)
+			repo.SavePasswordReset(context.Background(), &PasswordReset{UserId: userId, TokenHash: "first", ExpiryDate: expiryDate})
+
+			consumed, _ := repo.ConsumePasswordReset(context.Background(), "first")
+			repo.SavePasswordReset(context.Background(), &PasswordReset{UserId: userId, TokenHash: "second", ExpiryDate: expiryDate})
+			Expect(repo.RestorePasswordReset(context.Background(), consumed)).To(BeNil())
+
+			_, err := repo.ConsumePasswordReset(context.Background(), "first")
+			Expect(err).To(Equal(ErrNotFound))
+
+			_, err = repo.ConsumePasswordReset(context.Background(), "second")
+			Expect(err).To(BeNil())
+		})
+	})
+
+	Describe("Login links", func() {
+		It("keeps one link per user and consumes it once", func() {
+			userId := uuid.NewV4()
+			expiryDate := time.Now().Add(time.Hour)
+			repo.SaveLoginLink(context.Background(), &LoginLink{UserId: userId, TokenId: "first", ExpiryDate: expiryDate})
+			Expect(repo.SaveLoginLink(context.Background(), &LoginLink{UserId: userId, TokenId: "second", FailedAttempts: 1, ExpiryDate: expiryDate})).To(BeNil())
+
+			saved, err := repo.GetLoginLink(context.Background(), userId)
+			Expect(err).To(BeNil())
+			Expect(saved.FailedAttempts).To(Equal(1))
+
+			_, err = repo.ConsumeLoginLink(context.Background(), userId, "first")
+			Expect(err).To(Equal(ErrNotFound))
+
+			consumed, err := repo.ConsumeLoginLink(context.Background(), userId, "second")
+			Expect(err).To(BeNil())
+			Expect(consumed.TokenId).To(Equal("second"))
+
+			_, err = repo.GetLoginLink(context.Background(), userId)
+			Expect(err).To(Equal(ErrNotFound))
+		})
+
+		It("counts wrong codes and removes the link at the limit", func() {
+			userId := uuid.NewV4()
+			repo.SaveLoginLink(context.Background(), &LoginLink{UserId: userId, TokenId: "first", ExpiryDate: time.Now().Add(time.Hour)})
+
+			Expect(repo.RecordLoginCodeFailure(context.Background(), userId, "first", 3)).To(BeNil())
+			Expect(repo.RecordLoginCodeFailure(context.Background(), userId, "first", 3)).To(BeNil())
+
+			saved, _ := repo.GetLoginLink(context.Background(), userId)
+			Expect(saved.FailedAttempts).To(Equal(2))
+
+			Expect(repo.RecordLoginCodeFailure(context.Background(), userId, "first", 3)).To(BeNil())
+
+			_, err := repo.GetLoginLink(context.Background(), userId)
+			Expect(err).To(Equal(ErrNotFound))
+		})
+
+		It("leaves a replaced link alone when counting wrong codes", func() {
+			userId := uuid.NewV4()
+			expiryDate := time.Now().Add(time.Hour)
+			repo.SaveLoginLink(context.Background(), &LoginLink{UserId: userId, TokenId: "first", ExpiryDate: expiryDate})
+			repo.SaveLoginLink(context.Background(), &LoginLink{UserId: userId, TokenId: "second", ExpiryDate: expiryDate})
+
+			Expect(repo.RecordLoginCodeFailure(context.Background(), userId, "first", 1)).To(Equal(ErrNotFound))
+
+			saved, err := repo.GetLoginLink(context.Background(), userId)
+			Expect(err).To(BeNil())
+			Expect(saved.TokenId).To(Equal("second"))
+			Expect(saved.FailedAttempts).To(Equal(0))
+		})
+
+		It("counts every concurrent wrong code", func() {
+			userId := uuid.NewV4()
+			repo.SaveLoginLink(context.Background(), &LoginLink{UserId: userId, TokenId: "first", ExpiryDate: time.Now().Add(time.Hour)})
+
+			var wg sync.WaitGroup
+			for i := 0; i < 10; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					repo.RecordLoginCodeFailure(context.Background(), userId, "first", 100)
+				}()
+			}
+
+			wg.Wait()
+
+			saved, _ := repo.GetLoginLink(context.Background(), userId)
+			Expect(saved.FailedAttempts).To(Equal(10))
+		})
+	})
+
+	Describe("Contexts", func() {
+		It("gives up once the context is done", func() {
+			credentials := newCredentials("latherton@example.com")
+			repo.SaveCredentials(context.Background(), credentials.Id, credentials)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+
+			_, err := repo.GetCredentials(ctx, credentials.Id)
+			Expect(err).To(Equal(context.Canceled))
+
+			other := newCredentials("other@example.com")
+			Expect(repo.SaveCredentials(ctx, other.Id, other)).To(Equal(context.Canceled))
+
+			_, err = repo.GetCredentials(context.Background(), other.Id)
+			Expect(err).To(Equal(ErrNotFound))
+		})
+	})
+
+	Describe("Cleanup", func() {
+		It("removes everything", func() {
+			credentials := newCredentials("latherton@example.com")
+			repo.SaveCredentials(context.Background(), credentials.Id, credentials)
+
+			repo.Cleanup()
+
+			_, err := repo.FindEmail(context.Background(), "latherton@example.com")
+			Expect(err).To(Equal(ErrNotFound))
+		})
+	})
+}
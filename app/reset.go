@@ -0,0 +1,178 @@
+// Copyright (c) Luke Atherton 2015
+
+package authenticator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	. "github.com/lukeatherton/domain-events"
+	"github.com/satori/go.uuid"
+)
+
+var (
+	PasswordResetLifetime = time.Hour
+	PasswordResetLength   = 32
+)
+
+var (
+	ErrInvalidResetToken = errors.New("Reset Failed: Invalid or expired reset token.")
+)
+
+// RequestPasswordReset issues a reset token for the user with the given email,
+// replacing any reset already outstanding for them. Only a hash of the token
+// is stored. An unknown email is not an error; userId is uuid.Nil instead.
+func (auth *TokenAuthenticator) RequestPasswordReset(ctx context.Context, email string) (uuid.UUID, string, error) {
+	userId, _ := auth.repo.FindEmail(ctx, email)
+	if userId == uuid.Nil {
+		return uuid.Nil, "", nil
+	}
+
+	token, err := generateOpaqueToken(PasswordResetLength)
+	if err != nil {
+		return uuid.Nil, "", err
+	}
+
+	now := time.Now()
+
+	reset := &PasswordReset{
+		UserId:      userId,
+		TokenHash:   hashOpaqueToken(token),
+		CreatedDate: now,
+		ExpiryDate:  now.Add(PasswordResetLifetime),
+	}
+
+	if err := auth.repo.SavePasswordReset(ctx, reset); err != nil {
+		return uuid.Nil, "", err
+	}
+
+	return userId, token, nil
+}
+
+// ResetPassword consumes a reset token and sets the user's new password. Any
+// tokens issued before the reset are revoked. A password that breaks the
+// DefaultPasswordPolicy, or was used recently, returns a *PasswordPolicyError
+// and leaves the token usable, unless a newer reset has been requested.
+func (auth *TokenAuthenticator) ResetPassword(ctx context.Context, token string, newPassword string) (uuid.UUID, error) {
+	reset, err := auth.repo.ConsumePasswordReset(ctx, hashOpaqueToken(token))
+	if err != nil || reset.TokenHash == "" {
+		return uuid.Nil, ErrInvalidResetToken
+	}
+
+	if time.Now().After(reset.ExpiryDate) {
+		return uuid.Nil, ErrInvalidResetToken
+	}
+
+	credentials, err := auth.repo.GetCredentials(ctx, reset.UserId)
+	if err != nil || credentials.Id == uuid.Nil {
+		return uuid.Nil, ErrInvalidResetToken
+	}
+
+	if policy_errs := DefaultPasswordPolicy.Validate(newPassword, credentials.Email); len(policy_errs) != 0 {
+		if err := auth.repo.RestorePasswordReset(ctx, reset); err != nil {
+			return uuid.Nil, err
+		}
+
+		return uuid.Nil, &PasswordPolicyError{Errors: policy_errs}
+	}
+
+	credentials, err = UpdateCredentials(ctx, auth.repo, credentials, func(credentials *Credentials) error {
+		return credentials.ReplacePassword(newPassword, time.Now())
+	})
+
+	if err != nil {
+		// The token can be used again if the password was refused, or other
+		// requests kept changing the account, unless a newer reset has been
+		// requested meanwhile.
+		if _, ok := err.(*PasswordPolicyError); ok || err == ErrConflict {
+			if save_err := auth.repo.RestorePasswordReset(ctx, reset); save_err != nil {
+				return uuid.Nil, save_err
+			}
+		}
+
+		return uuid.Nil, err
+	}
+
+	return credentials.Id, auth.RevokeUserTokens(ctx, credentials.Id)
+}
+
+// Starts a password reset. The response is the same whether or not the email
+// is registered, the reset token only goes out in the published event.
+func RequestPasswordReset(c *gin.Context) {
+	auth := c.MustGet("auth").(Authenticator)
+	publisher := c.MustGet("publisher").(Publisher)
+
+	c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
+
+	var view *PasswordResetRequestView
+	c.Bind(&view)
+
+	if view == nil || view.Email == "" {
+		c.JSON(http.StatusBadRequest, NewError(ErrCodeValueRequired, "email is a required field"))
+		return
+	}
+
+	email := strings.ToLower(view.Email)
+
+	userId, token, err := auth.RequestPasswordReset(c.Request.Context(), email)
+	if err != nil {
+		fmt.Printf("ERROR: %v\n", err.Error())
+	}
+
+	if userId != uuid.Nil && token != "" {
+		go publisher.PublishMessage(NewPasswordResetRequestedEvent(userId, email, token, uuid.Nil))
+	}
+
+	c.JSON(http.StatusAccepted, "password reset requested")
+	return
+}
+
+// Sets a new password using a token from a password reset request
+func ResetPassword(c *gin.Context) {
+	auth := c.MustGet("auth").(Authenticator)
+
+	c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
+
+	var view *PasswordResetView
+	c.Bind(&view)
+
+	if view == nil || view.Token == "" {
+		c.JSON(http.StatusBadRequest, NewError(ErrCodeValueRequired, "token is a required field"))
+		return
+	}
+
+	if view.NewPassword == "" {
+		c.JSON(http.StatusBadRequest, NewError(ErrCodeValueRequired, "new password is a required field"))
+		return
+	}
+
+	_, err := auth.ResetPassword(c.Request.Context(), view.Token, view.NewPassword)
+
+	if err == ErrInvalidResetToken {
+		c.JSON(http.StatusBadRequest, NewError(ErrCodeInvalidToken, "reset token is invalid or has expired"))
+		return
+	}
+
+	if policy_err, ok := err.(*PasswordPolicyError); ok {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Errors: policy_err.Errors})
+		return
+	}
+
+	if err == ErrConflict {
+		c.JSON(http.StatusConflict, NewError(ErrCodeConflict, "credentials were changed by another request"))
+		return
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, "password reset")
+	return
+}
@@ -0,0 +1,297 @@
+// Copyright (c) Luke Atherton 2015
+
+package authenticator
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/satori/go.uuid"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// A RevocationStore records access tokens that must be rejected before they
+// expire, either individually by their jti claim or in bulk for a user.
+type RevocationStore interface {
+	RevokeToken(ctx context.Context, jti string, expiryDate time.Time) (err error)
+	RevokeUserTokens(ctx context.Context, userId uuid.UUID, revokedDate time.Time) (err error)
+	IsRevoked(ctx context.Context, jti string, userId uuid.UUID, issuedDate time.Time) (revoked bool, err error)
+}
+
+type RevokedToken struct {
+	Jti        string    `json:"jti" xml:"jti" bson:"jti"`
+	ExpiryDate time.Time `json:"expiryDate" xml:"expiryDate" bson:"expiryDate"`
+}
+
+type RevokedUser struct {
+	UserId      uuid.UUID `json:"userId" xml:"userId" bson:"userId"`
+	RevokedDate time.Time `json:"revokedDate" xml:"revokedDate" bson:"revokedDate"`
+}
+
+// Tokens carry their issue time to the millisecond, so user revocation is
+// compared at that resolution, which is also all MongoDB keeps. A token
+// issued in the same millisecond as the revocation is revoked with it.
+func issuedByRevocation(issuedDate time.Time, revokedDate time.Time) bool {
+	return !issuedDate.Truncate(time.Millisecond).After(revokedDate.Truncate(time.Millisecond))
+}
+
+//=====================================================================================
+
+type MemoryRevocationStore struct {
+	mutex  sync.RWMutex
+	tokens map[string]time.Time
+	users  map[uuid.UUID]time.Time
+}
+
+func NewMemoryRevocationStore() RevocationStore {
+	return &MemoryRevocationStore{
+		tokens: make(map[string]time.Time),
+		users:  make(map[uuid.UUID]time.Time),
+	}
+}
+
+func (store *MemoryRevocationStore) RevokeToken(ctx context.Context, jti string, expiryDate time.Time) (err error) {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	now := time.Now()
+	for revokedJti, revokedExpiryDate := range store.tokens {
+		if now.After(revokedExpiryDate) {
+			delete(store.tokens, revokedJti)
+		}
+	}
+
+	store.tokens[jti] = expiryDate
+
+	return nil
+}
+
+func (store *MemoryRevocationStore) RevokeUserTokens(ctx context.Context, userId uuid.UUID, revokedDate time.Time) (err error) {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	store.users[userId] = revokedDate
+
+	return nil
+}
+
+func (store *MemoryRevocationStore) IsRevoked(ctx context.Context, jti string, userId uuid.UUID, issuedDate time.Time) (revoked bool, err error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	if _, ok := store.tokens[jti]; ok {
+		return true, nil
+	}
+
+	if revokedDate, ok := store.users[userId]; ok && issuedByRevocation(issuedDate, revokedDate) {
+		return true, nil
+	}
+
+	return false, nil
+}
+
+//=====================================================================================
+
+type MongoRevocationStore struct {
+	db          *mgo.Session
+	dbName      string
+	collections MongoCollections
+}
+
+func NewMongoRevocationStore(dbHosts []string, authDb string, dbUsername string, dbPassword string, dbName string, collections MongoCollections) RevocationStore {
+	mongoSession := dialMongo(dbHosts, authDb, dbUsername, dbPassword)
+
+	// Revoked tokens are only interesting until they would have expired
+	// anyway, so let the server clean them up.
+	idx_expiry := mgo.Index{
+		Key:         []string{"expiryDate"},
+		Background:  true,
+		ExpireAfter: time.Second,
+	}
+
+	err := mongoSession.DB(dbName).C(collections.RevokedTokens).EnsureIndex(idx_expiry)
+	if err != nil {
+		panic(err)
+	}
+
+	idx_jti := mgo.Index{
+		Key:        []string{"jti"},
+		Unique:     true,
+		DropDups:   true,
+		Background: true,
+	}
+
+	err = mongoSession.DB(dbName).C(collections.RevokedTokens).EnsureIndex(idx_jti)
+	if err != nil {
+		panic(err)
+	}
+
+	idx_user := mgo.Index{
+		Key:        []string{"userId"},
+		Unique:     true,
+		DropDups:   true,
+		Background: true,
+	}
+
+	err = mongoSession.DB(dbName).C(collections.RevokedUsers).EnsureIndex(idx_user)
+	if err != nil {
+		panic(err)
+	}
+
+	fmt.Println("Init revocation store done")
+
+	return &MongoRevocationStore{
+		db:          mongoSession,
+		dbName:      dbName,
+		collections: collections,
+	}
+}
+
+func (store *MongoRevocationStore) RevokeToken(ctx context.Context, jti string, expiryDate time.Time) (err error) {
+	socketConnection, err := copySession(ctx, store.db)
+	if err != nil {
+		return err
+	}
+	defer socketConnection.Close()
+
+	collection := socketConnection.DB(store.dbName).C(store.collections.RevokedTokens)
+
+	_, err = collection.Upsert(bson.M{"jti": jti}, &RevokedToken{Jti: jti, ExpiryDate: expiryDate})
+
+	return mongoError(err)
+}
+
+func (store *MongoRevocationStore) RevokeUserTokens(ctx context.Context, userId uuid.UUID, revokedDate time.Time) (err error) {
+	socketConnection, err := copySession(ctx, store.db)
+	if err != nil {
+		return err
+	}
+	defer socketConnection.Close()
+
+	collection := socketConnection.DB(store.dbName).C(store.collections.RevokedUsers)
+
+	_, err = collection.Upsert(bson.M{"userId": userId}, &RevokedUser{UserId: userId, RevokedDate: revokedDate})
+
+	return mongoError(err)
+}
+
+func (store *MongoRevocationStore) IsRevoked(ctx context.Context, jti string, userId uuid.UUID, issuedDate time.Time) (revoked bool, err error) {
+	socketConnection, err := copySession(ctx, store.db)
+	if err != nil {
+		return false, err
+	}
+	defer socketConnection.Close()
+
+	count, err := socketConnection.DB(store.dbName).C(store.collections.RevokedTokens).Find(bson.M{"jti": jti}).Count()
+	if err != nil {
+		return false, err
+	}
+
+	if count > 0 {
+		return true, nil
+	}
+
+	result := RevokedUser{}
+	err = socketConnection.DB(store.dbName).C(store.collections.RevokedUsers).Find(bson.M{"userId": userId}).One(&result)
+
+	if err == mgo.ErrNotFound {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	return issuedByRevocation(issuedDate, result.RevokedDate), nil
+}
+
+//=====================================================================================
+
+type SQLRevocationStore struct {
+	db      *sql.DB
+	dialect *sqlDialect
+}
+
+// NewSQLRevocationStore connects with a database/sql driver, postgres or
+// sqlite3, and migrates the schema, which it shares with SQLRepo.
+func NewSQLRevocationStore(driverName string, dataSource string) RevocationStore {
+	db, dialect := openSQL(driverName, dataSource)
+
+	fmt.Println("Init revocation store done")
+
+	return &SQLRevocationStore{
+		db:      db,
+		dialect: dialect,
+	}
+}
+
+// NewSQLRevocationStoreFromDB uses a database opened with OpenSQL, so the
+// revocations live alongside a SQLRepo built from the same database.
+func NewSQLRevocationStoreFromDB(db *sql.DB) RevocationStore {
+	return &SQLRevocationStore{
+		db:      db,
+		dialect: sqlDialectOf(db),
+	}
+}
+
+func (store *SQLRevocationStore) RevokeToken(ctx context.Context, jti string, expiryDate time.Time) (err error) {
+	// Revoked tokens are only interesting until they would have expired
+	// anyway.
+	_, err = store.db.ExecContext(ctx, store.dialect.rebind(`DELETE FROM revoked_tokens WHERE expiry_date < ?`), time.Now().UTC())
+	if err != nil {
+		return err
+	}
+
+	_, err = store.db.ExecContext(ctx, store.dialect.rebind(`INSERT INTO revoked_tokens (jti, expiry_date) VALUES (?, ?)
+		ON CONFLICT (jti) DO UPDATE SET expiry_date = excluded.expiry_date`), jti, expiryDate.UTC())
+
+	return err
+}
+
+func (store *SQLRevocationStore) RevokeUserTokens(ctx context.Context, userId uuid.UUID, revokedDate time.Time) (err error) {
+	_, err = store.db.ExecContext(ctx, store.dialect.rebind(`INSERT INTO revoked_users (user_id, revoked_date) VALUES (?, ?)
+		ON CONFLICT (user_id) DO UPDATE SET revoked_date = excluded.revoked_date`), userId, revokedDate.UTC())
+
+	return err
+}
+
+func (store *SQLRevocationStore) IsRevoked(ctx context.Context, jti string, userId uuid.UUID, issuedDate time.Time) (revoked bool, err error) {
+	var count int
+	err = store.db.QueryRowContext(ctx, store.dialect.rebind(`SELECT COUNT(*) FROM revoked_tokens WHERE jti = ?`), jti).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+
+	if count > 0 {
+		return true, nil
+	}
+
+	var revokedDate time.Time
+	err = store.db.QueryRowContext(ctx, store.dialect.rebind(`SELECT revoked_date FROM revoked_users WHERE user_id = ?`), userId).Scan(&revokedDate)
+
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	return issuedByRevocation(issuedDate, revokedDate), nil
+}
@@ -3,13 +3,21 @@
 package authenticator
 
 import (
+	"context"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	. "github.com/lukeatherton/domain-events"
 )
 
+var (
+	// Requests give up on the repo once RequestTimeout has passed, or as
+	// soon as the client disconnects.
+	RequestTimeout = time.Second * 10
+)
+
 func InitApiServices(publisher Publisher, repo Repo, auth Authenticator) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.Set("publisher", publisher)
@@ -19,38 +27,121 @@ func InitApiServices(publisher Publisher, repo Repo, auth Authenticator) gin.Han
 	}
 }
 
-func NewRouter(publisher Publisher, repo Repo, auth Authenticator) (router *gin.Engine) {
+func NewRouter(publisher Publisher, repo Repo, auth Authenticator, limits RateLimitStore) (router *gin.Engine) {
 	r := gin.Default()
 
 	gin.SetMode(gin.TestMode)
 
+	r.Use(RequestDeadline(RequestTimeout))
 	r.Use(InitApiServices(publisher, repo, auth))
+	r.Use(InitLoginThrottle(NewLoginThrottle(LoginThrottleLimit, LoginThrottleWindow)))
 
 	r.GET("/status", func(c *gin.Context) {
 		c.String(200, "OK")
 	})
 
+	r.GET("/.well-known/jwks.json", GetJSONWebKeySet)
+	r.GET("/.well-known/openid-configuration", GetOpenIDConfiguration)
+
+	r.GET("/authorize", Authorize)
+	r.POST("/authorize", RateLimit(limits, LoginIPRateLimit), AuthorizeLogin)
+
+	r.OPTIONS("/token", SendOptions("POST", false))
+	r.POST("/token", AllowOrigin("*"), RateLimit(limits, TokenRateLimit), Token)
+
+	r.OPTIONS("/userinfo", SendOptions("GET, POST", true))
+	r.GET("/userinfo", AllowOrigin("*"), Authorization(auth), GetUserInfo)
+	r.POST("/userinfo", AllowOrigin("*"), Authorization(auth), GetUserInfo)
+
 	api := r.Group("/api")
 	{
 		api.OPTIONS("/auth", SendOptions("POST", false))
-		api.POST("/auth", AllowOrigin("*"), Authenticate)
+		api.POST("/auth", AllowOrigin("*"), RateLimit(limits, LoginIPRateLimit, LoginEmailRateLimit), Authenticate)
+
+		api.OPTIONS("/auth/mfa", SendOptions("POST", false))
+		api.POST("/auth/mfa", AllowOrigin("*"), RateLimit(limits, MFARateLimit), CompleteMFA)
+
+		api.OPTIONS("/auth/links", SendOptions("POST", false))
+		api.POST("/auth/links", AllowOrigin("*"), RateLimit(limits, EmailMessageIPRateLimit, EmailMessageRateLimit), RequestLoginLink)
+
+		api.OPTIONS("/auth/links/redemptions", SendOptions("POST", false))
+		api.POST("/auth/links/redemptions", AllowOrigin("*"), RateLimit(limits, LoginCodeRateLimit), RedeemLoginLink)
+
+		api.OPTIONS("/webauthn/logins/begin", SendOptions("POST", false))
+		api.POST("/webauthn/logins/begin", AllowOrigin("*"), RateLimit(limits, LoginIPRateLimit), BeginWebAuthnLogin)
+
+		api.OPTIONS("/webauthn/logins/finish", SendOptions("POST", false))
+		api.POST("/webauthn/logins/finish", AllowOrigin("*"), RateLimit(limits, LoginIPRateLimit), FinishWebAuthnLogin)
+
+		api.OPTIONS("/tokens/refresh", SendOptions("POST", false))
+		api.POST("/tokens/refresh", AllowOrigin("*"), RateLimit(limits, TokenRateLimit), RefreshAuthToken)
+
+		api.OPTIONS("/tokens/revoke", SendOptions("POST", false))
+		api.POST("/tokens/revoke", AllowOrigin("*"), RateLimit(limits, TokenRateLimit), RevokeToken)
+
+		api.POST("/tokens/introspect", RateLimit(limits, TokenRateLimit), IntrospectToken)
 
 		api.OPTIONS("/emails", SendOptions("GET", false))
-		api.GET("/emails", AllowOrigin("*"), CheckEmail)
+		api.GET("/emails", AllowOrigin("*"), RateLimit(limits, EmailCheckRateLimit), CheckEmail)
+
+		api.OPTIONS("/emails/changerequests", SendOptions("POST", true))
+		api.POST("/emails/changerequests", AllowOrigin("*"), Authorization(auth), RateLimit(limits, EmailChangeRateLimit, EmailMessageRateLimit), RequestEmailChange)
+
+		api.OPTIONS("/emails/changes", SendOptions("POST", true))
+		api.POST("/emails/changes", AllowOrigin("*"), Authorization(auth), RateLimit(limits, EmailChangeRateLimit), ConfirmEmailChange)
 
 		api.OPTIONS("/registrations", SendOptions("POST", false))
-		api.POST("/registrations", AllowOrigin("*"), RegisterUser)
+		api.POST("/registrations", AllowOrigin("*"), RateLimit(limits, RegistrationRateLimit), RegisterUser)
 
 		api.OPTIONS("/verification", SendOptions("GET", true))
-		api.GET("/verification", AllowOrigin("*"), VerifyEmail)
+		api.GET("/verification", AllowOrigin("*"), RateLimit(limits, VerificationRateLimit), VerifyEmail)
+
+		api.OPTIONS("/verification/resends", SendOptions("POST", false))
+		api.POST("/verification/resends", AllowOrigin("*"), RateLimit(limits, EmailMessageIPRateLimit, VerificationResendRateLimit), ResendEmailVerification)
 
 		api.OPTIONS("/credentials/updaterequests", SendOptions("POST", true))
-		api.POST("/credentials/updaterequests", AllowOrigin("*"), Authorization(auth), ChangePassword)
+		api.POST("/credentials/updaterequests", AllowOrigin("*"), Authorization(auth), RateLimit(limits, PasswordChangeRateLimit), ChangePassword)
+
+		api.OPTIONS("/credentials/resetrequests", SendOptions("POST", false))
+		api.POST("/credentials/resetrequests", AllowOrigin("*"), RateLimit(limits, EmailMessageIPRateLimit, EmailMessageRateLimit), RequestPasswordReset)
+
+		api.OPTIONS("/credentials/resets", SendOptions("POST", false))
+		api.POST("/credentials/resets", AllowOrigin("*"), RateLimit(limits, PasswordResetRateLimit), ResetPassword)
+
+		api.OPTIONS("/mfa/totp", SendOptions("POST", true))
+		api.POST("/mfa/totp", AllowOrigin("*"), Authorization(auth), EnrollTOTP)
+
+		api.OPTIONS("/mfa/totp/confirm", SendOptions("POST", true))
+		api.POST("/mfa/totp/confirm", AllowOrigin("*"), Authorization(auth), RateLimit(limits, MFAEnrollmentRateLimit), ConfirmTOTP)
+
+		api.OPTIONS("/mfa/recoverycodes", SendOptions("POST", true))
+		api.POST("/mfa/recoverycodes", AllowOrigin("*"), Authorization(auth), RegenerateRecoveryCodes)
+
+		api.OPTIONS("/webauthn/registrations/begin", SendOptions("POST", true))
+		api.POST("/webauthn/registrations/begin", AllowOrigin("*"), Authorization(auth), BeginWebAuthnRegistration)
+
+		api.OPTIONS("/webauthn/registrations/finish", SendOptions("POST", true))
+		api.POST("/webauthn/registrations/finish", AllowOrigin("*"), Authorization(auth), FinishWebAuthnRegistration)
+
+		api.POST("/admin/unlocks", RateLimit(limits, TokenRateLimit), ClientAuthorization(auth, AdminScope), UnlockAccount)
 	}
 
 	return r
 }
 
+// RequestDeadline gives the request's context a deadline, which handlers
+// pass on to the Authenticator and Repo so a slow database cannot hold a
+// request open indefinitely.
+func RequestDeadline(timeout time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+		defer cancel()
+
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
+
 func SendOptions(methods string, isAuthRequired bool) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.Writer.Header().Add("Access-Control-Allow-Origin", "*")
@@ -96,20 +187,30 @@ func Authorization(auth Authenticator) gin.HandlerFunc {
 			return
 		}
 
-		if !auth.ValidateToken(authorizationArray[1]) {
+		if !auth.ValidateToken(c.Request.Context(), authorizationArray[1]) {
 			c.JSON(http.StatusUnauthorized, "authorization failed")
+			c.Abort()
 			return
 		}
 
 		// allow cross domain AJAX requests
 		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
 
+		// client credentials tokens carry no user and cannot act for one
 		id, _ := auth.GetTokenClaim(authorizationArray[1], "id")
+		if _, ok := id.(string); !ok {
+			c.JSON(http.StatusUnauthorized, "authorization failed")
+			c.Abort()
+			return
+		}
+
 		c.Set("userId", id)
 
 		email, _ := auth.GetTokenClaim(authorizationArray[1], "email")
 		c.Set("email", email)
 
+		c.Set("token", authorizationArray[1])
+
 		c.Next()
 	}
 }
@@ -0,0 +1,549 @@
+// Copyright (c) Luke Atherton 2015
+
+package authenticator
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/mattn/go-sqlite3"
+	"github.com/satori/go.uuid"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// A sqlDialect covers the differences between the databases SQLRepo
+// supports. Queries are written with ? placeholders.
+type sqlDialect struct {
+	numberedPlaceholders bool
+	columnTypes          *strings.Replacer
+	lockMigrations       string
+	maxOpenConns         int
+	isDuplicate          func(err error) bool
+}
+
+// sqlDialects is keyed by database/sql driver name.
+var sqlDialects = map[string]*sqlDialect{
+	"postgres": {
+		numberedPlaceholders: true,
+		columnTypes:          strings.NewReplacer("BLOB", "BYTEA", "TIMESTAMP", "TIMESTAMPTZ"),
+		lockMigrations:       "LOCK TABLE schema_migrations IN EXCLUSIVE MODE",
+		isDuplicate: func(err error) bool {
+			pqErr, ok := err.(*pq.Error)
+			return ok && pqErr.Code == "23505"
+		},
+	},
+	// SQLite allows one writer at a time, and every connection to :memory:
+	// opens a new empty database, so a single connection is shared.
+	"sqlite3": {
+		columnTypes:  strings.NewReplacer(),
+		maxOpenConns: 1,
+		isDuplicate: func(err error) bool {
+			sqliteErr, ok := err.(sqlite3.Error)
+			return ok && (sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique ||
+				sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey)
+		},
+	},
+}
+
+// rebind rewrites ? placeholders to $1, $2... for databases that number them.
+func (dialect *sqlDialect) rebind(query string) string {
+	if !dialect.numberedPlaceholders {
+		return query
+	}
+
+	var builder strings.Builder
+	n := 0
+
+	for _, r := range query {
+		if r == '?' {
+			n++
+			fmt.Fprintf(&builder, "$%d", n)
+			continue
+		}
+
+		builder.WriteRune(r)
+	}
+
+	return builder.String()
+}
+
+// OpenSQL connects with a database/sql driver, postgres or sqlite3, and
+// brings the schema up to date. The database can then be shared by
+// NewSQLRepoFromDB and NewSQLRevocationStoreFromDB.
+func OpenSQL(driverName string, dataSource string) *sql.DB {
+	db, _ := openSQL(driverName, dataSource)
+	return db
+}
+
+// openSQL connects to the database and brings its schema up to date.
+func openSQL(driverName string, dataSource string) (*sql.DB, *sqlDialect) {
+	dialect, ok := sqlDialects[driverName]
+	if !ok {
+		log.Fatalf("CreateSession: unsupported database driver %s\n", driverName)
+	}
+
+	fmt.Printf("Connecting to %s database\n", driverName)
+
+	db, err := sql.Open(driverName, dataSource)
+	if err != nil {
+		log.Fatalf("CreateSession: %s\n", err)
+	}
+
+	if dialect.maxOpenConns > 0 {
+		db.SetMaxOpenConns(dialect.maxOpenConns)
+	}
+
+	if err := db.Ping(); err != nil {
+		log.Fatalf("CreateSession: %s\n", err)
+	}
+
+	if err := migrateSQL(db, dialect); err != nil {
+		log.Fatalf("Migrate: %s\n", err)
+	}
+
+	return db, dialect
+}
+
+// sqlDialectOf returns the dialect for the driver the database was opened
+// with.
+func sqlDialectOf(db *sql.DB) *sqlDialect {
+	switch db.Driver().(type) {
+	case *pq.Driver:
+		return sqlDialects["postgres"]
+	case *sqlite3.SQLiteDriver:
+		return sqlDialects["sqlite3"]
+	}
+
+	log.Fatalf("CreateSession: unsupported database driver %T\n", db.Driver())
+	return nil
+}
+
+// sqlError maps database errors to the errors the Repo interface promises.
+func sqlError(dialect *sqlDialect, err error) error {
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
+
+	if err != nil && dialect.isDuplicate(err) {
+		return ErrDuplicateKey
+	}
+
+	return err
+}
+
+func encodeStrings(values []string) string {
+	data, _ := json.Marshal(values)
+	return string(data)
+}
+
+func decodeStrings(data string) []string {
+	var values []string
+	json.Unmarshal([]byte(data), &values)
+	return values
+}
+
+//=====================================================================================
+
+// A SQLRepo stores everything in PostgreSQL or SQLite through database/sql.
+// The unique constraints match the MongoDBRepo indexes, except that emails
+// are unique regardless of case.
+type SQLRepo struct {
+	db      *sql.DB
+	dialect *sqlDialect
+	isTest  bool
+}
+
+// NewSQLRepo connects with a database/sql driver, postgres or sqlite3, and
+// migrates the schema. For sqlite3 the data source is a file path, or
+// :memory: for a database that only lasts as long as the repo.
+func NewSQLRepo(driverName string, dataSource string) Repo {
+	db, dialect := openSQL(driverName, dataSource)
+
+	fmt.Println("Init app db done")
+
+	return &SQLRepo{
+		db:      db,
+		dialect: dialect,
+	}
+}
+
+// NewSQLRepoFromDB uses a database opened with OpenSQL, which is already
+// migrated.
+func NewSQLRepoFromDB(db *sql.DB) Repo {
+	return &SQLRepo{
+		db:      db,
+		dialect: sqlDialectOf(db),
+	}
+}
+
+// NewSQLTestRepo is NewSQLRepo for tests, the repo it returns can be
+// emptied with Cleanup.
+func NewSQLTestRepo(driverName string, dataSource string) TestRepo {
+	db, dialect := openSQL(driverName, dataSource)
+
+	fmt.Println("Init test db done")
+
+	return &SQLRepo{
+		db:      db,
+		dialect: dialect,
+		isTest:  true,
+	}
+}
+
+func (repo *SQLRepo) exec(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	result, err := repo.db.ExecContext(ctx, repo.dialect.rebind(query), args...)
+	return result, sqlError(repo.dialect, err)
+}
+
+func (repo *SQLRepo) queryRow(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return repo.db.QueryRowContext(ctx, repo.dialect.rebind(query), args...)
+}
+
+// Cleanup removes everything from a test repo, leaving the schema in place.
+// Any other repo panics instead, so production data can never be removed.
+func (repo *SQLRepo) Cleanup() {
+	if !repo.isTest {
+		panic("Cleanup is only allowed on test repos")
+	}
+
+	tables := []string{"credentials", "webauthn_credentials", "refresh_tokens", "clients",
+		"authorization_codes", "password_resets", "login_links"}
+
+	for _, table := range tables {
+		if _, err := repo.exec(context.Background(), "DELETE FROM "+table); err != nil {
+			panic(err)
+		}
+	}
+
+	fmt.Println("Database Cleared")
+}
+
+// SaveCredentials inserts new credentials, or replaces saved ones whose
+// version still matches, along with the WebAuthn credentials they hold,
+// which are indexed in their own table.
+func (repo *SQLRepo) SaveCredentials(ctx context.Context, userId uuid.UUID, credentials *Credentials) (err error) {
+	saved := *credentials
+	saved.Version++
+
+	data, err := bson.Marshal(&saved)
+	if err != nil {
+		return err
+	}
+
+	tx, err := repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var result sql.Result
+	if credentials.Version == 0 {
+		result, err = tx.ExecContext(ctx, repo.dialect.rebind(`INSERT INTO credentials (id, email, data, version) VALUES (?, ?, ?, ?)
+			ON CONFLICT (id) DO UPDATE SET email = excluded.email, data = excluded.data, version = excluded.version
+			WHERE credentials.version = 0`),
+			userId, saved.Email, data, saved.Version)
+	} else {
+		result, err = tx.ExecContext(ctx, repo.dialect.rebind(`UPDATE credentials SET email = ?, data = ?, version = ?
+			WHERE id = ? AND version = ?`),
+			saved.Email, data, saved.Version, userId, credentials.Version)
+	}
+
+	if err != nil {
+		// The id is never inserted twice, so only the email can be a
+		// duplicate here.
+		if err = sqlError(repo.dialect, err); err == ErrDuplicateKey {
+			return ErrDuplicateEmail
+		}
+
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return ErrConflict
+	}
+
+	_, err = tx.ExecContext(ctx, repo.dialect.rebind(`DELETE FROM webauthn_credentials WHERE user_id = ?`), userId)
+	if err != nil {
+		return err
+	}
+
+	for _, webAuthnCredential := range credentials.WebAuthnCredentials {
+		_, err = tx.ExecContext(ctx, repo.dialect.rebind(`INSERT INTO webauthn_credentials (credential_id, user_id) VALUES (?, ?)`),
+			webAuthnCredential.CredentialId, userId)
+		if err != nil {
+			return sqlError(repo.dialect, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	credentials.Version = saved.Version
+
+	return nil
+}
+
+func (repo *SQLRepo) GetCredentials(ctx context.Context, userId uuid.UUID) (credentials *Credentials, err error) {
+	result := &Credentials{}
+
+	var data []byte
+	if err := repo.queryRow(ctx, `SELECT data FROM credentials WHERE id = ?`, userId).Scan(&data); err != nil {
+		return result, sqlError(repo.dialect, err)
+	}
+
+	return result, bson.Unmarshal(data, result)
+}
+
+func (repo *SQLRepo) FindEmail(ctx context.Context, email string) (id uuid.UUID, err error) {
+	err = repo.queryRow(ctx, `SELECT id FROM credentials WHERE lower(email) = lower(?)`, email).Scan(&id)
+
+	return id, sqlError(repo.dialect, err)
+}
+
+func (repo *SQLRepo) FindWebAuthnCredential(ctx context.Context, credentialId []byte) (id uuid.UUID, err error) {
+	err = repo.queryRow(ctx, `SELECT user_id FROM webauthn_credentials WHERE credential_id = ?`, credentialId).Scan(&id)
+
+	return id, sqlError(repo.dialect, err)
+}
+
+func (repo *SQLRepo) SaveRefreshToken(ctx context.Context, token *RefreshToken) (err error) {
+	_, err = repo.exec(ctx, `INSERT INTO refresh_tokens (id, family_id, user_id, token_hash, is_used, is_revoked, amr, created_date, expiry_date)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET family_id = excluded.family_id, user_id = excluded.user_id,
+			token_hash = excluded.token_hash, is_used = excluded.is_used, is_revoked = excluded.is_revoked,
+			amr = excluded.amr, created_date = excluded.created_date, expiry_date = excluded.expiry_date`,
+		token.Id, token.FamilyId, token.UserId, token.TokenHash, token.IsUsed, token.IsRevoked,
+		encodeStrings(token.Amr), token.CreatedDate.UTC(), token.ExpiryDate.UTC())
+
+	return err
+}
+
+func (repo *SQLRepo) GetRefreshToken(ctx context.Context, tokenHash string) (token *RefreshToken, err error) {
+	result := &RefreshToken{}
+
+	var amr string
+	err = repo.queryRow(ctx, `SELECT id, family_id, user_id, token_hash, is_used, is_revoked, amr, created_date, expiry_date
+		FROM refresh_tokens WHERE token_hash = ?`, tokenHash).Scan(
+		&result.Id, &result.FamilyId, &result.UserId, &result.TokenHash, &result.IsUsed, &result.IsRevoked,
+		&amr, &result.CreatedDate, &result.ExpiryDate)
+	if err != nil {
+		return result, sqlError(repo.dialect, err)
+	}
+
+	result.Amr = decodeStrings(amr)
+
+	return result, nil
+}
+
+// ConsumeRefreshToken marks a refresh token as used and returns the token as
+// it was before the update, so callers can tell whether it had already been
+// used.
+func (repo *SQLRepo) ConsumeRefreshToken(ctx context.Context, tokenHash string) (token *RefreshToken, err error) {
+	result, err := repo.GetRefreshToken(ctx, tokenHash)
+	if err != nil {
+		return result, err
+	}
+
+	// Only one caller can flip is_used, whoever loses the race sees the
+	// token as already used.
+	update, err := repo.exec(ctx, `UPDATE refresh_tokens SET is_used = ? WHERE token_hash = ? AND is_used = ?`, true, tokenHash, false)
+	if err != nil {
+		return result, err
+	}
+
+	affected, err := update.RowsAffected()
+	if err != nil {
+		return result, err
+	}
+
+	result.IsUsed = affected == 0
+
+	return result, nil
+}
+
+func (repo *SQLRepo) RevokeRefreshTokenFamily(ctx context.Context, familyId uuid.UUID) (err error) {
+	_, err = repo.exec(ctx, `UPDATE refresh_tokens SET is_revoked = ? WHERE family_id = ?`, true, familyId)
+
+	return err
+}
+
+func (repo *SQLRepo) RevokeUserRefreshTokens(ctx context.Context, userId uuid.UUID) (err error) {
+	_, err = repo.exec(ctx, `UPDATE refresh_tokens SET is_revoked = ? WHERE user_id = ?`, true, userId)
+
+	return err
+}
+
+func (repo *SQLRepo) SaveClient(ctx context.Context, client *Client) (err error) {
+	_, err = repo.exec(ctx, `INSERT INTO clients (client_id, name, redirect_uris, secret_salt, secret_key, scopes, created_date)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (client_id) DO UPDATE SET name = excluded.name, redirect_uris = excluded.redirect_uris,
+			secret_salt = excluded.secret_salt, secret_key = excluded.secret_key, scopes = excluded.scopes,
+			created_date = excluded.created_date`,
+		client.ClientId, client.Name, encodeStrings(client.RedirectUris), client.SecretSalt, client.SecretKey,
+		encodeStrings(client.Scopes), client.CreatedDate.UTC())
+
+	return err
+}
+
+func (repo *SQLRepo) GetClient(ctx context.Context, clientId string) (client *Client, err error) {
+	result := &Client{}
+
+	var redirectUris, scopes string
+	err = repo.queryRow(ctx, `SELECT client_id, name, redirect_uris, secret_salt, secret_key, scopes, created_date
+		FROM clients WHERE client_id = ?`, clientId).Scan(
+		&result.ClientId, &result.Name, &redirectUris, &result.SecretSalt, &result.SecretKey, &scopes, &result.CreatedDate)
+	if err != nil {
+		return result, sqlError(repo.dialect, err)
+	}
+
+	result.RedirectUris = decodeStrings(redirectUris)
+	result.Scopes = decodeStrings(scopes)
+
+	return result, nil
+}
+
+// SaveAuthorizationCode inserts a new code. There is no TTL index to remove
+// codes that were never redeemed, so expired ones are cleared out first.
+func (repo *SQLRepo) SaveAuthorizationCode(ctx context.Context, code *AuthorizationCode) (err error) {
+	if _, err := repo.exec(ctx, `DELETE FROM authorization_codes WHERE expiry_date < ?`, time.Now().UTC()); err != nil {
+		return err
+	}
+
+	_, err = repo.exec(ctx, `INSERT INTO authorization_codes (code_hash, client_id, user_id, redirect_uri, scope, nonce,
+			code_challenge, code_challenge_method, auth_time, amr, expiry_date)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		code.CodeHash, code.ClientId, code.UserId, code.RedirectUri, code.Scope, code.Nonce,
+		code.CodeChallenge, code.CodeChallengeMethod, code.AuthTime.UTC(), encodeStrings(code.Amr), code.ExpiryDate.UTC())
+
+	return err
+}
+
+// ConsumeAuthorizationCode removes an authorization code and returns it, so
+// a code can only ever be redeemed once.
+func (repo *SQLRepo) ConsumeAuthorizationCode(ctx context.Context, codeHash string) (code *AuthorizationCode, err error) {
+	result := &AuthorizationCode{}
+
+	var amr string
+	err = repo.queryRow(ctx, `DELETE FROM authorization_codes WHERE code_hash = ?
+		RETURNING code_hash, client_id, user_id, redirect_uri, scope, nonce,
+			code_challenge, code_challenge_method, auth_time, amr, expiry_date`, codeHash).Scan(
+		&result.CodeHash, &result.ClientId, &result.UserId, &result.RedirectUri, &result.Scope, &result.Nonce,
+		&result.CodeChallenge, &result.CodeChallengeMethod, &result.AuthTime, &amr, &result.ExpiryDate)
+	if err != nil {
+		return result, sqlError(repo.dialect, err)
+	}
+
+	result.Amr = decodeStrings(amr)
+
+	return result, nil
+}
+
+// SavePasswordReset stores a reset, replacing any reset already outstanding
+// for the same user. Expired resets are cleared out first.
+func (repo *SQLRepo) SavePasswordReset(ctx context.Context, reset *PasswordReset) (err error) {
+	if _, err := repo.exec(ctx, `DELETE FROM password_resets WHERE expiry_date < ?`, time.Now().UTC()); err != nil {
+		return err
+	}
+
+	_, err = repo.exec(ctx, `INSERT INTO password_resets (user_id, token_hash, created_date, expiry_date) VALUES (?, ?, ?, ?)
+		ON CONFLICT (user_id) DO UPDATE SET token_hash = excluded.token_hash,
+			created_date = excluded.created_date, expiry_date = excluded.expiry_date`,
+		reset.UserId, reset.TokenHash, reset.CreatedDate.UTC(), reset.ExpiryDate.UTC())
+
+	return err
+}
+
+// ConsumePasswordReset removes a reset and returns it, so a reset token can
+// only ever be used once.
+func (repo *SQLRepo) ConsumePasswordReset(ctx context.Context, tokenHash string) (reset *PasswordReset, err error) {
+	result := &PasswordReset{}
+
+	err = repo.queryRow(ctx, `DELETE FROM password_resets WHERE token_hash = ?
+		RETURNING user_id, token_hash, created_date, expiry_date`, tokenHash).Scan(
+		&result.UserId, &result.TokenHash, &result.CreatedDate, &result.ExpiryDate)
+
+	return result, sqlError(repo.dialect, err)
+}
+
+// RestorePasswordReset puts back a consumed reset, unless the user has
+// requested another one since.
+func (repo *SQLRepo) RestorePasswordReset(ctx context.Context, reset *PasswordReset) (err error) {
+	_, err = repo.exec(ctx, `INSERT INTO password_resets (user_id, token_hash, created_date, expiry_date) VALUES (?, ?, ?, ?)
+		ON CONFLICT (user_id) DO NOTHING`,
+		reset.UserId, reset.TokenHash, reset.CreatedDate.UTC(), reset.ExpiryDate.UTC())
+
+	return sqlError(repo.dialect, err)
+}
+
+// SaveLoginLink stores a login link, replacing any link already outstanding
+// for the same user. Expired links are cleared out first.
+func (repo *SQLRepo) SaveLoginLink(ctx context.Context, link *LoginLink) (err error) {
+	if _, err := repo.exec(ctx, `DELETE FROM login_links WHERE expiry_date < ?`, time.Now().UTC()); err != nil {
+		return err
+	}
+
+	_, err = repo.exec(ctx, `INSERT INTO login_links (user_id, token_id, code_hash, failed_attempts, created_date, expiry_date)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (user_id) DO UPDATE SET token_id = excluded.token_id, code_hash = excluded.code_hash,
+			failed_attempts = excluded.failed_attempts, created_date = excluded.created_date,
+			expiry_date = excluded.expiry_date`,
+		link.UserId, link.TokenId, link.CodeHash, link.FailedAttempts, link.CreatedDate.UTC(), link.ExpiryDate.UTC())
+
+	return err
+}
+
+func (repo *SQLRepo) GetLoginLink(ctx context.Context, userId uuid.UUID) (link *LoginLink, err error) {
+	result := &LoginLink{}
+
+	err = scanLoginLink(repo.queryRow(ctx, `SELECT user_id, token_id, code_hash, failed_attempts, created_date, expiry_date
+		FROM login_links WHERE user_id = ?`, userId), result)
+
+	return result, sqlError(repo.dialect, err)
+}
+
+// ConsumeLoginLink removes a login link and returns it. The token id must
+// match, so a link that has been replaced can no longer be used.
+func (repo *SQLRepo) ConsumeLoginLink(ctx context.Context, userId uuid.UUID, tokenId string) (link *LoginLink, err error) {
+	result := &LoginLink{}
+
+	err = scanLoginLink(repo.queryRow(ctx, `DELETE FROM login_links WHERE user_id = ? AND token_id = ?
+		RETURNING user_id, token_id, code_hash, failed_attempts, created_date, expiry_date`, userId, tokenId), result)
+
+	return result, sqlError(repo.dialect, err)
+}
+
+// RecordLoginCodeFailure counts a wrong code against a login link, and
+// removes the link once it has had maxAttempts. The token id must match, so
+// failures against a link that has been replaced are not counted.
+func (repo *SQLRepo) RecordLoginCodeFailure(ctx context.Context, userId uuid.UUID, tokenId string, maxAttempts int) (err error) {
+	result, err := repo.exec(ctx, `UPDATE login_links SET failed_attempts = failed_attempts + 1
+		WHERE user_id = ? AND token_id = ?`, userId, tokenId)
+	if err != nil {
+		return err
+	}
+
+	if updated, err := result.RowsAffected(); err != nil || updated == 0 {
+		return sqlError(repo.dialect, sql.ErrNoRows)
+	}
+
+	_, err = repo.exec(ctx, `DELETE FROM login_links WHERE user_id = ? AND token_id = ? AND failed_attempts >= ?`,
+		userId, tokenId, maxAttempts)
+
+	return err
+}
+
+func scanLoginLink(row *sql.Row, link *LoginLink) error {
+	return row.Scan(&link.UserId, &link.TokenId, &link.CodeHash, &link.FailedAttempts, &link.CreatedDate, &link.ExpiryDate)
+}
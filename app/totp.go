@@ -0,0 +1,117 @@
+// Copyright (c) Luke Atherton 2015
+
+package authenticator
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var (
+	TOTPSecretLength = 20
+	TOTPDigits       = 6
+	TOTPPeriod       = 30 * time.Second
+	// TOTPSkew is the number of periods either side of the current one in
+	// which a code is still accepted, to allow for clock drift.
+	TOTPSkew = 1
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// generateTOTPSecret returns a random base32 encoded secret as used in
+// otpauth URIs.
+func generateTOTPSecret() (string, error) {
+	secret, err := generateSalt(TOTPSecretLength)
+	if err != nil {
+		return "", err
+	}
+
+	return totpEncoding.EncodeToString(secret), nil
+}
+
+// TOTPUri builds the otpauth URI authenticator apps read from a QR code.
+func TOTPUri(issuer string, accountName string, secret string) string {
+	label := url.PathEscape(issuer) + ":" + url.PathEscape(accountName)
+
+	params := url.Values{
+		"secret":    {secret},
+		"issuer":    {issuer},
+		"algorithm": {"SHA1"},
+		"digits":    {fmt.Sprintf("%d", TOTPDigits)},
+		"period":    {fmt.Sprintf("%d", int(TOTPPeriod/time.Second))},
+	}
+
+	return "otpauth://totp/" + label + "?" + params.Encode()
+}
+
+// GenerateTOTPCode returns the code for the secret at the given time, as
+// described in RFC 6238.
+func GenerateTOTPCode(secret string, at time.Time) (string, error) {
+	key, err := decodeTOTPSecret(secret)
+	if err != nil {
+		return "", err
+	}
+
+	return totpCode(key, totpCounter(at)), nil
+}
+
+// verifyTOTPCode checks the code against the periods around now. Codes from
+// a period at or before lastCounter have already been used and are rejected,
+// so each code can only be used once. The matched period is returned so the
+// caller can record it.
+func verifyTOTPCode(secret string, code string, at time.Time, lastCounter int64) (int64, bool) {
+	key, err := decodeTOTPSecret(secret)
+	if err != nil || len(code) != TOTPDigits {
+		return 0, false
+	}
+
+	current := totpCounter(at)
+
+	for offset := -TOTPSkew; offset <= TOTPSkew; offset++ {
+		counter := int64(current) + int64(offset)
+		if counter <= lastCounter {
+			continue
+		}
+
+		if subtle.ConstantTimeCompare([]byte(totpCode(key, uint64(counter))), []byte(code)) == 1 {
+			return counter, true
+		}
+	}
+
+	return 0, false
+}
+
+func totpCounter(at time.Time) uint64 {
+	return uint64(at.Unix() / int64(TOTPPeriod/time.Second))
+}
+
+// totpCode computes the HOTP value for the counter, see RFC 4226.
+func totpCode(key []byte, counter uint64) string {
+	message := make([]byte, 8)
+	binary.BigEndian.PutUint64(message, counter)
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(message)
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	modulus := uint32(1)
+	for i := 0; i < TOTPDigits; i++ {
+		modulus *= 10
+	}
+
+	return fmt.Sprintf("%0*d", TOTPDigits, value%modulus)
+}
+
+func decodeTOTPSecret(secret string) ([]byte, error) {
+	return totpEncoding.DecodeString(strings.ToUpper(strings.TrimRight(secret, "=")))
+}
@@ -0,0 +1,128 @@
+// Copyright (c) Luke Atherton 2015
+
+package authenticator
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	. "github.com/lukeatherton/domain-events"
+	"github.com/satori/go.uuid"
+)
+
+var (
+	EmailVerificationLifetime   = time.Hour * 24
+	EmailVerificationCodeLength = 32
+)
+
+var (
+	ErrInvalidVerificationCode = errors.New("Verification Failed: Invalid or expired verification code.")
+)
+
+// IssueEmailVerificationCode replaces any outstanding email verification
+// code with a new one, good for EmailVerificationLifetime. Only a hash of the
+// code is kept.
+func (credentials *Credentials) IssueEmailVerificationCode() (string, error) {
+	code, err := generateOpaqueToken(EmailVerificationCodeLength)
+	if err != nil {
+		return "", err
+	}
+
+	credentials.VerificationCodeHash = hashOpaqueToken(code)
+	credentials.VerificationExpiry = time.Now().Add(EmailVerificationLifetime)
+	credentials.LegacyVerification = ""
+
+	return code, nil
+}
+
+// checkEmailVerificationCode reports whether the code is the outstanding one
+// and has not expired. A plain text code mailed before codes were hashed is
+// accepted until it is used or replaced, since it was sent without an expiry.
+func (credentials *Credentials) checkEmailVerificationCode(code string, now time.Time) bool {
+	if credentials.VerificationCodeHash == "" && credentials.LegacyVerification != "" {
+		return subtle.ConstantTimeCompare([]byte(code), []byte(credentials.LegacyVerification)) == 1
+	}
+
+	if credentials.VerificationCodeHash == "" || now.After(credentials.VerificationExpiry) {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(hashOpaqueToken(code)), []byte(credentials.VerificationCodeHash)) == 1
+}
+
+// confirmEmail marks the email as verified and clears the verification code.
+func (credentials *Credentials) confirmEmail(now time.Time) {
+	credentials.IsEmailVerified = true
+	credentials.VerificationCodeHash = ""
+	credentials.VerificationExpiry = time.Time{}
+	credentials.LegacyVerification = ""
+	credentials.ConfirmedDate = now
+}
+
+// ResendEmailVerification issues a new verification code for the user with
+// the given email, replacing the one sent before. Unknown and already
+// verified emails are not an error; userId is uuid.Nil instead.
+func (auth *TokenAuthenticator) ResendEmailVerification(ctx context.Context, email string) (uuid.UUID, string, error) {
+	userId, _ := auth.repo.FindEmail(ctx, email)
+	if userId == uuid.Nil {
+		return uuid.Nil, "", nil
+	}
+
+	credentials, err := auth.repo.GetCredentials(ctx, userId)
+	if err != nil || credentials.IsEmailVerified {
+		return uuid.Nil, "", err
+	}
+
+	var code string
+
+	_, err = UpdateCredentials(ctx, auth.repo, credentials, func(credentials *Credentials) error {
+		var err error
+		code, err = credentials.IssueEmailVerificationCode()
+
+		return err
+	})
+
+	if err != nil {
+		return uuid.Nil, "", err
+	}
+
+	return userId, code, nil
+}
+
+// Sends a new email verification code. The response is the same whether or
+// not the email is registered or already verified, the code only goes out in
+// the published event.
+func ResendEmailVerification(c *gin.Context) {
+	auth := c.MustGet("auth").(Authenticator)
+	publisher := c.MustGet("publisher").(Publisher)
+
+	c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
+
+	var view *VerificationResendView
+	c.Bind(&view)
+
+	if view == nil || view.Email == "" {
+		c.JSON(http.StatusBadRequest, NewError(ErrCodeValueRequired, "email is a required field"))
+		return
+	}
+
+	email := strings.ToLower(view.Email)
+
+	userId, code, err := auth.ResendEmailVerification(c.Request.Context(), email)
+	if err != nil {
+		fmt.Printf("ERROR: %v\n", err.Error())
+	}
+
+	if userId != uuid.Nil && code != "" {
+		go publisher.PublishMessage(NewEmailVerificationPendingEvent(userId, email, code, uuid.Nil))
+	}
+
+	c.JSON(http.StatusAccepted, "verification email requested")
+	return
+}
@@ -0,0 +1,661 @@
+// Copyright (c) Luke Atherton 2015
+
+package authenticator
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/satori/go.uuid"
+)
+
+var (
+	// The relying party id and origins default to the host and origin of the
+	// issuer. Set them when the login page is served from another origin.
+	WebAuthnRelyingPartyId   = ""
+	WebAuthnRelyingPartyName = "Authenticator"
+	WebAuthnOrigins          = []string{}
+
+	WebAuthnTimeout         = time.Minute * 5
+	WebAuthnChallengeLength = 32
+)
+
+// Authentication method reference for proof of possession of a key.
+const (
+	AmrHardwareKey = "hwk"
+)
+
+var (
+	ErrInvalidWebAuthnSession    = errors.New("WebAuthn Failed: Invalid or expired session.")
+	ErrInvalidWebAuthnResponse   = errors.New("WebAuthn Failed: Invalid authenticator response.")
+	ErrWebAuthnCredentialInUse   = errors.New("WebAuthn Failed: Credential is already registered.")
+	ErrUnknownWebAuthnCredential = errors.New("WebAuthn Failed: Unknown credential.")
+)
+
+const (
+	webAuthnCreate = "webauthn.create"
+	webAuthnGet    = "webauthn.get"
+)
+
+// BeginWebAuthnRegistration returns the options to pass to
+// navigator.credentials.create() for registering a new passkey.
+func (auth *TokenAuthenticator) BeginWebAuthnRegistration(ctx context.Context, userId uuid.UUID) (*WebAuthnCreationResponse, error) {
+	credentials, err := auth.repo.GetCredentials(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	sessionToken, challenge, err := auth.issueWebAuthnSession(webAuthnCreate, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	options := &WebAuthnCreationOptions{
+		Challenge: challenge,
+		RelyingParty: WebAuthnRelyingParty{
+			Id:   auth.webAuthnRelyingPartyId(),
+			Name: WebAuthnRelyingPartyName,
+		},
+		User: WebAuthnUser{
+			Id:          encodeWebAuthn(userId.Bytes()),
+			Name:        credentials.Email,
+			DisplayName: credentials.Email,
+		},
+		PubKeyCredParams: []WebAuthnCredentialParameter{
+			{Type: "public-key", Alg: coseAlgES256},
+			{Type: "public-key", Alg: coseAlgEdDSA},
+			{Type: "public-key", Alg: coseAlgRS256},
+		},
+		Timeout:            int64(WebAuthnTimeout / time.Millisecond),
+		Attestation:        "direct",
+		ExcludeCredentials: webAuthnDescriptors(credentials),
+		AuthenticatorSelection: WebAuthnAuthenticatorSelection{
+			ResidentKey:      "preferred",
+			UserVerification: "required",
+		},
+	}
+
+	return &WebAuthnCreationResponse{SessionToken: sessionToken, PublicKey: options}, nil
+}
+
+// FinishWebAuthnRegistration verifies the authenticator's attestation and
+// stores the new credential on the user's record.
+func (auth *TokenAuthenticator) FinishWebAuthnRegistration(ctx context.Context, userId uuid.UUID, view *WebAuthnRegistrationView) error {
+	challenge, sessionUserId, err := auth.consumeWebAuthnSession(ctx, view.SessionToken, webAuthnCreate)
+	if err != nil {
+		return err
+	}
+
+	if sessionUserId != userId {
+		return ErrInvalidWebAuthnSession
+	}
+
+	clientDataJSON, err := auth.verifyClientData(view.Credential.Response.ClientDataJSON, webAuthnCreate, challenge)
+	if err != nil {
+		return err
+	}
+
+	attestationObject, err := decodeWebAuthn(view.Credential.Response.AttestationObject)
+	if err != nil {
+		return ErrInvalidWebAuthnResponse
+	}
+
+	var attestation struct {
+		Format   string          `cbor:"fmt"`
+		AttStmt  cbor.RawMessage `cbor:"attStmt"`
+		AuthData []byte          `cbor:"authData"`
+	}
+
+	if err := cbor.Unmarshal(attestationObject, &attestation); err != nil {
+		return ErrInvalidWebAuthnResponse
+	}
+
+	authData, err := auth.verifyAuthenticatorData(attestation.AuthData)
+	if err != nil {
+		return err
+	}
+
+	if authData.CredentialId == nil {
+		return ErrInvalidWebAuthnResponse
+	}
+
+	publicKey, err := parseCOSEKey(authData.CredentialPublicKey)
+	if err != nil {
+		return ErrInvalidWebAuthnResponse
+	}
+
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	if err := verifyAttestation(attestation.Format, attestation.AttStmt, attestation.AuthData, clientDataHash[:], publicKey, authData.AAGUID); err != nil {
+		return err
+	}
+
+	if existingUserId, _ := auth.repo.FindWebAuthnCredential(ctx, authData.CredentialId); existingUserId != uuid.Nil {
+		return ErrWebAuthnCredentialInUse
+	}
+
+	credentials, err := auth.repo.GetCredentials(ctx, userId)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+
+	_, err = UpdateCredentials(ctx, auth.repo, credentials, func(credentials *Credentials) error {
+		credentials.WebAuthnCredentials = append(credentials.WebAuthnCredentials, &WebAuthnCredential{
+			CredentialId:      authData.CredentialId,
+			PublicKey:         authData.CredentialPublicKey,
+			SignCount:         authData.SignCount,
+			AAGUID:            authData.AAGUID,
+			AttestationFormat: attestation.Format,
+			Name:              view.Name,
+			CreatedDate:       now,
+			LastUsedDate:      now,
+		})
+
+		return nil
+	})
+
+	return err
+}
+
+// BeginWebAuthnLogin returns the options to pass to
+// navigator.credentials.get(). Without an email any discoverable credential
+// may be used. An unknown email gets the same response as one without
+// registered credentials.
+func (auth *TokenAuthenticator) BeginWebAuthnLogin(ctx context.Context, email string) (*WebAuthnRequestResponse, error) {
+	userId := uuid.Nil
+	allowCredentials := []WebAuthnCredentialDescriptor{}
+
+	if email != "" {
+		userId, _ = auth.repo.FindEmail(ctx, email)
+	}
+
+	if userId != uuid.Nil {
+		credentials, err := auth.repo.GetCredentials(ctx, userId)
+		if err != nil {
+			return nil, err
+		}
+
+		allowCredentials = webAuthnDescriptors(credentials)
+	}
+
+	sessionToken, challenge, err := auth.issueWebAuthnSession(webAuthnGet, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	options := &WebAuthnRequestOptions{
+		Challenge:        challenge,
+		RelyingPartyId:   auth.webAuthnRelyingPartyId(),
+		Timeout:          int64(WebAuthnTimeout / time.Millisecond),
+		AllowCredentials: allowCredentials,
+		UserVerification: "required",
+	}
+
+	return &WebAuthnRequestResponse{SessionToken: sessionToken, PublicKey: options}, nil
+}
+
+// FinishWebAuthnLogin verifies an assertion and issues the same access token
+// as Authenticate. User verification is required, so the passkey counts as
+// multiple factors on its own.
+func (auth *TokenAuthenticator) FinishWebAuthnLogin(ctx context.Context, view *WebAuthnLoginView) (string, error) {
+	challenge, sessionUserId, err := auth.consumeWebAuthnSession(ctx, view.SessionToken, webAuthnGet)
+	if err != nil {
+		return "", err
+	}
+
+	credentialId, err := decodeWebAuthn(view.Credential.RawId)
+	if err != nil || len(credentialId) == 0 {
+		return "", ErrUnknownWebAuthnCredential
+	}
+
+	userId, _ := auth.repo.FindWebAuthnCredential(ctx, credentialId)
+	if userId == uuid.Nil || (sessionUserId != uuid.Nil && sessionUserId != userId) {
+		return "", ErrUnknownWebAuthnCredential
+	}
+
+	if view.Credential.Response.UserHandle != "" {
+		userHandle, err := decodeWebAuthn(view.Credential.Response.UserHandle)
+		if err != nil || !bytes.Equal(userHandle, userId.Bytes()) {
+			return "", ErrUnknownWebAuthnCredential
+		}
+	}
+
+	credentials, err := auth.repo.GetCredentials(ctx, userId)
+	if err != nil {
+		return "", err
+	}
+
+	stored := findWebAuthnCredential(credentials, credentialId)
+	if stored == nil {
+		return "", ErrUnknownWebAuthnCredential
+	}
+
+	clientDataJSON, err := auth.verifyClientData(view.Credential.Response.ClientDataJSON, webAuthnGet, challenge)
+	if err != nil {
+		return "", err
+	}
+
+	rawAuthData, err := decodeWebAuthn(view.Credential.Response.AuthenticatorData)
+	if err != nil {
+		return "", ErrInvalidWebAuthnResponse
+	}
+
+	authData, err := auth.verifyAuthenticatorData(rawAuthData)
+	if err != nil {
+		return "", err
+	}
+
+	signature, err := decodeWebAuthn(view.Credential.Response.Signature)
+	if err != nil {
+		return "", ErrInvalidWebAuthnResponse
+	}
+
+	publicKey, err := parseCOSEKey(stored.PublicKey)
+	if err != nil {
+		return "", err
+	}
+
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	signed := append(append([]byte{}, rawAuthData...), clientDataHash[:]...)
+
+	if err := publicKey.verify(signed, signature); err != nil {
+		return "", ErrInvalidWebAuthnResponse
+	}
+
+	// Authenticators that keep a signature counter must always increase it,
+	// otherwise the credential may have been cloned. The counter is checked
+	// again against each fresh read, so a replayed assertion racing this one
+	// cannot also succeed.
+	credentials, err = UpdateCredentials(ctx, auth.repo, credentials, func(credentials *Credentials) error {
+		stored := findWebAuthnCredential(credentials, credentialId)
+		if stored == nil {
+			return ErrUnknownWebAuthnCredential
+		}
+
+		if (authData.SignCount != 0 || stored.SignCount != 0) && authData.SignCount <= stored.SignCount {
+			return ErrInvalidWebAuthnResponse
+		}
+
+		stored.SignCount = authData.SignCount
+		stored.LastUsedDate = time.Now()
+
+		return nil
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	return auth.issueToken(credentials, []string{AmrHardwareKey, AmrMFA})
+}
+
+// findWebAuthnCredential returns the user's credential with the given id, or
+// nil if they have none.
+func findWebAuthnCredential(credentials *Credentials, credentialId []byte) *WebAuthnCredential {
+	var stored *WebAuthnCredential
+	for _, credential := range credentials.WebAuthnCredentials {
+		if bytes.Equal(credential.CredentialId, credentialId) {
+			stored = credential
+		}
+	}
+
+	return stored
+}
+
+// issueWebAuthnSession returns a new challenge along with a session token
+// binding it to the ceremony and user. The session token is signed like an
+// access token but marked with token_use so it is never accepted as one.
+func (auth *TokenAuthenticator) issueWebAuthnSession(ceremony string, userId uuid.UUID) (string, string, error) {
+	challengeBytes, err := generateSalt(WebAuthnChallengeLength)
+	if err != nil {
+		return "", "", err
+	}
+
+	challenge := encodeWebAuthn(challengeBytes)
+	now := time.Now()
+
+	sessionToken, err := auth.signToken(map[string]interface{}{
+		"jti":       uuid.NewV4().String(),
+		"iss":       auth.issuer,
+		"id":        userId.String(),
+		"challenge": challenge,
+		"ceremony":  ceremony,
+		"iat":       now.Unix(),
+		"exp":       now.Add(WebAuthnTimeout).Unix(),
+		"token_use": "webauthn",
+	})
+
+	return sessionToken, challenge, err
+}
+
+// consumeWebAuthnSession checks the session token and revokes it, so every
+// challenge is only used once.
+func (auth *TokenAuthenticator) consumeWebAuthnSession(ctx context.Context, sessionToken string, ceremony string) (string, uuid.UUID, error) {
+	token, err := auth.parseToken(sessionToken)
+	if err != nil || token.Claims["token_use"] != "webauthn" || token.Claims["ceremony"] != ceremony {
+		return "", uuid.Nil, ErrInvalidWebAuthnSession
+	}
+
+	jti, _ := token.Claims["jti"].(string)
+	id, _ := token.Claims["id"].(string)
+	challenge, _ := token.Claims["challenge"].(string)
+	iat, _ := token.Claims["iat"].(float64)
+	exp, _ := token.Claims["exp"].(float64)
+	userId, _ := uuid.FromString(id)
+
+	revoked, err := auth.revocations.IsRevoked(ctx, jti, uuid.Nil, time.Unix(int64(iat), 0))
+	if err != nil || revoked || challenge == "" {
+		return "", uuid.Nil, ErrInvalidWebAuthnSession
+	}
+
+	if err := auth.revocations.RevokeToken(ctx, jti, time.Unix(int64(exp), 0)); err != nil {
+		return "", uuid.Nil, err
+	}
+
+	return challenge, userId, nil
+}
+
+// verifyClientData checks the client data the browser signed over and
+// returns it decoded.
+func (auth *TokenAuthenticator) verifyClientData(encoded string, ceremony string, challenge string) ([]byte, error) {
+	clientDataJSON, err := decodeWebAuthn(encoded)
+	if err != nil {
+		return nil, ErrInvalidWebAuthnResponse
+	}
+
+	var clientData struct {
+		Type        string `json:"type"`
+		Challenge   string `json:"challenge"`
+		Origin      string `json:"origin"`
+		CrossOrigin bool   `json:"crossOrigin"`
+	}
+
+	if err := json.Unmarshal(clientDataJSON, &clientData); err != nil {
+		return nil, ErrInvalidWebAuthnResponse
+	}
+
+	if clientData.Type != ceremony || clientData.CrossOrigin {
+		return nil, ErrInvalidWebAuthnResponse
+	}
+
+	if subtle.ConstantTimeCompare([]byte(clientData.Challenge), []byte(challenge)) != 1 {
+		return nil, ErrInvalidWebAuthnResponse
+	}
+
+	for _, origin := range auth.webAuthnOrigins() {
+		if clientData.Origin == origin {
+			return clientDataJSON, nil
+		}
+	}
+
+	return nil, ErrInvalidWebAuthnResponse
+}
+
+// verifyAuthenticatorData parses the authenticator data and checks it was
+// produced for this relying party with the user present and verified.
+func (auth *TokenAuthenticator) verifyAuthenticatorData(raw []byte) (*authenticatorData, error) {
+	authData, err := parseAuthenticatorData(raw)
+	if err != nil {
+		return nil, ErrInvalidWebAuthnResponse
+	}
+
+	rpIdHash := sha256.Sum256([]byte(auth.webAuthnRelyingPartyId()))
+	if !bytes.Equal(authData.RelyingPartyIdHash, rpIdHash[:]) {
+		return nil, ErrInvalidWebAuthnResponse
+	}
+
+	if authData.Flags&authDataUserPresent == 0 || authData.Flags&authDataUserVerified == 0 {
+		return nil, ErrInvalidWebAuthnResponse
+	}
+
+	return authData, nil
+}
+
+func (auth *TokenAuthenticator) webAuthnRelyingPartyId() string {
+	if WebAuthnRelyingPartyId != "" {
+		return WebAuthnRelyingPartyId
+	}
+
+	issuer, err := url.Parse(auth.issuer)
+	if err != nil {
+		return ""
+	}
+
+	return strings.Split(issuer.Host, ":")[0]
+}
+
+func (auth *TokenAuthenticator) webAuthnOrigins() []string {
+	if len(WebAuthnOrigins) != 0 {
+		return WebAuthnOrigins
+	}
+
+	issuer, err := url.Parse(auth.issuer)
+	if err != nil {
+		return []string{}
+	}
+
+	return []string{issuer.Scheme + "://" + issuer.Host}
+}
+
+func webAuthnDescriptors(credentials *Credentials) []WebAuthnCredentialDescriptor {
+	descriptors := []WebAuthnCredentialDescriptor{}
+
+	for _, credential := range credentials.WebAuthnCredentials {
+		descriptors = append(descriptors, WebAuthnCredentialDescriptor{Type: "public-key", Id: encodeWebAuthn(credential.CredentialId)})
+	}
+
+	return descriptors
+}
+
+func encodeWebAuthn(value []byte) string {
+	return base64.RawURLEncoding.EncodeToString(value)
+}
+
+// decodeWebAuthn accepts base64url with or without padding, as browsers and
+// libraries differ.
+func decodeWebAuthn(value string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(value, "="))
+}
+
+//=====================================================================================
+
+const (
+	authDataUserPresent      = 0x01
+	authDataUserVerified     = 0x04
+	authDataAttestedCredData = 0x40
+)
+
+type authenticatorData struct {
+	RelyingPartyIdHash  []byte
+	Flags               byte
+	SignCount           uint32
+	AAGUID              []byte
+	CredentialId        []byte
+	CredentialPublicKey []byte
+}
+
+// parseAuthenticatorData splits authenticator data into its fields, see
+// section 6.1 of the WebAuthn specification.
+func parseAuthenticatorData(raw []byte) (*authenticatorData, error) {
+	if len(raw) < 37 {
+		return nil, errors.New("authenticator data is too short")
+	}
+
+	authData := &authenticatorData{
+		RelyingPartyIdHash: raw[:32],
+		Flags:              raw[32],
+		SignCount:          binary.BigEndian.Uint32(raw[33:37]),
+	}
+
+	if authData.Flags&authDataAttestedCredData == 0 {
+		return authData, nil
+	}
+
+	rest := raw[37:]
+	if len(rest) < 18 {
+		return nil, errors.New("attested credential data is too short")
+	}
+
+	authData.AAGUID = rest[:16]
+	idLength := int(binary.BigEndian.Uint16(rest[16:18]))
+	rest = rest[18:]
+
+	if len(rest) < idLength {
+		return nil, errors.New("credential id is too short")
+	}
+
+	authData.CredentialId = rest[:idLength]
+	rest = rest[idLength:]
+
+	// The public key is followed by optional extensions, so only the first
+	// CBOR item belongs to it.
+	var publicKey cbor.RawMessage
+	if _, err := cbor.UnmarshalFirst(rest, &publicKey); err != nil {
+		return nil, fmt.Errorf("invalid credential public key: %v", err)
+	}
+
+	authData.CredentialPublicKey = publicKey
+
+	return authData, nil
+}
+
+//=====================================================================================
+
+// Begins registering a passkey for the authenticated user
+func BeginWebAuthnRegistration(c *gin.Context) {
+	auth := c.MustGet("auth").(Authenticator)
+	id := GetIdParam(c.MustGet("userId").(string), c)
+
+	if id == uuid.Nil {
+		return
+	}
+
+	response, err := auth.BeginWebAuthnRegistration(c.Request.Context(), id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+	return
+}
+
+// Verifies the authenticator's response and stores the new passkey
+func FinishWebAuthnRegistration(c *gin.Context) {
+	auth := c.MustGet("auth").(Authenticator)
+	id := GetIdParam(c.MustGet("userId").(string), c)
+
+	if id == uuid.Nil {
+		return
+	}
+
+	var view *WebAuthnRegistrationView
+	c.Bind(&view)
+
+	if view == nil || view.SessionToken == "" {
+		c.JSON(http.StatusBadRequest, NewError(ErrCodeValueRequired, "session token and credential are required fields"))
+		return
+	}
+
+	err := auth.FinishWebAuthnRegistration(c.Request.Context(), id, view)
+
+	switch err {
+	case nil:
+		c.JSON(http.StatusCreated, "passkey registered")
+	case ErrWebAuthnCredentialInUse:
+		c.JSON(http.StatusBadRequest, NewError(ErrCodeAlreadyExists, "credential is already registered"))
+	case ErrInvalidWebAuthnSession, ErrInvalidWebAuthnResponse:
+		c.JSON(http.StatusBadRequest, NewError(ErrCodeInvalidCredential, "credential is invalid"))
+	case ErrConflict:
+		c.JSON(http.StatusConflict, NewError(ErrCodeConflict, "credentials were changed by another request"))
+	default:
+		fmt.Printf("ERROR: %v\n", err.Error())
+		c.JSON(http.StatusBadRequest, NewError(ErrCodeInvalidCredential, "credential is invalid"))
+	}
+	return
+}
+
+// Begins a passkey login
+func BeginWebAuthnLogin(c *gin.Context) {
+	auth := c.MustGet("auth").(Authenticator)
+
+	c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
+
+	var view *WebAuthnLoginRequestView
+	c.Bind(&view)
+
+	email := ""
+	if view != nil {
+		email = strings.ToLower(view.Email)
+	}
+
+	response, err := auth.BeginWebAuthnLogin(c.Request.Context(), email)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+	return
+}
+
+// Verifies a passkey assertion and returns an Auth token
+func FinishWebAuthnLogin(c *gin.Context) {
+	auth := c.MustGet("auth").(Authenticator)
+
+	c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
+
+	var view *WebAuthnLoginView
+	c.Bind(&view)
+
+	if view == nil || view.SessionToken == "" {
+		c.JSON(http.StatusBadRequest, NewError(ErrCodeValueRequired, "session token and credential are required fields"))
+		return
+	}
+
+	token, auth_err := auth.FinishWebAuthnLogin(c.Request.Context(), view)
+	if auth_err == ErrConflict {
+		c.JSON(http.StatusConflict, NewError(ErrCodeConflict, "credentials were changed by another request"))
+		return
+	}
+
+	if auth_err != nil {
+		fmt.Printf("ERROR: %v\n", auth_err.Error())
+		c.JSON(http.StatusUnauthorized, NewError(ErrCodeInvalidCredential, "credential is invalid"))
+		return
+	}
+
+	id, _ := auth.GetTokenClaim(token, "id")
+	email, _ := auth.GetTokenClaim(token, "email")
+	userId, _ := uuid.FromString(id.(string))
+
+	refreshToken, refresh_err := auth.IssueRefreshToken(c.Request.Context(), userId, tokenAmr(auth, token))
+	if refresh_err != nil {
+		c.JSON(http.StatusInternalServerError, refresh_err.Error())
+		return
+	}
+
+	response := AuthResponse{
+		Id:           userId,
+		Email:        email.(string),
+		Token:        token,
+		RefreshToken: refreshToken,
+	}
+
+	c.JSON(http.StatusOK, response)
+	return
+}
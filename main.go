@@ -13,11 +13,48 @@ import (
 func main() {
 	config := BuildConfig()
 	publisher := NewAmpqPublisher(config.GetExchangeAddress(), config.GetAmpqUsername(), config.GetAmpqPassword(), config.GetTopic())
-	repo := NewMongoRepo(config.GetDbHosts(), config.GetAuthDb(), config.GetDbUsername(), config.GetDbPassword())
 
-	auth := BuildAuthenticator(repo, config.GetPrivateKeyPath(), config.GetPublicKeyPath())
+	var repo Repo
+	var revocations RevocationStore
 
-	if err := http.ListenAndServe(":8001", NewRouter(publisher, repo, auth)); err != nil {
+	switch config.GetDbDriver() {
+	case "mongodb":
+		repo = NewMongoRepo(config.GetDbHosts(), config.GetAuthDb(), config.GetDbUsername(), config.GetDbPassword(), config.GetDbName(), config.GetDbCollections())
+		revocations = NewMongoRevocationStore(config.GetDbHosts(), config.GetAuthDb(), config.GetDbUsername(), config.GetDbPassword(), config.GetDbName(), config.GetDbCollections())
+	default:
+		// One database, migrated once, so a sqlite3 :memory: source is shared
+		// rather than opened twice.
+		db := OpenSQL(config.GetDbDriver(), config.GetDbSource())
+		repo = NewSQLRepoFromDB(db)
+		revocations = NewSQLRevocationStoreFromDB(db)
+	}
+
+	if err := SetDefaultPasswordHasher(config.GetPasswordHasher()); err != nil {
+		log.Fatal(err)
+	}
+
+	DefaultPasswordPolicy = config.GetPasswordPolicy()
+
+	if path := config.GetBreachCorpusPath(); path != "" {
+		corpus, err := LoadBreachCorpus(path)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		log.Printf("Loaded %d breached password hashes", corpus.Len())
+		DefaultPasswordPolicy.BreachCorpus = corpus
+	}
+
+	RequestTimeout = config.GetRequestTimeout()
+
+	EmailVerificationLifetime = config.GetEmailVerificationLifetime()
+
+	WebAuthnRelyingPartyId = config.GetWebAuthnRelyingPartyId()
+	WebAuthnOrigins = config.GetWebAuthnOrigins()
+
+	auth := BuildAuthenticator(repo, revocations, config.GetIssuer(), config.GetPrivateKeyPath(), config.GetPublicKeyPath(), config.GetRetiredPublicKeyPaths()...)
+
+	if err := http.ListenAndServe(":8001", NewRouter(publisher, repo, auth, NewMemoryRateLimitStore())); err != nil {
 		log.Fatal(err)
 	}
 }